@@ -0,0 +1,73 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/services/ratelimit"
+)
+
+func envLimit(key, fallback string) ratelimit.Limit {
+	value := os.Getenv(key)
+	if value == "" {
+		value = fallback
+	}
+
+	limit, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		log.Printf("[WARN] %s: %v, using default %s", key, err, fallback)
+		limit, _ = ratelimit.ParseLimit(fallback)
+	}
+	return limit
+}
+
+func envString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("[WARN] %s: invalid number %q, using default %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("[WARN] %s: invalid duration %q, using default %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+func envBool(key string, fallback bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("[WARN] %s: invalid boolean %q, using default %t", key, value, fallback)
+		return fallback
+	}
+	return b
+}
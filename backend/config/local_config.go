@@ -21,6 +21,16 @@ func InitDB() (*gorm.DB, error) {
 		}
 	}
 
+	db, err := gorm.Open(postgres.Open(DatabaseDSN()), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// Build the postgres connection string from the environment
+func DatabaseDSN() string {
 	host := os.Getenv("DB_HOST")
 	user := os.Getenv("DB_USER")
 	password := os.Getenv("DB_PASSWORD")
@@ -28,15 +38,8 @@ func InitDB() (*gorm.DB, error) {
 	port := os.Getenv("DB_PORT")
 	// bucket := os.Getenv("BUCKETNAME")
 
-	dsn := fmt.Sprintf(
+	return fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=require",
 		host, user, password, dbName, port,
 	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
-	}
-
-	return db, nil
 }
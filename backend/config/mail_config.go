@@ -0,0 +1,22 @@
+package config
+
+type MailConfig struct {
+	Driver string // log (default) or file
+	Dir    string // where the file driver writes emails
+	From   string
+	AppURL string // base url used in links sent by email
+
+	RequireVerifiedToJoin bool // unverified users cannot be added to events
+}
+
+// Load mail settings from the environment, falling back to defaults
+func LoadMailConfig() MailConfig {
+	return MailConfig{
+		Driver: envString("MAILER", "log"),
+		Dir:    envString("MAIL_DIR", "mail"),
+		From:   envString("MAIL_FROM", "PicSort <no-reply@picsort.local>"),
+		AppURL: envString("APP_URL", "http://localhost:8080"),
+
+		RequireVerifiedToJoin: envBool("REQUIRE_VERIFIED_EMAIL", false),
+	}
+}
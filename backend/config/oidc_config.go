@@ -0,0 +1,56 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Rynoo1/PicSort/backend/services/oidc"
+)
+
+// Name and client id of the local mock provider
+const (
+	MockOIDCProvider = "mock"
+	MockOIDCClientID = "picsort"
+)
+
+type OIDCConfig struct {
+	Providers   map[string]oidc.Config // provider name -> settings, the name is used in the login urls
+	AppRedirect string                 // where the callback sends the token, empty returns it as JSON
+	Mock        bool                   // serve a mock issuer at /mock-oidc and add it as the "mock" provider
+	MockIssuer  string                 // public url of the mock issuer
+}
+
+// Load OpenID Connect providers, OIDC_PROVIDERS holds a JSON object of provider name -> settings
+func LoadOIDCConfig() OIDCConfig {
+	appURL := strings.TrimRight(envString("APP_URL", "http://localhost:8080"), "/")
+	cfg := OIDCConfig{
+		Providers:   make(map[string]oidc.Config),
+		AppRedirect: os.Getenv("OIDC_APP_REDIRECT"),
+		Mock:        envBool("OIDC_MOCK", false),
+		MockIssuer:  appURL + "/mock-oidc",
+	}
+
+	if value := os.Getenv("OIDC_PROVIDERS"); value != "" {
+		if err := json.Unmarshal([]byte(value), &cfg.Providers); err != nil {
+			log.Printf("[WARN] OIDC_PROVIDERS: invalid JSON, no providers loaded: %v", err)
+			cfg.Providers = make(map[string]oidc.Config)
+		}
+	}
+	for name, provider := range cfg.Providers {
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			log.Printf("[WARN] OIDC_PROVIDERS: %s needs issuer, client_id and redirect_url, skipping", name)
+			delete(cfg.Providers, name)
+		}
+	}
+
+	if cfg.Mock {
+		cfg.Providers[MockOIDCProvider] = oidc.Config{
+			Issuer:      cfg.MockIssuer,
+			ClientID:    MockOIDCClientID,
+			RedirectURL: appURL + "/auth/oidc/" + MockOIDCProvider + "/callback",
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// Plan every user starts on
+const DefaultPlan = "free"
+
+// Quota limits for a plan, 0 means unlimited. Event limits apply using the plan of the organization
+// owning the event, or the event owner's plan. Organization limits cover all of an organization's events.
+type PlanLimits struct {
+	UserMaxBytes          int64 `json:"user_max_bytes"`
+	UserMaxPhotos         int64 `json:"user_max_photos"`
+	UserMonthlyFaceCalls  int64 `json:"user_monthly_face_calls"`
+	EventMaxBytes         int64 `json:"event_max_bytes"`
+	EventMaxPhotos        int64 `json:"event_max_photos"`
+	EventMonthlyFaceCalls int64 `json:"event_monthly_face_calls"`
+	OrgMaxBytes           int64 `json:"org_max_bytes"`
+	OrgMaxPhotos          int64 `json:"org_max_photos"`
+	OrgMonthlyFaceCalls   int64 `json:"org_monthly_face_calls"`
+}
+
+const gigabyte = 1 << 30
+
+var defaultPlans = map[string]PlanLimits{
+	"free": {
+		UserMaxBytes:          2 * gigabyte,
+		UserMaxPhotos:         1000,
+		UserMonthlyFaceCalls:  5000,
+		EventMaxBytes:         2 * gigabyte,
+		EventMaxPhotos:        1000,
+		EventMonthlyFaceCalls: 5000,
+		OrgMaxBytes:           5 * gigabyte,
+		OrgMaxPhotos:          2500,
+		OrgMonthlyFaceCalls:   10000,
+	},
+	"pro": {
+		UserMaxBytes:          50 * gigabyte,
+		UserMaxPhotos:         25000,
+		UserMonthlyFaceCalls:  100000,
+		EventMaxBytes:         20 * gigabyte,
+		EventMaxPhotos:        10000,
+		EventMonthlyFaceCalls: 50000,
+		OrgMaxBytes:           200 * gigabyte,
+		OrgMaxPhotos:          100000,
+		OrgMonthlyFaceCalls:   250000,
+	},
+}
+
+// Load quota plans, QUOTA_PLANS can hold a JSON object of plan name -> limits that replaces or adds plans
+func LoadQuotaPlans() map[string]PlanLimits {
+	plans := make(map[string]PlanLimits, len(defaultPlans))
+	for name, limits := range defaultPlans {
+		plans[name] = limits
+	}
+
+	value := os.Getenv("QUOTA_PLANS")
+	if value == "" {
+		return plans
+	}
+
+	var overrides map[string]PlanLimits
+	if err := json.Unmarshal([]byte(value), &overrides); err != nil {
+		log.Printf("[WARN] QUOTA_PLANS: invalid JSON, using default plans: %v", err)
+		return plans
+	}
+	for name, limits := range overrides {
+		plans[name] = limits
+	}
+	return plans
+}
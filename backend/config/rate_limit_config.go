@@ -0,0 +1,41 @@
+package config
+
+import (
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/services/ratelimit"
+)
+
+type RateLimitConfig struct {
+	LoginPerIP     ratelimit.Limit
+	RegisterPerIP  ratelimit.Limit
+	SearchPerUser  ratelimit.Limit
+	SearchPerEvent ratelimit.Limit
+	UploadPerUser  ratelimit.Limit // counted per presigned key
+	UploadPerEvent ratelimit.Limit // counted per presigned key
+	VerifyPerUser  ratelimit.Limit // verification emails resent
+	SharePerIP     ratelimit.Limit // public album share link requests
+	MaxUploadFiles int             // files allowed in one upload-URL request
+
+	LoginMaxFailures int
+	LoginLockout     time.Duration
+}
+
+// Load rate limits from the environment, falling back to defaults.
+// Limits use the form "<requests>/<duration>" (e.g. RATE_LIMIT_LOGIN_IP=10/1m), "off" disables one.
+func LoadRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		LoginPerIP:     envLimit("RATE_LIMIT_LOGIN_IP", "10/1m"),
+		RegisterPerIP:  envLimit("RATE_LIMIT_REGISTER_IP", "5/10m"),
+		SearchPerUser:  envLimit("RATE_LIMIT_SEARCH_USER", "20/1m"),
+		SearchPerEvent: envLimit("RATE_LIMIT_SEARCH_EVENT", "60/1m"),
+		UploadPerUser:  envLimit("RATE_LIMIT_UPLOAD_USER", "500/10m"),
+		UploadPerEvent: envLimit("RATE_LIMIT_UPLOAD_EVENT", "2000/10m"),
+		VerifyPerUser:  envLimit("RATE_LIMIT_VERIFY_USER", "3/10m"),
+		SharePerIP:     envLimit("RATE_LIMIT_SHARE_IP", "30/1m"),
+		MaxUploadFiles: envInt("MAX_UPLOAD_FILES", 200),
+
+		LoginMaxFailures: envInt("LOGIN_MAX_FAILURES", 5),
+		LoginLockout:     envDuration("LOGIN_LOCKOUT", 15*time.Minute),
+	}
+}
@@ -0,0 +1,8 @@
+package config
+
+import "time"
+
+// How long before an event expires its members are warned
+func RetentionWarning() time.Duration {
+	return envDuration("RETENTION_WARNING", 7*24*time.Hour)
+}
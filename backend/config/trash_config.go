@@ -0,0 +1,8 @@
+package config
+
+import "time"
+
+// How long soft deleted photos and events stay in the trash before they are purged
+func TrashRetention() time.Duration {
+	return envDuration("TRASH_RETENTION", 30*24*time.Hour)
+}
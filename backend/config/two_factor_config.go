@@ -0,0 +1,6 @@
+package config
+
+// Name authenticator apps show next to PicSort accounts
+func TOTPIssuer() string {
+	return envString("TOTP_ISSUER", "PicSort")
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Logged in user and request id, recorded in the audit log
+func auditActor(c *fiber.Ctx) db.Actor {
+	actor := db.Actor{}
+	if user, ok := c.Locals("user").(*models.User); ok {
+		actor.UserID = user.ID
+	}
+	if requestId, ok := c.Locals("requestid").(string); ok {
+		actor.RequestID = requestId
+	}
+	return actor
+}
+
+// Check the logged in user is part of the event, or an admin of the organization that owns it.
+// Returns true when an error response has already been sent and the handler should return err.
+func checkEventMember(c *fiber.Ctx, svc *services.AppServices, eventId uint) (bool, error) {
+	user := c.Locals("user").(*models.User)
+
+	exists, err := svc.EventRepo.CheckAccess(user.ID, eventId)
+	if err != nil {
+		return true, c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when checking user in event",
+		})
+	}
+	if !exists {
+		return true, c.Status(403).JSON(fiber.Map{
+			"error": "user is not part of this event",
+		})
+	}
+	return false, nil
+}
+
+// Check the logged in user owns the event.
+// Returns true when an error response has already been sent and the handler should return err.
+func checkEventOwner(c *fiber.Ctx, svc *services.AppServices, eventId uint) (bool, error) {
+	user := c.Locals("user").(*models.User)
+
+	owner, err := svc.EventRepo.CheckOwner(user.ID, eventId)
+	if err != nil {
+		return true, c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when checking event owner",
+		})
+	}
+	if !owner {
+		return true, c.Status(403).JSON(fiber.Map{
+			"error": "only the event owner can do this",
+		})
+	}
+	return false, nil
+}
+
+// Check the users may join events, refused when email verification is required and one is unverified.
+// Returns true when an error response has already been sent and the handler should return err.
+func checkVerifiedMembers(c *fiber.Ctx, svc *services.AppServices, userIds []uint) (bool, error) {
+	unverified, err := svc.UserService.FindUnverified(userIds)
+	if err != nil {
+		return true, c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when checking users",
+		})
+	}
+	if len(unverified) > 0 {
+		return true, c.Status(403).JSON(fiber.Map{
+			"error":    "users must verify their email before joining events",
+			"user_ids": unverified,
+		})
+	}
+	return false, nil
+}
+
+// Find the logged in user's role in an organization, refused when they are not a member or,
+// with adminOnly, not an owner or admin.
+// Returns true when an error response has already been sent and the handler should return err.
+func checkOrgRole(c *fiber.Ctx, svc *services.AppServices, orgId uint, adminOnly bool) (string, bool, error) {
+	user := c.Locals("user").(*models.User)
+
+	role, err := svc.OrganizationService.OrganizationRepo.FindRole(orgId, user.ID)
+	if err != nil {
+		return "", true, c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when checking organization member",
+		})
+	}
+	if role == "" {
+		return "", true, c.Status(403).JSON(fiber.Map{
+			"error": "user is not part of this organization",
+		})
+	}
+	if adminOnly && !services.IsOrgAdmin(role) {
+		return "", true, c.Status(403).JSON(fiber.Map{
+			"error": "only organization owners and admins can do this",
+		})
+	}
+	return role, false, nil
+}
+
+// Find an album and check the logged in user is part of its event, or owns the event with owner set.
+// Returns true when an error response has already been sent and the handler should return err.
+func checkAlbum(c *fiber.Ctx, svc *services.AppServices, albumId uint, owner bool) (*models.Album, bool, error) {
+	album, err := svc.AlbumService.AlbumRepo.FindAlbum(albumId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, true, c.Status(404).JSON(fiber.Map{
+				"error": "album not found",
+			})
+		}
+		return nil, true, c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when finding album",
+		})
+	}
+
+	check := checkEventMember
+	if owner {
+		check = checkEventOwner
+	}
+	if done, err := check(c, svc, album.EventID); done {
+		return nil, true, err
+	}
+	return album, false, nil
+}
+
+// Find a photo and check the logged in user is part of its event.
+// Returns true when an error response has already been sent and the handler should return err.
+func checkPhoto(c *fiber.Ctx, svc *services.AppServices, photoId uint) (*models.Photos, bool, error) {
+	photo, err := svc.InteractionService.InteractionRepo.FindPhoto(photoId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, true, c.Status(404).JSON(fiber.Map{
+				"error": "photo not found",
+			})
+		}
+		return nil, true, c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when finding photo",
+		})
+	}
+
+	if done, err := checkEventMember(c, svc, photo.EventID); done {
+		return nil, true, err
+	}
+	return photo, false, nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Export everything held about the logged in user as a zip archive, returns a download link
+func ExportAccount(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	export, err := svc.AccountService.Export(c.Context(), user)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(export)
+}
+
+// Permanently delete the logged in user's account, the password must be confirmed.
+// Users who only sign in with an external provider confirm with their email instead.
+func DeleteAccount(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		Password string `json:"password"`
+		Email    string `json:"email"`   // confirmation for users without a password
+		Uploads  string `json:"uploads"` // delete or reassign
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+	if body.Uploads != services.UploadsDelete && body.Uploads != services.UploadsReassign {
+		return c.Status(400).JSON(fiber.Map{
+			"error": services.ErrUploadsMode.Error(),
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+	if user.HasPassword() && !user.CheckPassword(body.Password) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "incorrect password",
+		})
+	}
+	if !user.HasPassword() && !strings.EqualFold(strings.TrimSpace(body.Email), user.Email) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "email does not match the account",
+		})
+	}
+
+	if err := svc.AccountService.DeleteAccount(c.Context(), user.ID, body.Uploads, auditActor(c)); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": "account deleted",
+	})
+}
@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Create an album in an event - event owner only
+func CreateAlbum(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId uint   `json:"event_id"`
+		Name    string `json:"name"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, body.EventId); done {
+		return err
+	}
+
+	album, err := svc.AlbumService.Create(body.EventId, body.Name, auditActor(c))
+	if err != nil {
+		if errors.Is(err, services.ErrAlbumName) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(album)
+}
+
+// Return an event's albums in order
+func ReturnAlbums(c *fiber.Ctx, svc *services.AppServices) error {
+	var req struct {
+		EventId uint `json:"event_id" query:"event_id"`
+	}
+	if err := parseRequest(c, &req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if done, err := checkEventMember(c, svc, req.EventId); done {
+		return err
+	}
+
+	albums, err := svc.AlbumService.AlbumRepo.FindEventAlbums(req.EventId)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(albums)
+}
+
+// Return an album's photos in order with presigned urls
+func ReturnAlbumPhotos(c *fiber.Ctx, svc *services.AppServices) error {
+	var req struct {
+		AlbumId uint `json:"album_id" query:"album_id"`
+	}
+	if err := parseRequest(c, &req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	album, done, err := checkAlbum(c, svc, req.AlbumId, false)
+	if done {
+		return err
+	}
+	user := c.Locals("user").(*models.User)
+
+	images, err := svc.AlbumService.Photos(c.Context(), user.ID, album)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "could not get presign URLs for album",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"album":  album,
+		"images": images,
+	})
+}
+
+// Rename an album - event owner only
+func RenameAlbum(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		AlbumId uint   `json:"album_id"`
+		Name    string `json:"name"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	album, done, err := checkAlbum(c, svc, body.AlbumId, true)
+	if done {
+		return err
+	}
+
+	if err := svc.AlbumService.Rename(album, body.Name); err != nil {
+		if errors.Is(err, services.ErrAlbumName) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "album renamed",
+	})
+}
+
+// Delete an album, its photos stay in the event - event owner only
+func DeleteAlbum(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		AlbumId uint `json:"album_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	album, done, err := checkAlbum(c, svc, body.AlbumId, true)
+	if done {
+		return err
+	}
+
+	if err := svc.AlbumService.AlbumRepo.DeleteAlbum(album, auditActor(c)); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "album deleted",
+	})
+}
+
+// Put an event's albums in order - event owner only
+func ReorderAlbums(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId  uint   `json:"event_id"`
+		AlbumIds []uint `json:"album_ids"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, body.EventId); done {
+		return err
+	}
+
+	if err := svc.AlbumService.AlbumRepo.ReorderAlbums(body.EventId, body.AlbumIds); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "albums reordered",
+	})
+}
+
+// Add event photos to the end of an album - event owner only
+func AddAlbumPhotos(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		AlbumId  uint   `json:"album_id"`
+		PhotoIds []uint `json:"photo_ids"`
+	}
+	if err := c.BodyParser(&body); err != nil || len(body.PhotoIds) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "photo_ids is required",
+		})
+	}
+
+	album, done, err := checkAlbum(c, svc, body.AlbumId, true)
+	if done {
+		return err
+	}
+
+	added, err := svc.AlbumService.AlbumRepo.AddPhotos(album, body.PhotoIds)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "photos added to album",
+		"added":   added,
+	})
+}
+
+// Remove photos from an album, they stay in the event - event owner only
+func RemoveAlbumPhotos(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		AlbumId  uint   `json:"album_id"`
+		PhotoIds []uint `json:"photo_ids"`
+	}
+	if err := c.BodyParser(&body); err != nil || len(body.PhotoIds) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "photo_ids is required",
+		})
+	}
+
+	album, done, err := checkAlbum(c, svc, body.AlbumId, true)
+	if done {
+		return err
+	}
+
+	removed, err := svc.AlbumService.AlbumRepo.RemovePhotos(album.ID, body.PhotoIds)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "photos removed from album",
+		"removed": removed,
+	})
+}
+
+// Put an album's photos in order - event owner only
+func ReorderAlbumPhotos(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		AlbumId  uint   `json:"album_id"`
+		PhotoIds []uint `json:"photo_ids"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	album, done, err := checkAlbum(c, svc, body.AlbumId, true)
+	if done {
+		return err
+	}
+
+	if err := svc.AlbumService.AlbumRepo.ReorderPhotos(album.ID, body.PhotoIds); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "album photos reordered",
+	})
+}
+
+// Pack an album into a zip archive and return a link to download it
+func DownloadAlbum(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		AlbumId uint `json:"album_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	album, done, err := checkAlbum(c, svc, body.AlbumId, false)
+	if done {
+		return err
+	}
+	user := c.Locals("user").(*models.User)
+
+	return albumDownload(c, svc, user.ID, album)
+}
+
+// Respond with a download link for an album, as seen by viewerId
+func albumDownload(c *fiber.Ctx, svc *services.AppServices, viewerId uint, album *models.Album) error {
+	download, err := svc.AlbumService.Download(c.Context(), viewerId, album)
+	if err != nil {
+		if errors.Is(err, services.ErrAlbumEmpty) || errors.Is(err, services.ErrAlbumLarge) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to pack album",
+		})
+	}
+
+	return c.JSON(download)
+}
+
+// Create a link anyone can use to view and download an album, only returned this once - event owner only
+func ShareAlbum(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		AlbumId       uint       `json:"album_id"`
+		ExpiresAt     *time.Time `json:"expires_at"`      // RFC3339, optional
+		ExpiresInDays *int       `json:"expires_in_days"` // alternative to expires_at
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if body.ExpiresAt != nil && body.ExpiresInDays != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "set either expires_at or expires_in_days, not both",
+		})
+	}
+	expiresAt := body.ExpiresAt
+	if body.ExpiresInDays != nil {
+		if *body.ExpiresInDays <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "expires_in_days must be positive",
+			})
+		}
+		at := time.Now().AddDate(0, 0, *body.ExpiresInDays)
+		expiresAt = &at
+	}
+
+	album, done, err := checkAlbum(c, svc, body.AlbumId, true)
+	if done {
+		return err
+	}
+	user := c.Locals("user").(*models.User)
+
+	link, err := svc.AlbumService.Share(user, album, expiresAt, auditActor(c))
+	if err != nil {
+		if errors.Is(err, services.ErrShareExpiry) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(link)
+}
+
+// Return an album's share links - event owner only
+func ReturnAlbumShares(c *fiber.Ctx, svc *services.AppServices) error {
+	var req struct {
+		AlbumId uint `json:"album_id" query:"album_id"`
+	}
+	if err := parseRequest(c, &req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	album, done, err := checkAlbum(c, svc, req.AlbumId, true)
+	if done {
+		return err
+	}
+
+	shares, err := svc.AlbumService.AlbumRepo.FindShares(album.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"shares": shares,
+	})
+}
+
+// Revoke an album share link - event owner only
+func RevokeAlbumShare(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		AlbumId uint `json:"album_id"`
+		ShareId uint `json:"share_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	album, done, err := checkAlbum(c, svc, body.AlbumId, true)
+	if done {
+		return err
+	}
+
+	revoked, err := svc.AlbumService.AlbumRepo.RevokeShare(album, body.ShareId, auditActor(c))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if !revoked {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "share link not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "share link revoked",
+	})
+}
+
+// Find the album a share link opens, responds 404 when the link does not work
+func sharedAlbum(c *fiber.Ctx, svc *services.AppServices) (*models.Album, bool, error) {
+	album, err := svc.AlbumService.SharedAlbum(c.Params("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrShareLink) {
+			return nil, true, c.Status(404).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return nil, true, c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when finding album",
+		})
+	}
+	return album, false, nil
+}
+
+// Return a shared album's photos to anyone with the link, blurred copies are served where they exist
+func ReturnSharedAlbum(c *fiber.Ctx, svc *services.AppServices) error {
+	album, done, err := sharedAlbum(c, svc)
+	if done {
+		return err
+	}
+
+	images, err := svc.AlbumService.Photos(c.Context(), 0, album)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "could not get presign URLs for album",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"name":   album.Name,
+		"images": images,
+	})
+}
+
+// Pack a shared album into a zip archive for anyone with the link
+func DownloadSharedAlbum(c *fiber.Ctx, svc *services.AppServices) error {
+	album, done, err := sharedAlbum(c, svc)
+	if done {
+		return err
+	}
+
+	return albumDownload(c, svc, 0, album)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Create a personal API key, the key is only returned this once
+func CreateAPIKey(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		Name          string     `json:"name"`
+		Scope         string     `json:"scope"`           // read or upload
+		EventId       *uint      `json:"event_id"`        // optional, limits the key to one event
+		ExpiresAt     *time.Time `json:"expires_at"`      // RFC3339, optional
+		ExpiresInDays *int       `json:"expires_in_days"` // alternative to expires_at
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if body.ExpiresAt != nil && body.ExpiresInDays != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "set either expires_at or expires_in_days, not both",
+		})
+	}
+	expiresAt := body.ExpiresAt
+	if body.ExpiresInDays != nil {
+		if *body.ExpiresInDays <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "expires_in_days must be positive",
+			})
+		}
+		at := time.Now().AddDate(0, 0, *body.ExpiresInDays)
+		expiresAt = &at
+	}
+
+	user := c.Locals("user").(*models.User)
+	raw, key, err := svc.APIKeyService.CreateKey(user, body.Name, body.Scope, body.EventId, expiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAPIKeyName),
+			errors.Is(err, services.ErrAPIKeyScope),
+			errors.Is(err, services.ErrAPIKeyExpiry):
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrAPIKeyEvent):
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"key":     raw,
+		"api_key": key,
+	})
+}
+
+// Return the logged in user's API keys
+func ListAPIKeys(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	keys, err := svc.APIKeyService.ListKeys(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"api_keys": keys,
+	})
+}
+
+// Revoke one of the logged in user's API keys
+func RevokeAPIKey(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		KeyId uint `json:"key_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+	revoked, err := svc.APIKeyService.RevokeKey(user.ID, body.KeyId)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if !revoked {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "API key not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": "API key revoked",
+	})
+}
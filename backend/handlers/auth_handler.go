@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
+	"github.com/Rynoo1/PicSort/backend/middleware"
 	"github.com/Rynoo1/PicSort/backend/models"
 	"github.com/Rynoo1/PicSort/backend/services"
 	"github.com/gofiber/fiber/v2"
@@ -10,16 +14,22 @@ import (
 )
 
 type AuthHandler struct {
-	db           *gorm.DB
-	authServices *services.AuthService
-	userService  *services.UserService
+	db                  *gorm.DB
+	authServices        *services.AuthService
+	userService         *services.UserService
+	verificationService *services.VerificationService
+	oidcService         *services.OIDCService
+	twoFactorService    *services.TwoFactorService
 }
 
-func NewAuthHandler(db *gorm.DB, authService *services.AuthService, userService *services.UserService) *AuthHandler {
+func NewAuthHandler(db *gorm.DB, authService *services.AuthService, userService *services.UserService, verificationService *services.VerificationService, oidcService *services.OIDCService, twoFactorService *services.TwoFactorService) *AuthHandler {
 	return &AuthHandler{
-		db:           db,
-		authServices: authService,
-		userService:  userService,
+		db:                  db,
+		authServices:        authService,
+		userService:         userService,
+		verificationService: verificationService,
+		oidcService:         oidcService,
+		twoFactorService:    twoFactorService,
 	}
 }
 
@@ -40,6 +50,18 @@ type AuthResponse struct {
 	User    *models.User `json:"user"`
 }
 
+// First step of a two-factor login, the challenge token is sent back with a code to /auth/login/2fa
+type ChallengeResponse struct {
+	Message           string `json:"message"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"` // TOTP code or recovery code
+}
+
 // Create New User
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var req RegisterRrequest
@@ -50,12 +72,25 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		})
 		return err
 	}
+	if req.Password == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "password is required",
+		})
+	}
 
 	user, err := h.userService.CreateUser(req.Email, req.Username, req.Password)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidEmail) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
 		return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	// the account is usable straight away, the verification link can be resent if this fails
+	if err := h.verificationService.SendVerification(c.Context(), user); err != nil {
+		log.Printf("[AUTH] failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	// Generate JWT token
 	token, err := h.authServices.GenerateToken(user)
 	if err != nil {
@@ -81,12 +116,46 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	}
 
 	user, err := h.userService.FindByEmail(req.Email)
-	if err != nil || !user.CheckPassword(req.Password) {
+	if err != nil {
 		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid credentials",
 		})
 	}
 
+	// Refuse logins while the account is locked after repeated failures
+	if wait, locked := user.LockedFor(time.Now()); locked {
+		return middleware.TooManyRequests(c, wait, "Account temporarily locked after too many failed logins")
+	}
+
+	if !user.CheckPassword(req.Password) {
+		if err := h.userService.RecordFailedLogin(user); err != nil {
+			log.Printf("[AUTH] failed to record failed login for user %d: %v", user.ID, err)
+		}
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid credentials",
+		})
+	}
+
+	// The password is not enough for users with two-factor authentication, they get a challenge to complete.
+	// Failed logins are only reset once the code is accepted so codes cannot be guessed without limit.
+	if user.TOTPEnabled {
+		challenge, err := h.twoFactorService.Challenge(user)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate token",
+			})
+		}
+		return c.JSON(ChallengeResponse{
+			Message:           "Two-factor code required",
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+		})
+	}
+
+	if err := h.userService.ResetFailedLogins(user); err != nil {
+		log.Printf("[AUTH] failed to reset failed logins for user %d: %v", user.ID, err)
+	}
+
 	// Generate JWT token
 	token, err := h.authServices.GenerateToken(user)
 	if err != nil {
@@ -102,6 +171,89 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	})
 }
 
+// Complete a two-factor login with a TOTP or recovery code and return a JWT token
+func (h *AuthHandler) LoginTwoFactor(c *fiber.Ctx) error {
+	var req TwoFactorLoginRequest
+	if err := c.BodyParser(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "challenge_token and code are required",
+		})
+	}
+
+	user, err := h.twoFactorService.ChallengeUser(req.ChallengeToken)
+	if err != nil {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	if wait, locked := user.LockedFor(time.Now()); locked {
+		return middleware.TooManyRequests(c, wait, "Account temporarily locked after too many failed logins")
+	}
+
+	if err := h.twoFactorService.VerifyCode(user, req.Code); err != nil {
+		if !errors.Is(err, services.ErrTwoFactorCode) {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check code",
+			})
+		}
+		if err := h.userService.RecordFailedLogin(user); err != nil {
+			log.Printf("[AUTH] failed to record failed login for user %d: %v", user.ID, err)
+		}
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := h.userService.ResetFailedLogins(user); err != nil {
+		log.Printf("[AUTH] failed to reset failed logins for user %d: %v", user.ID, err)
+	}
+
+	// Generate JWT token
+	token, err := h.authServices.GenerateToken(user)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	return c.JSON(AuthResponse{
+		Message: "Login successful",
+		Token:   token,
+		User:    user,
+	})
+}
+
+// Verify an email address from the link sent on registration
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	var req struct {
+		Token string `json:"token" query:"token"`
+	}
+	if err := parseRequest(c, &req); err != nil || req.Token == "" {
+		return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+			"error": "token is required",
+		})
+	}
+
+	user, err := h.verificationService.Verify(req.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrVerificationToken) {
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email verified",
+		"user":    user,
+	})
+}
+
 func (h *AuthHandler) GetProfile(c *fiber.Ctx) error {
 	user := c.Locals("user").(*models.User)
 
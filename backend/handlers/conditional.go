@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Parse request params from the query string for GET requests, or from the body otherwise
+func parseRequest(c *fiber.Ctx, out interface{}) error {
+	if c.Method() == fiber.MethodGet {
+		return c.QueryParser(out)
+	}
+	return c.BodyParser(out)
+}
+
+// Responses hold presigned view urls, so cached copies are only revalidated within the window they were
+// built in. A copy that is still current always has most of its url lifetime left.
+const presignWindow = services.ViewURLLifetime / 4
+
+// Build a weak ETag for an event read endpoint, scope separates the different responses for the same event.
+// The viewer and whether they see original photos are part of it, as blurred copies depend on both.
+func eventETag(scope string, eventId uint, updatedAt time.Time, viewerId uint, originals bool, window time.Time) string {
+	return fmt.Sprintf(`W/"%s-%d-%d-%d-%t-%d"`, scope, eventId, updatedAt.UnixNano(), viewerId, originals, window.Unix())
+}
+
+// Set ETag/Last-Modified from the event updated at value and check the conditional request headers.
+// Returns true when a response has already been sent (304, 404 or 500) and the handler should return err.
+func checkEventNotModified(c *fiber.Ctx, eventRepo *db.EventRepo, eventId uint, scope string) (bool, error) {
+	updatedAt, err := eventRepo.FindEventUpdatedAt(eventId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return true, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "event not found",
+			})
+		}
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "error finding event updated at",
+		})
+	}
+
+	// event owners and organization admins are shown originals, everyone else may get blurred copies
+	var viewerId uint
+	if user, ok := c.Locals("user").(*models.User); ok {
+		viewerId = user.ID
+	}
+	originals, err := eventRepo.CheckOwner(viewerId, eventId)
+	if err != nil {
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "error checking event owner",
+		})
+	}
+
+	window := time.Now().Truncate(presignWindow)
+	lastModified := updatedAt
+	if window.After(lastModified) {
+		lastModified = window
+	}
+
+	etag := eventETag(scope, eventId, updatedAt, viewerId, originals, window)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	c.Set(fiber.HeaderCacheControl, "private, no-cache")
+
+	// If-None-Match takes precedence over If-Modified-Since
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		if etagMatches(match, etag) {
+			return true, c.SendStatus(fiber.StatusNotModified)
+		}
+		return false, nil
+	}
+
+	if since := c.Get(fiber.HeaderIfModifiedSince); since != "" {
+		sinceTime, err := http.ParseTime(since)
+		if err == nil && !lastModified.Truncate(time.Second).After(sinceTime) {
+			return true, c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+
+	return false, nil
+}
+
+// Weak comparison of an If-None-Match header against the current ETag
+func etagMatches(header, etag string) bool {
+	current := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == current {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Return the logged in user's face recognition consent settings
+func ReturnConsent(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	events, err := svc.ConsentService.ConsentRepo.FindEventConsents(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to find consent settings",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"opt_out": user.RecognitionOptOut,
+		"events":  events,
+	})
+}
+
+// Opt the logged in user in or out of face recognition in every event
+func SetUserConsent(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		OptOut bool `json:"opt_out"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+
+	if err := svc.ConsentService.SetUserOptOut(c.Context(), user.ID, body.OptOut, auditActor(c)); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"opt_out": body.OptOut,
+	})
+}
+
+// Opt the logged in user in or out of face recognition in one event
+func SetEventConsent(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId uint `json:"event_id"`
+		OptOut  bool `json:"opt_out"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+
+	if err := svc.ConsentService.SetEventOptOut(c.Context(), user.ID, body.EventId, body.OptOut, auditActor(c)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "user is not part of this event",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"event_id": body.EventId,
+		"opt_out":  body.OptOut,
+	})
+}
+
+// Flag an event person as do not recognise - event owner or the user linked to the person
+func SetDoNotRecognize(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		PersonId       uint `json:"person_id"`
+		DoNotRecognize bool `json:"do_not_recognize"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	person, err := svc.EventPersonRepo.FindPerson(body.PersonId)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "person not found",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+	if person.UserID == nil || *person.UserID != user.ID {
+		if done, err := checkEventOwner(c, svc, person.EventID); done {
+			return err
+		}
+	}
+
+	if err := svc.ConsentService.SetDoNotRecognize(c.Context(), person, body.DoNotRecognize, auditActor(c)); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"person_id":        person.ID,
+		"do_not_recognize": body.DoNotRecognize,
+	})
+}
+
+// Change an event's face recognition mode - event owner only
+func SetRecognitionMode(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId uint   `json:"event_id"`
+		Mode    string `json:"mode"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	switch body.Mode {
+	case models.RecognitionAll, models.RecognitionConsent, models.RecognitionOff:
+	default:
+		return c.Status(400).JSON(fiber.Map{
+			"error": "mode must be all, consent or off",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, body.EventId); done {
+		return err
+	}
+
+	if err := svc.ConsentService.SetRecognitionMode(c.Context(), body.EventId, body.Mode, auditActor(c)); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"event_id":         body.EventId,
+		"recognition_mode": body.Mode,
+	})
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/Rynoo1/PicSort/backend/models"
 	"github.com/Rynoo1/PicSort/backend/services"
@@ -17,8 +21,13 @@ func CreateEvent(c *fiber.Ctx, eventRepo *services.AppServices) error {
 
 	// format request body
 	var body struct {
-		EventName string `json:"event_name"`
-		UserIDs   []uint `json:"user_ids"`
+		EventName      string     `json:"event_name"`
+		UserIDs        []uint     `json:"user_ids"`
+		OrganizationId uint       `json:"organization_id"`
+		Description    string     `json:"description"`
+		Location       string     `json:"location"`
+		StartsAt       *time.Time `json:"starts_at"`
+		EndsAt         *time.Time `json:"ends_at"`
 	}
 
 	// parse body
@@ -28,10 +37,36 @@ func CreateEvent(c *fiber.Ctx, eventRepo *services.AppServices) error {
 		})
 	}
 
+	if body.StartsAt != nil && body.EndsAt != nil && body.EndsAt.Before(*body.StartsAt) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": db.ErrEventDates.Error(),
+		})
+	}
+
+	creator := c.Locals("user").(*models.User)
+
+	if done, err := checkVerifiedMembers(c, eventRepo, body.UserIDs); done {
+		return err
+	}
+
 	// convert to model
-	event := models.Event{EventName: body.EventName}
+	event := models.Event{
+		EventName:   body.EventName,
+		Description: body.Description,
+		Location:    body.Location,
+		StartsAt:    body.StartsAt,
+		EndsAt:      body.EndsAt,
+	}
 
-	// DB transaction: create event and add users
+	// events can be created straight into an organization the creator belongs to
+	if body.OrganizationId != 0 {
+		if _, done, err := checkOrgRole(c, eventRepo, body.OrganizationId, false); done {
+			return err
+		}
+		event.OrganizationID = &body.OrganizationId
+	}
+
+	// DB transaction: create event, add users and make the creator the owner
 	err := eventRepo.EventRepo.DB.Transaction(func(tx *gorm.DB) error {
 		txEventRepo := eventRepo.EventRepo.WithTx(tx)
 
@@ -40,12 +75,13 @@ func CreateEvent(c *fiber.Ctx, eventRepo *services.AppServices) error {
 			return err
 		}
 
-		if err := txEventRepo.AddUsersToEvent(body.UserIDs, event.ID); err != nil {
-			return err
+		if len(body.UserIDs) > 0 {
+			if err := txEventRepo.AddUsersToEvent(body.UserIDs, event.ID, auditActor(c)); err != nil {
+				return err
+			}
 		}
 
-		return nil
-
+		return txEventRepo.SetUserRole(creator.ID, event.ID, models.RoleOwner)
 	})
 
 	if err != nil {
@@ -54,10 +90,13 @@ func CreateEvent(c *fiber.Ctx, eventRepo *services.AppServices) error {
 		})
 	}
 
+	// index members' reference selfies so they are recognised in the event's photos
+	go eventRepo.ReferenceService.IndexUsersInEvent(context.Background(), append(body.UserIDs, creator.ID), event.ID)
+
 	return c.Status(201).JSON(event)
 }
 
-// Rename Event
+// Rename Event - superseded by UpdateEvent, kept for older clients
 func RenameEvent(c *fiber.Ctx, repo *services.AppServices) error {
 
 	var body struct {
@@ -70,7 +109,17 @@ func RenameEvent(c *fiber.Ctx, repo *services.AppServices) error {
 		})
 	}
 
-	if err := repo.EventRepo.RenameEvent(body.EventId, body.NewName); err != nil {
+	if body.NewName == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "event name cannot be empty",
+		})
+	}
+
+	if done, err := checkEventOwner(c, repo, body.EventId); done {
+		return err
+	}
+
+	if _, err := repo.EventRepo.UpdateEvent(body.EventId, map[string]interface{}{"event_name": body.NewName}, auditActor(c)); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
 		})
@@ -82,6 +131,96 @@ func RenameEvent(c *fiber.Ctx, repo *services.AppServices) error {
 
 }
 
+// Update event details - event owner only. Only the fields sent are changed,
+// clear lists the fields to unset (starts_at, ends_at, cover_photo_id).
+func UpdateEvent(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId      uint       `json:"event_id"`
+		EventName    *string    `json:"event_name"`
+		Description  *string    `json:"description"`
+		Location     *string    `json:"location"`
+		StartsAt     *time.Time `json:"starts_at"`
+		EndsAt       *time.Time `json:"ends_at"`
+		CoverPhotoId *uint      `json:"cover_photo_id"`
+		Visibility   *string    `json:"visibility"`
+		Clear        []string   `json:"clear"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	changes := make(map[string]interface{})
+	if body.EventName != nil {
+		if *body.EventName == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "event name cannot be empty",
+			})
+		}
+		changes["event_name"] = *body.EventName
+	}
+	if body.Description != nil {
+		changes["description"] = *body.Description
+	}
+	if body.Location != nil {
+		changes["location"] = *body.Location
+	}
+	if body.StartsAt != nil {
+		changes["starts_at"] = body.StartsAt
+	}
+	if body.EndsAt != nil {
+		changes["ends_at"] = body.EndsAt
+	}
+	if body.CoverPhotoId != nil {
+		changes["cover_photo_id"] = body.CoverPhotoId
+	}
+	if body.Visibility != nil {
+		switch *body.Visibility {
+		case models.VisibilityMembers, models.VisibilityOrganization:
+		default:
+			return c.Status(400).JSON(fiber.Map{
+				"error": "visibility must be members or organization",
+			})
+		}
+		changes["visibility"] = *body.Visibility
+	}
+	for _, field := range body.Clear {
+		switch field {
+		case "starts_at", "ends_at", "cover_photo_id":
+			changes[field] = nil
+		default:
+			return c.Status(400).JSON(fiber.Map{
+				"error": "only starts_at, ends_at and cover_photo_id can be cleared",
+			})
+		}
+	}
+
+	if len(changes) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "no changes provided",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, body.EventId); done {
+		return err
+	}
+
+	event, err := svc.EventRepo.UpdateEvent(body.EventId, changes, auditActor(c))
+	if err != nil {
+		if errors.Is(err, db.ErrCoverPhoto) || errors.Is(err, db.ErrEventDates) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(event)
+}
+
 // Check if user can add users to this event, then add users to event
 func AddUsers(c *fiber.Ctx, eventRepo *services.AppServices) error {
 
@@ -106,7 +245,7 @@ func AddUsers(c *fiber.Ctx, eventRepo *services.AppServices) error {
 
 	log.Printf("logged in user: %v", addUser)
 
-	exists, err := eventRepo.EventRepo.CheckUser(addUser.ID, body.EventID)
+	exists, err := eventRepo.EventRepo.CheckAccess(addUser.ID, body.EventID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "an error occured when checking user in event",
@@ -118,12 +257,19 @@ func AddUsers(c *fiber.Ctx, eventRepo *services.AppServices) error {
 		})
 	}
 
-	err = eventRepo.EventRepo.AddUsersToEvent(body.NewUserID, body.EventID)
+	if done, err := checkVerifiedMembers(c, eventRepo, body.NewUserID); done {
+		return err
+	}
+
+	err = eventRepo.EventRepo.AddUsersToEvent(body.NewUserID, body.EventID, auditActor(c))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "failed to add new users to event",
 		})
 	}
+
+	// index new members' reference selfies so they are recognised in the event's photos
+	go eventRepo.ReferenceService.IndexUsersInEvent(context.Background(), body.NewUserID, body.EventID)
 	return c.JSON(fiber.Map{
 		"message": "users added successfully",
 	})
@@ -133,15 +279,22 @@ func AddUsers(c *fiber.Ctx, eventRepo *services.AppServices) error {
 func ReturnAllPeople(c *fiber.Ctx, eventRepo *services.AppServices) error {
 
 	var body struct {
-		EventId uint `json:"event_id"`
+		EventId uint `json:"event_id" query:"event_id"`
 	}
 
-	if err := c.BodyParser(&body); err != nil {
+	if err := parseRequest(c, &body); err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "invalid request",
 		})
 	}
 
+	if done, err := checkEventMember(c, eventRepo, body.EventId); done {
+		return err
+	}
+	if done, err := checkEventNotModified(c, eventRepo.EventRepo, body.EventId, "people"); done {
+		return err
+	}
+
 	people, err := eventRepo.ImageService.EventPersonRepo.ReturnEventPeople(body.EventId)
 	if people == nil && err == nil {
 		return c.Status(404).JSON(fiber.Map{
@@ -156,7 +309,7 @@ func ReturnAllPeople(c *fiber.Ctx, eventRepo *services.AppServices) error {
 	return c.JSON(people)
 }
 
-// Return all events for a specific user
+// Return all events for a specific user, newest event date first, with a presigned cover photo
 func ReturnAllEvents(c *fiber.Ctx, eventRepo *services.AppServices) error {
 	user := c.Locals("user").(*models.User)
 
@@ -171,27 +324,19 @@ func ReturnAllEvents(c *fiber.Ctx, eventRepo *services.AppServices) error {
 
 	for i := range events {
 		ev := &events[i]
-		if len(ev.Images) == 0 {
+		if ev.CoverPhoto == nil {
 			continue
 		}
 
 		g.Go(func() error {
-			keys := make([]string, len(ev.Images))
-			for j, img := range ev.Images {
-				keys[j] = img.StorageKey
-			}
-
-			urls, err := eventRepo.S3Service.GetPresignViewObjects(c.Context(), keys, ev.EventId)
+			urls, err := eventRepo.RenditionService.PresignViewObjects(c.Context(), user.ID, []string{ev.CoverPhoto.StorageKey}, ev.EventId)
 			if err != nil {
 				return err
 			}
 
-			ev.Images = make([]db.ImageResults, len(urls))
-			for j, u := range urls {
-				ev.Images[j] = db.ImageResults{
-					ID:         ev.Images[j].ID,
-					StorageKey: u.URL,
-				}
+			ev.CoverPhoto = &db.ImageResults{
+				ID:         ev.CoverPhoto.ID,
+				StorageKey: urls[0].URL,
 			}
 			return nil
 		})
@@ -210,24 +355,33 @@ func ReturnAllEvents(c *fiber.Ctx, eventRepo *services.AppServices) error {
 func ReturnAllEventPersonImages(c *fiber.Ctx, eventRepo *services.AppServices) error {
 
 	var body struct {
-		EventPersonId uint `json:"event_person_id"`
-		EventId       uint `json:"event_id"`
+		EventPersonId uint `json:"event_person_id" query:"event_person_id"`
+		EventId       uint `json:"event_id" query:"event_id"`
 	}
 
-	if err := c.BodyParser(&body); err != nil {
+	if err := parseRequest(c, &body); err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "invalid request",
 		})
 	}
 
-	imageKeys, err := eventRepo.ImageService.EventPersonRepo.FindPhotoKeysForPerson(body.EventPersonId)
+	scope := fmt.Sprintf("person-%d", body.EventPersonId)
+	if done, err := checkEventMember(c, eventRepo, body.EventId); done {
+		return err
+	}
+	if done, err := checkEventNotModified(c, eventRepo.EventRepo, body.EventId, scope); done {
+		return err
+	}
+
+	imageKeys, err := eventRepo.ImageService.EventPersonRepo.FindPhotoKeysForPerson(body.EventPersonId, body.EventId)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "could not find image keys for that person",
 		})
 	}
 
-	urlObjects, err := eventRepo.S3Service.GetPresignViewObjects(c.Context(), imageKeys, body.EventId)
+	user := c.Locals("user").(*models.User)
+	urlObjects, err := eventRepo.RenditionService.PresignViewObjects(c.Context(), user.ID, imageKeys, body.EventId)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "could not get presign URLs for images",
@@ -240,23 +394,33 @@ func ReturnAllEventPersonImages(c *fiber.Ctx, eventRepo *services.AppServices) e
 // Return all images and people for an event
 func ReturnEventData(c *fiber.Ctx, eventRepo *services.AppServices) error {
 	var body struct {
-		EventId uint `json:"event_id"`
+		EventId uint `json:"event_id" query:"event_id"`
 	}
 
-	if err := c.BodyParser(&body); err != nil {
+	if err := parseRequest(c, &body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "invalid request",
 		})
 	}
 
+	if done, err := checkEventMember(c, eventRepo, body.EventId); done {
+		return err
+	}
+	if done, err := checkEventNotModified(c, eventRepo.EventRepo, body.EventId, "data"); done {
+		return err
+	}
+
+	user := c.Locals("user").(*models.User)
+
 	var (
-		people     []db.ReturnPeople
-		imageKeys  []db.EventImages
-		err1, err2 error
-		wg         sync.WaitGroup
+		people           []db.ReturnPeople
+		imageKeys        []db.EventImages
+		counts           map[uint]*db.PhotoCounts
+		err1, err2, err3 error
+		wg               sync.WaitGroup
 	)
 
-	wg.Add(2)
+	wg.Add(3)
 
 	go func() {
 		defer wg.Done()
@@ -268,6 +432,11 @@ func ReturnEventData(c *fiber.Ctx, eventRepo *services.AppServices) error {
 		imageKeys, err2 = eventRepo.ImageService.ImageRepo.FindAllEventImages(body.EventId)
 	}()
 
+	go func() {
+		defer wg.Done()
+		counts, err3 = eventRepo.InteractionService.InteractionRepo.FindEventCounts(body.EventId, user.ID)
+	}()
+
 	wg.Wait()
 
 	if err1 != nil {
@@ -282,6 +451,12 @@ func ReturnEventData(c *fiber.Ctx, eventRepo *services.AppServices) error {
 		})
 	}
 
+	if err3 != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to find photo feedback",
+		})
+	}
+
 	type urlResult struct {
 		ID     uint
 		URL    string
@@ -289,11 +464,24 @@ func ReturnEventData(c *fiber.Ctx, eventRepo *services.AppServices) error {
 		Err    error
 	}
 
+	// photos showing opted out people are served blurred unless the viewer uploaded them or owns the event
+	storageKeys := make([]string, len(imageKeys))
+	for i, img := range imageKeys {
+		storageKeys[i] = img.StorageKey
+	}
+	viewKeys, err := eventRepo.RenditionService.ViewKeys(user.ID, storageKeys)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to find event images",
+		})
+	}
+
 	urlCh := make(chan urlResult, len(imageKeys))
-	for _, img := range imageKeys {
+	for i, img := range imageKeys {
 		img := img
+		viewKey := viewKeys[i]
 		go func() {
-			urlObj, err := eventRepo.S3Service.GetPresignViewObjects(c.Context(), []string{img.StorageKey}, body.EventId)
+			urlObj, err := eventRepo.S3Service.GetPresignViewObjects(c.Context(), []string{viewKey}, body.EventId)
 			if err != nil {
 				urlCh <- urlResult{ID: img.ID, URL: "", Expire: "", Err: err}
 				return
@@ -317,11 +505,21 @@ func ReturnEventData(c *fiber.Ctx, eventRepo *services.AppServices) error {
 			}
 		}
 
+		feedback := counts[res.ID]
+		if feedback == nil {
+			feedback = &db.PhotoCounts{Reactions: map[string]int64{}, MyReactions: []string{}}
+		}
+
 		urlObjects = append(urlObjects, map[string]interface{}{
 			"id":           res.ID,
 			"url":          res.URL,
 			"expires":      res.Expire,
 			"image_people": matchedImage.EventPeople,
+			"favorites":    feedback.Favorites,
+			"favorited":    feedback.Favorited,
+			"reactions":    feedback.Reactions,
+			"my_reactions": feedback.MyReactions,
+			"comments":     feedback.Comments,
 		})
 	}
 
@@ -335,15 +533,22 @@ func ReturnEventData(c *fiber.Ctx, eventRepo *services.AppServices) error {
 // Return Event meta data
 func ReturnMeta(c *fiber.Ctx, eventRepo *services.AppServices) error {
 	var body struct {
-		EventId uint `json:"event_id"`
+		EventId uint `json:"event_id" query:"event_id"`
 	}
 
-	if err := c.BodyParser(&body); err != nil {
+	if err := parseRequest(c, &body); err != nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "invalid request body",
 		})
 	}
 
+	if done, err := checkEventMember(c, eventRepo, body.EventId); done {
+		return err
+	}
+	if done, err := checkEventNotModified(c, eventRepo.EventRepo, body.EventId, "meta"); done {
+		return err
+	}
+
 	meta, err := eventRepo.EventRepo.FindEventMeta(body.EventId)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
@@ -356,7 +561,7 @@ func ReturnMeta(c *fiber.Ctx, eventRepo *services.AppServices) error {
 	})
 }
 
-// Delete event
+// Delete event, event owner only
 func DeleteEvent(c *fiber.Ctx, eventRepo *services.AppServices) error {
 	var body struct {
 		EventID uint `json:"event_id"`
@@ -368,7 +573,11 @@ func DeleteEvent(c *fiber.Ctx, eventRepo *services.AppServices) error {
 		})
 	}
 
-	if err := eventRepo.EventService.DeleteEvent(c.Context(), body.EventID); err != nil {
+	if done, err := checkEventOwner(c, eventRepo, body.EventID); done {
+		return err
+	}
+
+	if err := eventRepo.EventService.DeleteEvent(c.Context(), body.EventID, auditActor(c)); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "error deleting event",
 		})
@@ -378,3 +587,43 @@ func DeleteEvent(c *fiber.Ctx, eventRepo *services.AppServices) error {
 		"sucess": "event successfully deleted",
 	})
 }
+
+// Return a page of an event's audit history, event owner only
+func ReturnEventHistory(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId  uint `json:"event_id"`
+		BeforeId uint `json:"before_id"` // cursor from the previous page
+		Limit    int  `json:"limit"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, body.EventId); done {
+		return err
+	}
+
+	if body.Limit <= 0 || body.Limit > 100 {
+		body.Limit = 50
+	}
+
+	entries, err := svc.AuditRepo.FindEventHistory(body.EventId, body.BeforeId, body.Limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to find event history",
+		})
+	}
+
+	var nextBeforeId *uint
+	if len(entries) == body.Limit {
+		nextBeforeId = &entries[len(entries)-1].ID
+	}
+
+	return c.JSON(fiber.Map{
+		"entries":        entries,
+		"next_before_id": nextBeforeId,
+	})
+}
@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/Rynoo1/PicSort/backend/models"
 	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/Rynoo1/PicSort/backend/services/db"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -17,7 +22,7 @@ func UpdatePersonName(c *fiber.Ctx, eventRepo *services.AppServices) error {
 		})
 	}
 
-	err := eventRepo.EventPersonRepo.UpdatePersonName(body.PersonId, body.NewName)
+	err := eventRepo.EventPersonRepo.UpdatePersonName(body.PersonId, body.NewName, auditActor(c))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "error updating persons name",
@@ -29,3 +34,242 @@ func UpdatePersonName(c *fiber.Ctx, eventRepo *services.AppServices) error {
 	})
 
 }
+
+// Most people that can be included or excluded in one co-occurrence search
+const maxQueryPeople = 20
+
+// Return photos showing all of the included people and none of the excluded ones
+func SearchPeoplePhotos(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId   uint   `json:"event_id"`
+		Include   []uint `json:"include"`
+		Exclude   []uint `json:"exclude"`
+		FaceCount *int   `json:"face_count"`
+		MinFaces  int    `json:"min_faces"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if body.EventId == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "event_id is required",
+		})
+	}
+	if len(body.Include)+len(body.Exclude) > maxQueryPeople {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("at most %d people can be searched at once", maxQueryPeople),
+		})
+	}
+	if (body.FaceCount != nil && *body.FaceCount < 0) || body.MinFaces < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "face counts cannot be negative",
+		})
+	}
+
+	included := make(map[uint]bool, len(body.Include))
+	for _, id := range body.Include {
+		included[id] = true
+	}
+	for _, id := range body.Exclude {
+		if included[id] {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "a person cannot be both included and excluded",
+			})
+		}
+	}
+
+	if done, err := checkEventMember(c, svc, body.EventId); done {
+		return err
+	}
+
+	photos, err := svc.EventPersonRepo.FindPhotosWithPeople(db.PeopleQuery{
+		EventID:   body.EventId,
+		Include:   body.Include,
+		Exclude:   body.Exclude,
+		FaceCount: body.FaceCount,
+		MinFaces:  body.MinFaces,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "could not search photos",
+		})
+	}
+
+	keys := make([]string, len(photos))
+	for i, photo := range photos {
+		keys[i] = photo.StorageKey
+	}
+
+	user := c.Locals("user").(*models.User)
+	urlObjects, err := svc.RenditionService.PresignViewObjects(c.Context(), user.ID, keys, body.EventId)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "could not get presign URLs for images",
+		})
+	}
+
+	images := make([]fiber.Map, len(photos))
+	for i, photo := range photos {
+		images[i] = fiber.Map{
+			"id":         photo.ID,
+			"url":        urlObjects[i].URL,
+			"expires":    urlObjects[i].ExpiresAt,
+			"face_count": photo.FaceCount,
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"event_id": body.EventId,
+		"images":   images,
+	})
+}
+
+// Link the logged in user to an event person ("this is me")
+func ClaimPerson(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		PersonId uint `json:"person_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	person, err := svc.EventPersonRepo.FindPerson(body.PersonId)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "person not found",
+		})
+	}
+
+	if done, err := checkEventMember(c, svc, person.EventID); done {
+		return err
+	}
+
+	user := c.Locals("user").(*models.User)
+	if err := svc.EventPersonRepo.LinkUser(person.ID, &user.ID, true, auditActor(c)); err != nil {
+		return linkError(c, err)
+	}
+
+	// users who opted out of recognition are not recognised as their person either
+	if err := svc.ConsentService.ApplyOptOut(c.Context(), user.ID, person, auditActor(c)); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": "person claimed",
+	})
+}
+
+// Link an event person to a member of the event, or unlink them when user_id is 0 - event owner only
+func AssignPerson(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		PersonId uint `json:"person_id"`
+		UserId   uint `json:"user_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	person, err := svc.EventPersonRepo.FindPerson(body.PersonId)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "person not found",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, person.EventID); done {
+		return err
+	}
+
+	var userId *uint
+	if body.UserId != 0 {
+		exists, err := svc.EventRepo.CheckUser(body.UserId, person.EventID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "an error occured when checking user in event",
+			})
+		}
+		if !exists {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "user is not part of this event",
+			})
+		}
+		userId = &body.UserId
+	}
+
+	if err := svc.EventPersonRepo.LinkUser(person.ID, userId, false, auditActor(c)); err != nil {
+		return linkError(c, err)
+	}
+
+	if userId != nil {
+		if err := svc.ConsentService.ApplyOptOut(c.Context(), *userId, person, auditActor(c)); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": "person assigned",
+	})
+}
+
+func linkError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, db.ErrPersonClaimed) || errors.Is(err, db.ErrUserLinked) {
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(500).JSON(fiber.Map{
+		"error": "error linking person",
+	})
+}
+
+// Return presign URLs for every photo of the logged in user across all their events
+func MyPhotos(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	photos, err := svc.ImageService.ImageRepo.FindUserPhotos(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "could not find photos",
+		})
+	}
+
+	keys := make([]string, len(photos))
+	for i, photo := range photos {
+		keys[i] = photo.StorageKey
+	}
+
+	urlObjects, err := svc.RenditionService.PresignViewObjects(c.Context(), user.ID, keys, 0)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "could not get presign URLs for images",
+		})
+	}
+
+	images := make([]fiber.Map, len(photos))
+	for i, photo := range photos {
+		images[i] = fiber.Map{
+			"id":       photo.ID,
+			"event_id": photo.EventID,
+			"url":      urlObjects[i].URL,
+			"expires":  urlObjects[i].ExpiresAt,
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"images": images,
+	})
+}
@@ -5,16 +5,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/Rynoo1/PicSort/backend/models"
 	"github.com/Rynoo1/PicSort/backend/services"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
-type SearchPerson struct {
-	ID   uint   `json:"id"`
-	Name string `json:"name"`
-}
-
 // Process single image
 func ImageProcessing(c *fiber.Ctx, repo *services.ImageService) error {
 	// body format struct
@@ -43,10 +42,9 @@ func ImageProcessing(c *fiber.Ctx, repo *services.ImageService) error {
 }
 
 // Process multiple images
-func ImageProcessingBatch(c *fiber.Ctx, repo *services.ImageService) error {
+func ImageProcessingBatch(c *fiber.Ctx, svc *services.AppServices) error {
 	var body struct {
 		StorageKeys []string `json:"storage_keys"`
-		UploadedBy  uint     `json:"uploaded_by"`
 		EventId     uint     `json:"event_id"`
 	}
 
@@ -56,7 +54,49 @@ func ImageProcessingBatch(c *fiber.Ctx, repo *services.ImageService) error {
 		})
 	}
 
-	_, errs := repo.BatchImageProcessing(c.Context(), body.StorageKeys, body.UploadedBy, body.EventId)
+	if len(body.StorageKeys) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "no storage keys provided",
+		})
+	}
+
+	if done, err := checkEventMember(c, svc, body.EventId); done {
+		return err
+	}
+
+	// only keys presigned for this event can be processed into it
+	prefix := services.EventUploadPrefix(body.EventId)
+	for _, key := range body.StorageKeys {
+		if !strings.HasPrefix(key, prefix) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "storage keys must belong to the event",
+			})
+		}
+	}
+
+	// uploads are charged by their stored size, not the size the client reported when presigning
+	bucketName := os.Getenv("BUCKET_NAME")
+	totalBytes, err := svc.S3Service.ObjectsSize(c.Context(), bucketName, body.StorageKeys)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "uploaded file not found",
+		})
+	}
+
+	// photos and face API calls are counted against the logged in user
+	user := c.Locals("user").(*models.User)
+
+	if err := svc.QuotaService.CheckProcessing(user, body.EventId, len(body.StorageKeys), totalBytes); err != nil {
+		// refused uploads would otherwise sit in the bucket uncounted
+		for _, key := range body.StorageKeys {
+			if err := svc.S3Service.DeleteFile(c.Context(), bucketName, key); err != nil {
+				log.Printf("[WARN] failed to delete refused upload %s: %v", key, err)
+			}
+		}
+		return quotaError(c, err)
+	}
+
+	_, errs := svc.ImageService.BatchImageProcessing(c.Context(), body.StorageKeys, user.ID, body.EventId)
 	if len(errs) > 0 {
 		return c.Status(500).JSON(fiber.Map{
 			"errors": errs,
@@ -68,11 +108,10 @@ func ImageProcessingBatch(c *fiber.Ctx, repo *services.ImageService) error {
 	})
 }
 
-// upload image for searching
-func GetSearchUpload(c *fiber.Ctx, repo *services.S3Service) error {
+// upload image for searching, event_id is left out for find me searches across every event
+func GetSearchUpload(c *fiber.Ctx, svc *services.AppServices) error {
 	var body struct {
 		EventId     uint   `json:"event_id"`
-		Filename    string `json:"filename"`
 		ContentType string `json:"content_type"`
 	}
 	if err := c.BodyParser(&body); err != nil {
@@ -81,20 +120,29 @@ func GetSearchUpload(c *fiber.Ctx, repo *services.S3Service) error {
 		})
 	}
 
-	allowed := map[string]bool{
-		"image/jpeg": true,
-		"image/png":  true,
+	extensions := map[string]string{
+		"image/jpeg": ".jpg",
+		"image/png":  ".png",
 	}
-	if !allowed[body.ContentType] {
+	extension, ok := extensions[body.ContentType]
+	if !ok {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "unsupported file type",
 		})
 	}
 
-	objectKey := fmt.Sprintf("search/%d/%s", body.EventId, body.Filename)
+	if body.EventId != 0 {
+		if done, err := checkEventMember(c, svc, body.EventId); done {
+			return err
+		}
+	}
+
+	// the key is generated here and tied to the user, searches only read and delete keys under it
+	user := c.Locals("user").(*models.User)
+	objectKey := services.SearchPrefix(user.ID) + uuid.NewString() + extension
 	bucketName := os.Getenv("BUCKET_NAME")
 
-	url, err := repo.PresignPutObject(c.Context(), bucketName, objectKey, body.ContentType, 120)
+	url, err := svc.S3Service.PresignPutObject(c.Context(), bucketName, objectKey, body.ContentType, 120)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
@@ -107,12 +155,15 @@ func GetSearchUpload(c *fiber.Ctx, repo *services.S3Service) error {
 	})
 }
 
-// Search Collection for matching faces/event_people
-func SearchCollection(c *fiber.Ctx, repo *services.ImageService) error {
+// Search Collection for matching faces/event_people, returns the best match and every candidate ranked by similarity
+func SearchCollection(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
 
 	var body struct {
-		StorageKey string `json:"storage_key"`
-		EventId    uint   `json:"event_id"`
+		StorageKey string   `json:"storage_key"`
+		EventId    uint     `json:"event_id"`
+		Threshold  *float32 `json:"threshold"` // optional minimum similarity, 0-100
+		Mode       string   `json:"mode"`      // single (default) or group
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -120,7 +171,33 @@ func SearchCollection(c *fiber.Ctx, repo *services.ImageService) error {
 			"error": "invalid request",
 		})
 	}
+	if body.Mode != "" && body.Mode != "single" && body.Mode != "group" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "mode must be single or group",
+		})
+	}
+
+	threshold := services.DefaultSearchThreshold
+	if body.Threshold != nil {
+		if *body.Threshold < 0 || *body.Threshold > 100 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "threshold must be between 0 and 100",
+			})
+		}
+		threshold = *body.Threshold
+	}
+
+	if !strings.HasPrefix(body.StorageKey, services.SearchPrefix(user.ID)) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": services.ErrSearchKey.Error(),
+		})
+	}
+
+	if done, err := checkEventMember(c, svc, body.EventId); done {
+		return err
+	}
 
+	repo := svc.ImageService
 	bucketName := os.Getenv("BUCKET_NAME")
 
 	defer func() {
@@ -129,14 +206,28 @@ func SearchCollection(c *fiber.Ctx, repo *services.ImageService) error {
 		}
 	}()
 
+	// identify every face in a group photo, unmatched faces come back as unknown
+	if body.Mode == "group" {
+		faces, err := repo.IdentifyFaces(c.Context(), body.StorageKey, body.EventId, user.ID, threshold)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.JSON(fiber.Map{
+			"faces": faces,
+		})
+	}
+
 	// find matching faces in the event collection
-	matchingId, err := repo.FindFace(c.Context(), body.StorageKey, body.EventId)
+	candidates, err := repo.FindCandidates(c.Context(), body.StorageKey, body.EventId, user.ID, threshold)
 	if err != nil {
 		if errors.Is(err, services.ErrNoFaceMatch) {
 			return c.JSON(fiber.Map{
-				"message": "no matching person found",
-				"id":      nil,
-				"name":    nil,
+				"message":    "no matching person found",
+				"id":         nil,
+				"name":       nil,
+				"candidates": []services.FaceCandidate{},
 			})
 		}
 		return c.Status(500).JSON(fiber.Map{
@@ -144,30 +235,81 @@ func SearchCollection(c *fiber.Ctx, repo *services.ImageService) error {
 		})
 	}
 
-	// find event person name
-	personName, err := repo.EventPersonRepo.FindNameById(matchingId)
+	return c.JSON(fiber.Map{
+		"id":         candidates[0].PersonID,
+		"name":       candidates[0].Name,
+		"candidates": candidates,
+	})
+}
+
+// Search every event the user belongs to for the face in a selfie
+func FindMe(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	var body struct {
+		StorageKey string   `json:"storage_key"`
+		Threshold  *float32 `json:"threshold"` // optional minimum similarity, 0-100
+	}
+
+	if err := c.BodyParser(&body); err != nil || body.StorageKey == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	threshold := services.DefaultSearchThreshold
+	if body.Threshold != nil {
+		if *body.Threshold < 0 || *body.Threshold > 100 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "threshold must be between 0 and 100",
+			})
+		}
+		threshold = *body.Threshold
+	}
+
+	if !strings.HasPrefix(body.StorageKey, services.SearchPrefix(user.ID)) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": services.ErrSearchKey.Error(),
+		})
+	}
+
+	bucketName := os.Getenv("BUCKET_NAME")
+
+	defer func() {
+		if err := svc.S3Service.DeleteFile(c.Context(), bucketName, body.StorageKey); err != nil {
+			log.Printf("[WARN] failed to delete search image %s: %v", body.StorageKey, err)
+		}
+	}()
+
+	events, err := svc.EventRepo.FindUserEvents(user.ID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
-			"error": err.Error(),
+			"error": "failed to find user events",
 		})
 	}
 
-	out := SearchPerson{
-		ID:   matchingId,
-		Name: personName,
+	matches, err := svc.ImageService.FindMe(c.Context(), body.StorageKey, events, user.ID, threshold)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
 	}
 
-	return c.JSON(out)
+	return c.JSON(fiber.Map{
+		"searched": len(events),
+		"events":   matches,
+	})
 }
 
 // Generate presign URLs to upload images
-func GenerateUploadURLs(c *fiber.Ctx, repo *services.S3Service) error {
+func GenerateUploadURLs(c *fiber.Ctx, svc *services.AppServices, maxFiles int) error {
 	var req struct {
 		Files []struct {
 			Filename    string `json:"filename"`
 			ContentType string `json:"content_type"`
+			Size        int64  `json:"size"` // optional, signed into the upload url and checked early against storage quotas
 		} `json:"files"`
-		Prefix string `json:"prefix"`
+		Prefix string `json:"prefix"` // event id
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -181,16 +323,52 @@ func GenerateUploadURLs(c *fiber.Ctx, repo *services.S3Service) error {
 			"error": "no files provided",
 		})
 	}
+	if maxFiles > 0 && len(req.Files) > maxFiles {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("too many files, at most %d can be uploaded at once", maxFiles),
+		})
+	}
 	if req.Prefix == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "prefix is required",
 		})
 	}
 
-	uploads, err := repo.GetPresignedUploadURLs(c.Context(), []struct {
+	eventId, err := strconv.ParseUint(req.Prefix, 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "prefix must be an event id",
+		})
+	}
+
+	if done, err := checkEventMember(c, svc, uint(eventId)); done {
+		return err
+	}
+
+	files := make([]struct {
 		Filename    string
 		ContentType string
-	}(req.Files), req.Prefix)
+		Size        int64
+	}, len(req.Files))
+	var totalBytes int64
+	for i, file := range req.Files {
+		if file.Size < 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "file size must not be negative",
+			})
+		}
+		files[i].Filename = file.Filename
+		files[i].ContentType = file.ContentType
+		files[i].Size = file.Size
+		totalBytes += file.Size
+	}
+
+	user := c.Locals("user").(*models.User)
+	if err := svc.QuotaService.CheckUpload(user, uint(eventId), len(req.Files), totalBytes); err != nil {
+		return quotaError(c, err)
+	}
+
+	uploads, err := svc.S3Service.GetPresignedUploadURLs(c.Context(), files, strconv.FormatUint(eventId, 10))
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
@@ -202,7 +380,7 @@ func GenerateUploadURLs(c *fiber.Ctx, repo *services.S3Service) error {
 	})
 }
 
-// Delete image
+// Delete image - the uploader or an event owner
 func DeletePhoto(c *fiber.Ctx, repo *services.AppServices) error {
 
 	var body struct {
@@ -215,7 +393,27 @@ func DeletePhoto(c *fiber.Ctx, repo *services.AppServices) error {
 		})
 	}
 
-	if err := repo.ImageService.DeletePhoto(c.Context(), body.PhotoId); err != nil {
+	photo, done, err := checkPhoto(c, repo, body.PhotoId)
+	if done {
+		return err
+	}
+
+	user := c.Locals("user").(*models.User)
+	if photo.UploadedBy != user.ID {
+		owner, err := repo.EventRepo.CheckOwner(user.ID, photo.EventID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "an error occured when checking event owner",
+			})
+		}
+		if !owner {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "only the uploader or an event owner can delete this photo",
+			})
+		}
+	}
+
+	if err := repo.ImageService.DeletePhoto(c.Context(), photo.ID, auditActor(c)); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": err.Error(),
 		})
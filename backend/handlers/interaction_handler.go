@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Map interaction service errors to responses
+func interactionError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrReactionEmoji), errors.Is(err, services.ErrCommentBody), errors.Is(err, services.ErrCommentParent):
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrCommentForbidden):
+		return c.Status(403).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(500).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
+// Add a photo to the user's favorites - event members
+func FavoritePhoto(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		PhotoId uint `json:"photo_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	photo, done, err := checkPhoto(c, svc, body.PhotoId)
+	if done {
+		return err
+	}
+
+	user := c.Locals("user").(*models.User)
+	if err := svc.InteractionService.Favorite(c.Context(), user, photo); err != nil {
+		return interactionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "photo favorited",
+	})
+}
+
+// Remove a photo from the user's favorites - event members
+func UnfavoritePhoto(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		PhotoId uint `json:"photo_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	photo, done, err := checkPhoto(c, svc, body.PhotoId)
+	if done {
+		return err
+	}
+
+	user := c.Locals("user").(*models.User)
+	if err := svc.InteractionService.Unfavorite(c.Context(), user, photo); err != nil {
+		return interactionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "photo removed from favorites",
+	})
+}
+
+// React to a photo with an emoji - event members
+func ReactToPhoto(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		PhotoId uint   `json:"photo_id"`
+		Emoji   string `json:"emoji"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	photo, done, err := checkPhoto(c, svc, body.PhotoId)
+	if done {
+		return err
+	}
+
+	user := c.Locals("user").(*models.User)
+	if err := svc.InteractionService.React(c.Context(), user, photo, body.Emoji); err != nil {
+		return interactionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "reaction added",
+	})
+}
+
+// Remove one of the user's reactions from a photo - event members
+func UnreactToPhoto(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		PhotoId uint   `json:"photo_id"`
+		Emoji   string `json:"emoji"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	photo, done, err := checkPhoto(c, svc, body.PhotoId)
+	if done {
+		return err
+	}
+
+	user := c.Locals("user").(*models.User)
+	if err := svc.InteractionService.Unreact(c.Context(), user, photo, body.Emoji); err != nil {
+		return interactionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "reaction removed",
+	})
+}
+
+// Comment on a photo, or reply to one of its comments - event members
+func CommentOnPhoto(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		PhotoId  uint   `json:"photo_id"`
+		Body     string `json:"body"`
+		ParentId *uint  `json:"parent_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	photo, done, err := checkPhoto(c, svc, body.PhotoId)
+	if done {
+		return err
+	}
+
+	user := c.Locals("user").(*models.User)
+	comment, err := svc.InteractionService.Comment(c.Context(), user, photo, body.Body, body.ParentId)
+	if err != nil {
+		return interactionError(c, err)
+	}
+
+	return c.Status(201).JSON(comment)
+}
+
+// Return a photo's comments oldest first - event members
+func ReturnPhotoComments(c *fiber.Ctx, svc *services.AppServices) error {
+	var req struct {
+		PhotoId uint `json:"photo_id" query:"photo_id"`
+	}
+	if err := parseRequest(c, &req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	photo, done, err := checkPhoto(c, svc, req.PhotoId)
+	if done {
+		return err
+	}
+
+	comments, err := svc.InteractionService.InteractionRepo.FindComments(photo.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "could not find comments",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"photo_id": photo.ID,
+		"comments": comments,
+	})
+}
+
+// Delete a comment and its replies - the author or an event owner
+func DeletePhotoComment(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		CommentId uint `json:"comment_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	comment, err := svc.InteractionService.InteractionRepo.FindComment(body.CommentId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "comment not found",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when finding comment",
+		})
+	}
+
+	photo, done, err := checkPhoto(c, svc, comment.PhotoID)
+	if done {
+		return err
+	}
+
+	user := c.Locals("user").(*models.User)
+	owner, err := svc.EventRepo.CheckOwner(user.ID, photo.EventID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when checking event owner",
+		})
+	}
+
+	if err := svc.InteractionService.DeleteComment(c.Context(), user, photo, comment, owner); err != nil {
+		return interactionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "comment deleted",
+	})
+}
+
+// Return the user's favorite photos across every event they can access, newest favorite first
+func MyFavorites(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	photos, err := svc.InteractionService.InteractionRepo.FindUserFavorites(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "could not find favorites",
+		})
+	}
+
+	keys := make([]string, len(photos))
+	for i, photo := range photos {
+		keys[i] = photo.StorageKey
+	}
+
+	urlObjects, err := svc.RenditionService.PresignViewObjects(c.Context(), user.ID, keys, 0)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "could not get presign URLs for images",
+		})
+	}
+
+	images := make([]fiber.Map, len(photos))
+	for i, photo := range photos {
+		images[i] = fiber.Map{
+			"id":       photo.ID,
+			"event_id": photo.EventID,
+			"url":      urlObjects[i].URL,
+			"expires":  urlObjects[i].ExpiresAt,
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"images": images,
+	})
+}
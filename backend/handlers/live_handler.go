@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/Rynoo1/PicSort/backend/services/pubsub"
+	"github.com/gofiber/fiber/v2"
+)
+
+// How often a comment is sent to keep the stream open and detect closed connections
+const liveHeartbeat = 25 * time.Second
+
+// Stream live updates for an event as Server-Sent Events
+func SubscribeEvent(c *fiber.Ctx, svc *services.AppServices) error {
+	var query struct {
+		EventId uint `query:"event_id"`
+	}
+
+	if err := c.QueryParser(&query); err != nil || query.EventId == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "event_id is required",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+
+	exists, err := svc.EventRepo.CheckAccess(user.ID, query.EventId)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when checking user in event",
+		})
+	}
+	if !exists {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "user is not part of this event",
+		})
+	}
+
+	// subscription outlives the handler, it is cancelled once the client disconnects
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := svc.Broker.Subscribe(ctx, query.EventId)
+	if err != nil {
+		cancel()
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to subscribe to event updates",
+		})
+	}
+
+	return streamMessages(c, updates, cancel, fmt.Sprintf("{\"event_id\":%d}", query.EventId))
+}
+
+// Write messages to the client as Server-Sent Events until it disconnects, then cancel the subscription.
+// hello is sent as the data of the first "subscribed" event.
+func streamMessages(c *fiber.Ctx, updates <-chan pubsub.Message, cancel context.CancelFunc, hello string) error {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+
+		fmt.Fprintf(w, "event: subscribed\ndata: %s\n\n", hello)
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(liveHeartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case msg, ok := <-updates:
+				if !ok {
+					return
+				}
+				payload, err := json.Marshal(msg)
+				if err != nil {
+					log.Printf("[SSE] failed to encode %s: %v", msg.Type, err)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, payload)
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+
+			// a failed flush means the client has gone away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
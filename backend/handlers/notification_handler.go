@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Most notifications returned at once
+const notificationPageSize = 50
+
+// Return the logged in user's most recent notifications
+func ReturnNotifications(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		UnreadOnly bool `json:"unread_only" query:"unread_only"`
+	}
+
+	if err := parseRequest(c, &body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+
+	notifications, err := svc.NotificationRepo.FindUserNotifications(user.ID, body.UnreadOnly, notificationPageSize)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to find notifications",
+		})
+	}
+
+	return c.JSON(notifications)
+}
+
+// Mark notifications as read, all of them if no ids are given
+func MarkNotificationsRead(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		Ids []uint `json:"ids"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+
+	if err := svc.NotificationRepo.MarkRead(user.ID, body.Ids); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to mark notifications as read",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": "notifications marked as read",
+	})
+}
+
+// Stream the logged in user's new notifications as Server-Sent Events
+func SubscribeNotifications(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	// subscription outlives the handler, it is cancelled once the client disconnects
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := svc.Broker.SubscribeUser(ctx, user.ID)
+	if err != nil {
+		cancel()
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to subscribe to notifications",
+		})
+	}
+
+	return streamMessages(c, updates, cancel, fmt.Sprintf("{\"user_id\":%d}", user.ID))
+}
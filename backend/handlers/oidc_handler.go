@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// List the external login providers that are set up
+func (h *AuthHandler) OIDCProviders(c *fiber.Ctx) error {
+	names := make([]string, 0, len(h.oidcService.Providers))
+	for name := range h.oidcService.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return c.JSON(fiber.Map{
+		"providers": names,
+	})
+}
+
+// Redirect to a provider's login page
+func (h *AuthHandler) OIDCStart(c *fiber.Ctx) error {
+	authURL, err := h.oidcService.Start(c.Context(), c.Params("provider"), c.Query("login_hint"))
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownProvider) {
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, services.ErrProviderResponse) {
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start login",
+		})
+	}
+
+	return c.Redirect(authURL, http.StatusFound)
+}
+
+// Finish a provider login and issue a JWT token or two-factor challenge, redirecting to the app when OIDC_APP_REDIRECT is set
+func (h *AuthHandler) OIDCCallback(c *fiber.Ctx) error {
+	if providerErr := c.Query("error"); providerErr != "" {
+		return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+			"error": "login was not completed: " + providerErr,
+		})
+	}
+
+	user, err := h.oidcService.Finish(c.Context(), c.Params("provider"), c.Query("state"), c.Query("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownProvider):
+			return c.Status(http.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrLoginState), errors.Is(err, services.ErrProviderEmail):
+			return c.Status(http.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrLinkUnverified):
+			return c.Status(http.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, services.ErrProviderResponse):
+			return c.Status(http.StatusBadGateway).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.Printf("[AUTH] provider login failed: %v", err)
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to log in",
+		})
+	}
+
+	// Users with two-factor authentication complete the login with a code, as after a password
+	if user.TOTPEnabled {
+		challenge, err := h.twoFactorService.Challenge(user)
+		if err != nil {
+			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate token",
+			})
+		}
+		if h.oidcService.AppRedirect != "" {
+			return c.Redirect(h.oidcService.AppRedirect+"#challenge_token="+url.QueryEscape(challenge), http.StatusFound)
+		}
+		return c.JSON(ChallengeResponse{
+			Message:           "Two-factor code required",
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+		})
+	}
+
+	// Generate JWT token
+	token, err := h.authServices.GenerateToken(user)
+	if err != nil {
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	// the token goes in the fragment so it is not sent to servers or written to access logs
+	if h.oidcService.AppRedirect != "" {
+		return c.Redirect(h.oidcService.AppRedirect+"#token="+url.QueryEscape(token), http.StatusFound)
+	}
+
+	return c.JSON(AuthResponse{
+		Message: "Login successful",
+		Token:   token,
+		User:    user,
+	})
+}
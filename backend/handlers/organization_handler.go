@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Respond to a refused organization change, 403 for role rules, 400 for bad input
+func organizationError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrOrgForbidden), errors.Is(err, services.ErrOrgLastOwner):
+		return c.Status(403).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, services.ErrOrgName), errors.Is(err, services.ErrOrgRole), errors.Is(err, services.ErrOrgMember):
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(500).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
+// Create an organization, the logged in user becomes its owner
+func CreateOrganization(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+	user := c.Locals("user").(*models.User)
+
+	org, err := svc.OrganizationService.Create(user, body.Name)
+	if err != nil {
+		return organizationError(c, err)
+	}
+
+	return c.Status(201).JSON(org)
+}
+
+// Return the organizations the logged in user belongs to and their role in each
+func ReturnOrganizations(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	orgs, err := svc.OrganizationService.OrganizationRepo.FindUserOrganizations(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(orgs)
+}
+
+// Return an organization's members and their roles
+func ReturnOrgMembers(c *fiber.Ctx, svc *services.AppServices) error {
+	var req struct {
+		OrganizationId uint `json:"organization_id" query:"organization_id"`
+	}
+	if err := parseRequest(c, &req); err != nil || req.OrganizationId == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "organization_id is required",
+		})
+	}
+
+	if _, done, err := checkOrgRole(c, svc, req.OrganizationId, false); done {
+		return err
+	}
+
+	members, err := svc.OrganizationService.OrganizationRepo.FindMembers(req.OrganizationId)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(members)
+}
+
+// Add users to an organization, role defaults to member
+func AddOrgMembers(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		OrganizationId uint   `json:"organization_id"`
+		UserIDs        []uint `json:"user_ids"`
+		Role           string `json:"role"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+	if body.Role == "" {
+		body.Role = models.OrgRoleMember
+	}
+
+	role, done, err := checkOrgRole(c, svc, body.OrganizationId, true)
+	if done {
+		return err
+	}
+
+	if err := svc.OrganizationService.AddMembers(role, body.OrganizationId, body.UserIDs, body.Role); err != nil {
+		return organizationError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "users added to organization",
+	})
+}
+
+// Change a member's role
+func SetOrgRole(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		OrganizationId uint   `json:"organization_id"`
+		UserId         uint   `json:"user_id"`
+		Role           string `json:"role"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	role, done, err := checkOrgRole(c, svc, body.OrganizationId, true)
+	if done {
+		return err
+	}
+
+	if err := svc.OrganizationService.SetRole(role, body.OrganizationId, body.UserId, body.Role); err != nil {
+		return organizationError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "role updated",
+	})
+}
+
+// Remove a member from an organization, members can remove themselves
+func RemoveOrgMember(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		OrganizationId uint `json:"organization_id"`
+		UserId         uint `json:"user_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+	user := c.Locals("user").(*models.User)
+
+	role, done, err := checkOrgRole(c, svc, body.OrganizationId, false)
+	if done {
+		return err
+	}
+
+	if err := svc.OrganizationService.RemoveMember(user.ID, role, body.OrganizationId, body.UserId); err != nil {
+		return organizationError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "member removed",
+	})
+}
+
+// Return the events an organization owns
+func ReturnOrgEvents(c *fiber.Ctx, svc *services.AppServices) error {
+	var req struct {
+		OrganizationId uint `json:"organization_id" query:"organization_id"`
+	}
+	if err := parseRequest(c, &req); err != nil || req.OrganizationId == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "organization_id is required",
+		})
+	}
+
+	if _, done, err := checkOrgRole(c, svc, req.OrganizationId, false); done {
+		return err
+	}
+
+	events, err := svc.OrganizationService.OrganizationRepo.FindEvents(req.OrganizationId)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(events)
+}
+
+// Return an organization's usage against its plan's limits, admins only
+func ReturnOrgUsage(c *fiber.Ctx, svc *services.AppServices) error {
+	var req struct {
+		OrganizationId uint `json:"organization_id" query:"organization_id"`
+	}
+	if err := parseRequest(c, &req); err != nil || req.OrganizationId == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "organization_id is required",
+		})
+	}
+
+	if _, done, err := checkOrgRole(c, svc, req.OrganizationId, true); done {
+		return err
+	}
+
+	org, err := svc.OrganizationService.OrganizationRepo.FindOrganization(req.OrganizationId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "organization not found",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	report, err := svc.QuotaService.OrganizationReport(org)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(report)
+}
+
+// Move an event into one of the user's organizations, or back to its members with organization_id 0
+func SetEventOrganization(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId        uint `json:"event_id"`
+		OrganizationId uint `json:"organization_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+	user := c.Locals("user").(*models.User)
+
+	if done, err := checkEventOwner(c, svc, body.EventId); done {
+		return err
+	}
+
+	if err := svc.OrganizationService.SetEventOrganization(user, body.EventId, body.OrganizationId, auditActor(c)); err != nil {
+		return organizationError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"message":         "event organization updated",
+		"organization_id": body.OrganizationId,
+	})
+}
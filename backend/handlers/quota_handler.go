@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Respond to a failed quota check, 403 with the exceeded quota or 500 if usage could not be checked
+func quotaError(c *fiber.Ctx, err error) error {
+	var quotaErr *services.QuotaError
+	if errors.As(err, &quotaErr) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": quotaErr.Error(),
+			"quota": quotaErr,
+		})
+	}
+	return c.Status(500).JSON(fiber.Map{
+		"error": "an error occured when checking quotas",
+	})
+}
+
+// Return the logged in user's usage and limits, and the event's if event_id is given
+func ReturnUsage(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId uint `json:"event_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+
+	userReport, err := svc.QuotaService.UserReport(user)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	response := fiber.Map{
+		"user": userReport,
+	}
+
+	if body.EventId != 0 {
+		exists, err := svc.EventRepo.CheckAccess(user.ID, body.EventId)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "an error occured when checking user in event",
+			})
+		}
+		if !exists {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "user is not part of this event",
+			})
+		}
+
+		eventReport, err := svc.QuotaService.EventReport(user, body.EventId)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		response["event"] = eventReport
+	}
+
+	return c.JSON(response)
+}
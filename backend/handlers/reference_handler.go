@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Presign an upload for a reference selfie
+func GetReferenceUpload(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		Filename    string `json:"filename"`
+		ContentType string `json:"content_type"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	allowed := map[string]bool{
+		"image/jpeg": true,
+		"image/png":  true,
+	}
+	if !allowed[body.ContentType] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "unsupported file type",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+	objectKey := fmt.Sprintf("%s%s-%s", services.ReferencePrefix(user.ID), uuid.NewString(), body.Filename)
+	bucketName := os.Getenv("BUCKET_NAME")
+
+	url, err := svc.S3Service.PresignPutObject(c.Context(), bucketName, objectKey, body.ContentType, 120)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"upload_url":  url,
+		"storage_key": objectKey,
+	})
+}
+
+// Enroll an uploaded reference selfie
+func EnrollReference(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		StorageKey string `json:"storage_key"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+
+	ref, err := svc.ReferenceService.Enroll(c.Context(), user.ID, body.StorageKey)
+	if err != nil {
+		if errors.Is(err, services.ErrReferenceKey) || errors.Is(err, services.ErrReferenceLimit) || errors.Is(err, services.ErrOptedOut) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(ref)
+}
+
+// Return the logged in user's reference selfies
+func ReturnReferences(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	refs, err := svc.ReferenceService.ReferenceRepo.FindUserReferences(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to find reference selfies",
+		})
+	}
+
+	return c.JSON(refs)
+}
+
+// Delete a reference selfie, it is removed from every event collection
+func DeleteReference(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		ReferenceId uint `json:"reference_id"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+
+	if err := svc.ReferenceService.Delete(c.Context(), user.ID, body.ReferenceId); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "reference selfie not found",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": "reference selfie deleted",
+	})
+}
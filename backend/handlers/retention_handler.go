@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Set when an event expires and what happens then - event owner only.
+// Takes either an expiry date or a retention period in days from now, neither clears the expiry.
+func SetEventRetention(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId       uint       `json:"event_id"`
+		ExpiresAt     *time.Time `json:"expires_at"`     // RFC3339
+		RetentionDays *int       `json:"retention_days"` // alternative to expires_at
+		Action        string     `json:"action"`         // delete (default) or archive
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request",
+		})
+	}
+
+	if body.ExpiresAt != nil && body.RetentionDays != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "set either expires_at or retention_days, not both",
+		})
+	}
+
+	expiresAt := body.ExpiresAt
+	if body.RetentionDays != nil {
+		if *body.RetentionDays <= 0 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "retention_days must be positive",
+			})
+		}
+		at := time.Now().AddDate(0, 0, *body.RetentionDays)
+		expiresAt = &at
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "expires_at must be in the future",
+		})
+	}
+
+	if body.Action == "" {
+		body.Action = models.ExpiryDelete
+	}
+	if body.Action != models.ExpiryDelete && body.Action != models.ExpiryArchive {
+		return c.Status(400).JSON(fiber.Map{
+			"error": services.ErrExpiryAction.Error(),
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, body.EventId); done {
+		return err
+	}
+
+	if err := svc.RetentionService.SetRetention(body.EventId, expiresAt, body.Action, auditActor(c)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "event not found",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"event_id":      body.EventId,
+		"expires_at":    expiresAt,
+		"expiry_action": body.Action,
+	})
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Return deleted events for the user, and deleted photos for an event when event_id is given
+func ReturnTrash(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId uint `json:"event_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+
+	events, err := svc.TrashService.TrashRepo.FindDeletedEvents(user.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to find deleted events",
+		})
+	}
+
+	eventResults := make([]fiber.Map, 0, len(events))
+	for _, ev := range events {
+		eventResults = append(eventResults, fiber.Map{
+			"event_id":   ev.EventId,
+			"event_name": ev.EventName,
+			"deleted_at": ev.DeletedAt,
+			"purge_at":   svc.TrashService.PurgeAt(ev.DeletedAt),
+		})
+	}
+
+	photoResults := make([]fiber.Map, 0)
+	if body.EventId != 0 {
+		exists, err := svc.EventRepo.CheckAccess(user.ID, body.EventId)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "an error occured when checking user in event",
+			})
+		}
+		if !exists {
+			return c.Status(403).JSON(fiber.Map{
+				"error": "user is not part of this event",
+			})
+		}
+
+		photos, err := svc.TrashService.TrashRepo.FindDeletedPhotos(body.EventId)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "failed to find deleted photos",
+			})
+		}
+
+		keys := make([]string, len(photos))
+		for i, p := range photos {
+			keys[i] = p.StorageKey
+		}
+
+		urls, err := svc.RenditionService.PresignViewObjects(c.Context(), user.ID, keys, body.EventId)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "failed to generate presign URLs",
+			})
+		}
+
+		for i, p := range photos {
+			photoResults = append(photoResults, fiber.Map{
+				"id":         p.ID,
+				"url":        urls[i].URL,
+				"expires":    urls[i].ExpiresAt,
+				"deleted_at": p.DeletedAt,
+				"purge_at":   svc.TrashService.PurgeAt(p.DeletedAt),
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"retention_days": int(svc.TrashService.Retention / (24 * time.Hour)),
+		"events":         eventResults,
+		"photos":         photoResults,
+	})
+}
+
+// Restore a photo from the trash
+func RestorePhoto(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		PhotoId uint `json:"photo_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	photo, err := svc.TrashService.TrashRepo.FindDeletedPhoto(body.PhotoId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "photo not found in trash",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to find photo",
+		})
+	}
+
+	user := c.Locals("user").(*models.User)
+	exists, err := svc.EventRepo.CheckAccess(user.ID, photo.EventID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "an error occured when checking user in event",
+		})
+	}
+	if !exists {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "user is not part of this event",
+		})
+	}
+
+	if err := svc.TrashService.TrashRepo.RestorePhoto(photo.ID, auditActor(c)); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": "photo restored",
+	})
+}
+
+// Restore an event from the trash, event owner only
+func RestoreEvent(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId uint `json:"event_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, body.EventId); done {
+		return err
+	}
+
+	if err := svc.TrashService.TrashRepo.RestoreEvent(body.EventId, auditActor(c)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "event not found in trash",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to restore event",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": "event restored",
+	})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Return whether two-factor authentication is on and how many recovery codes are left
+func TwoFactorStatus(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	var remaining int64
+	if user.TOTPEnabled {
+		var err error
+		if remaining, err = svc.TwoFactorService.RemainingRecoveryCodes(user); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":                  user.TOTPEnabled,
+		"enabled_at":               user.TOTPEnabledAt,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// Start TOTP enrollment, returns the secret and otpauth:// URI to add to an authenticator app
+func BeginTwoFactor(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	enrollment, err := svc.TwoFactorService.BeginEnrollment(user)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(enrollment)
+}
+
+// Confirm enrollment with a code from the app, returns recovery codes that are only shown this once
+func ConfirmTwoFactor(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Code == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "code is required",
+		})
+	}
+	user := c.Locals("user").(*models.User)
+
+	codes, err := svc.TwoFactorService.ConfirmEnrollment(user, body.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":        true,
+		"recovery_codes": codes,
+	})
+}
+
+// Turn two-factor authentication off with a current code or recovery code
+func DisableTwoFactor(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Code == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "code is required",
+		})
+	}
+	user := c.Locals("user").(*models.User)
+
+	if err := svc.TwoFactorService.Disable(user, body.Code); err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled": false,
+	})
+}
+
+// Replace recovery codes with a current code or recovery code, the new codes are only shown this once
+func RegenerateRecoveryCodes(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.Code == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "code is required",
+		})
+	}
+	user := c.Locals("user").(*models.User)
+
+	codes, err := svc.TwoFactorService.RegenerateRecoveryCodes(user, body.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"recovery_codes": codes,
+	})
+}
+
+func twoFactorError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrTwoFactorCode):
+		return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorEnabled),
+		errors.Is(err, services.ErrTwoFactorDisabled),
+		errors.Is(err, services.ErrTwoFactorNotStarted):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(500).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+
 	"github.com/Rynoo1/PicSort/backend/models"
 	"github.com/Rynoo1/PicSort/backend/services"
 	"github.com/gofiber/fiber/v2"
@@ -31,3 +33,23 @@ func SearchUsers(c *fiber.Ctx, repo *services.AppServices) error {
 
 	return c.JSON(users)
 }
+
+// Send the logged in user a new email verification link
+func ResendVerification(c *fiber.Ctx, svc *services.AppServices) error {
+	user := c.Locals("user").(*models.User)
+
+	if err := svc.VerificationService.SendVerification(c.Context(), user); err != nil {
+		if errors.Is(err, services.ErrAlreadyVerified) {
+			return c.Status(409).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to send verification email",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "verification email sent",
+	})
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Number of deliveries returned in the delivery log
+const webhookDeliveryLogLimit = 50
+
+// Register a webhook on an event, the signing secret is only returned here
+func CreateWebhook(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId    uint     `json:"event_id"`
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, body.EventId); done {
+		return err
+	}
+
+	user := c.Locals("user").(*models.User)
+
+	hook, err := svc.WebhookService.CreateWebhook(c.Context(), body.EventId, user.ID, body.URL, body.EventTypes)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"webhook": db.ToReturnWebhook(*hook),
+		"secret":  hook.Secret,
+	})
+}
+
+// Return all webhooks for an event
+func ReturnWebhooks(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		EventId uint `json:"event_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, body.EventId); done {
+		return err
+	}
+
+	hooks, err := svc.WebhookService.WebhookRepo.FindEventWebhooks(body.EventId)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to find webhooks",
+		})
+	}
+
+	return c.JSON(hooks)
+}
+
+// Delete a webhook
+func DeleteWebhook(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		WebhookId uint `json:"webhook_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	hook, done, err := findOwnedWebhook(c, svc, body.WebhookId)
+	if done {
+		return err
+	}
+
+	if err := svc.WebhookService.WebhookRepo.DeleteWebhook(hook.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to delete webhook",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": "webhook deleted",
+	})
+}
+
+// Return the delivery log for a webhook
+func ReturnWebhookDeliveries(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		WebhookId uint `json:"webhook_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	hook, done, err := findOwnedWebhook(c, svc, body.WebhookId)
+	if done {
+		return err
+	}
+
+	deliveries, err := svc.WebhookService.WebhookRepo.FindDeliveries(hook.ID, webhookDeliveryLogLimit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to find webhook deliveries",
+		})
+	}
+
+	return c.JSON(deliveries)
+}
+
+// Queue a delivery to be sent again
+func ReplayWebhookDelivery(c *fiber.Ctx, svc *services.AppServices) error {
+	var body struct {
+		DeliveryId uint `json:"delivery_id"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	delivery, err := svc.WebhookService.WebhookRepo.FindDelivery(body.DeliveryId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "delivery not found",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to find delivery",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, delivery.Webhook.EventID); done {
+		return err
+	}
+
+	if err := svc.WebhookService.WebhookRepo.ReplayDelivery(delivery.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to replay delivery",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": "delivery queued for replay",
+	})
+}
+
+// Find a webhook and check the logged in user owns its event
+func findOwnedWebhook(c *fiber.Ctx, svc *services.AppServices, webhookId uint) (*models.Webhook, bool, error) {
+	hook, err := svc.WebhookService.WebhookRepo.FindWebhook(webhookId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, true, c.Status(404).JSON(fiber.Map{
+				"error": "webhook not found",
+			})
+		}
+		return nil, true, c.Status(500).JSON(fiber.Map{
+			"error": "failed to find webhook",
+		})
+	}
+
+	if done, err := checkEventOwner(c, svc, hook.EventID); done {
+		return nil, true, err
+	}
+	return hook, false, nil
+}
@@ -11,9 +11,13 @@ import (
 	"github.com/Rynoo1/PicSort/backend/routes"
 	"github.com/Rynoo1/PicSort/backend/services"
 	servdb "github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/Rynoo1/PicSort/backend/services/oidc"
+	"github.com/Rynoo1/PicSort/backend/services/pubsub"
+	"github.com/Rynoo1/PicSort/backend/services/ratelimit"
 	awsCon "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/joho/godotenv"
 )
 
@@ -62,39 +66,212 @@ func main() {
 
 	jwtSecret := os.Getenv("JWT_SECRET")
 
+	// Init rate limiting - RATE_LIMIT_STORE=postgres shares limits between instances
+	rateLimits := config.LoadRateLimitConfig()
+	var limitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+		limitStore = ratelimit.NewPostgresStore(db)
+	}
+
+	// Init live update pub/sub - PUBSUB_BACKEND=postgres shares updates between instances
+	var pubsubBackend pubsub.Backend = pubsub.NewMemoryBackend()
+	if os.Getenv("PUBSUB_BACKEND") == "postgres" {
+		pubsubBackend, err = pubsub.NewPostgresBackend(context.Background(), db, config.DatabaseDSN())
+		if err != nil {
+			log.Fatalf("unable to start pub/sub backend: %v", err)
+		}
+	}
+	broker := pubsub.NewBroker(pubsubBackend)
+
 	// Initialise repos, services, clients
 	s3Service := services.NewS3Service(cfg)
 	rekClient := rekognition.NewFromConfig(cfg)
 	imageRepo := servdb.NewImageRepo(db)
-	eventPersonRepo := servdb.NewEventPersonRepo(db)
+	eventPersonRepo := servdb.NewEventPersonRepo(db).WithPublisher(broker)
 	detectionRepo := servdb.NewDetectionRepo(db)
 	eventRepo := servdb.NewEventRepo(db)
+	webhookService := services.NewWebhookService(servdb.NewWebhookRepo(db))
 	userService := services.NewUserService(db)
+	userService.MaxFailedLogins = rateLimits.LoginMaxFailures
+	userService.LockoutDuration = rateLimits.LoginLockout
+	authService := services.NewAuthService(jwtSecret)
+
+	// Init email - MAILER=file writes emails to MAIL_DIR instead of the log
+	mailConfig := config.LoadMailConfig()
+	userService.RequireVerifiedToJoin = mailConfig.RequireVerifiedToJoin
+	mailer, err := services.NewMailer(mailConfig.Driver, mailConfig.Dir, mailConfig.From)
+	if err != nil {
+		log.Fatalf("unable to start mailer: %v", err)
+	}
+	verificationService := &services.VerificationService{
+		UserService: userService,
+		AuthService: authService,
+		Mailer:      mailer,
+		AppURL:      mailConfig.AppURL,
+	}
+
+	// Init external logins - OIDC_MOCK=true adds a local mock provider for development
+	oidcConfig := config.LoadOIDCConfig()
+	oidcProviders := make(map[string]*oidc.Provider, len(oidcConfig.Providers))
+	for name, providerConfig := range oidcConfig.Providers {
+		oidcProviders[name] = oidc.NewProvider(name, providerConfig)
+	}
+	oidcService := &services.OIDCService{
+		IdentityRepo: servdb.NewIdentityRepo(db),
+		UserService:  userService,
+		Providers:    oidcProviders,
+		AppRedirect:  oidcConfig.AppRedirect,
+	}
+	twoFactorService := &services.TwoFactorService{
+		TwoFactorRepo: servdb.NewTwoFactorRepo(db),
+		UserService:   userService,
+		AuthService:   authService,
+		Issuer:        config.TOTPIssuer(),
+	}
+	quotaService := &services.QuotaService{
+		QuotaRepo: servdb.NewQuotaRepo(db),
+		Plans:     config.LoadQuotaPlans(),
+	}
+	referenceRepo := servdb.NewReferenceRepo(db)
+	notificationRepo := servdb.NewNotificationRepo(db)
+	consentRepo := servdb.NewConsentRepo(db)
+	renditionService := &services.RenditionService{
+		RenditionRepo:     servdb.NewRenditionRepo(db),
+		S3Service:         s3Service,
+		RekognitionClient: rekClient,
+		Quotas:            quotaService,
+	}
 	imageServices := &services.ImageService{
 		ImageRepo:         imageRepo,
 		EventPersonRepo:   eventPersonRepo,
 		DetectionRepo:     detectionRepo,
+		ReferenceRepo:     referenceRepo,
+		ConsentRepo:       consentRepo,
+		NotificationRepo:  notificationRepo,
+		RekognitionClient: rekClient,
+		S3Service:         s3Service,
+		Publisher:         broker,
+		Quotas:            quotaService,
+		Renditions:        renditionService,
+	}
+	referenceService := &services.ReferenceService{
+		ReferenceRepo:     referenceRepo,
+		EventRepo:         eventRepo,
 		RekognitionClient: rekClient,
 		S3Service:         s3Service,
+		Quotas:            quotaService,
+	}
+	consentService := &services.ConsentService{
+		ConsentRepo:       consentRepo,
+		ReferenceService:  referenceService,
+		RekognitionClient: rekClient,
+		Renditions:        renditionService,
 	}
 	eventService := &services.EventService{
 		EventRepo:         eventRepo,
 		S3Service:         s3Service,
 		RekognitionClient: rekClient,
 	}
+	albumService := &services.AlbumService{
+		AlbumRepo:        servdb.NewAlbumRepo(db),
+		RenditionService: renditionService,
+		S3Service:        s3Service,
+		AppURL:           mailConfig.AppURL,
+	}
+	trashService := &services.TrashService{
+		TrashRepo:    servdb.NewTrashRepo(db),
+		ImageService: imageServices,
+		EventService: eventService,
+		AlbumService: albumService,
+		Renditions:   renditionService,
+		Retention:    config.TrashRetention(),
+	}
+	accountService := &services.AccountService{
+		AccountRepo:      servdb.NewAccountRepo(db),
+		ReferenceRepo:    referenceRepo,
+		ImageService:     imageServices,
+		EventService:     eventService,
+		ConsentService:   consentService,
+		ReferenceService: referenceService,
+		S3Service:        s3Service,
+	}
+	retentionService := &services.RetentionService{
+		RetentionRepo:    servdb.NewRetentionRepo(db),
+		NotificationRepo: notificationRepo,
+		EventService:     eventService,
+		ConsentService:   consentService,
+		Publisher:        broker,
+		WarnBefore:       config.RetentionWarning(),
+	}
+	apiKeyService := &services.APIKeyService{
+		APIKeyRepo: servdb.NewAPIKeyRepo(db),
+		EventRepo:  eventRepo,
+	}
+	organizationService := &services.OrganizationService{
+		OrganizationRepo: servdb.NewOrganizationRepo(db),
+		UserService:      userService,
+	}
+	interactionService := &services.InteractionService{
+		InteractionRepo:  servdb.NewInteractionRepo(db),
+		NotificationRepo: notificationRepo,
+		Publisher:        broker,
+	}
 	appServices := &services.AppServices{
-		S3Service:       s3Service,
-		ImageService:    imageServices,
-		EventRepo:       eventRepo,
-		UserService:     userService,
-		EventPersonRepo: eventPersonRepo,
-		EventService:    eventService,
+		S3Service:           s3Service,
+		ImageService:        imageServices,
+		EventRepo:           eventRepo,
+		UserService:         userService,
+		EventPersonRepo:     eventPersonRepo,
+		EventService:        eventService,
+		Broker:              broker,
+		WebhookService:      webhookService,
+		AuditRepo:           servdb.NewAuditRepo(db),
+		TrashService:        trashService,
+		QuotaService:        quotaService,
+		ReferenceService:    referenceService,
+		NotificationRepo:    notificationRepo,
+		ConsentService:      consentService,
+		RenditionService:    renditionService,
+		AccountService:      accountService,
+		RetentionService:    retentionService,
+		VerificationService: verificationService,
+		OIDCService:         oidcService,
+		TwoFactorService:    twoFactorService,
+		APIKeyService:       apiKeyService,
+		OrganizationService: organizationService,
+		AlbumService:        albumService,
+		InteractionService:  interactionService,
+	}
+
+	// Send queued webhook deliveries in the background
+	go webhookService.Run(context.Background())
+
+	// Placeholder served while photos of opted out people wait for a blurred copy
+	if err := renditionService.EnsurePlaceholder(context.Background()); err != nil {
+		log.Printf("[WARN] failed to upload blur placeholder: %v", err)
 	}
-	authService := services.NewAuthService(jwtSecret)
 
-	app := fiber.New()
+	// Purge photos and events that have been in the trash past the retention window, and retry failed blurred copies
+	go trashService.Run(context.Background())
+
+	// Warn members about expiring events and delete or archive them once they expire
+	go retentionService.Run(context.Background())
+
+	app := fiber.New(fiber.Config{
+		// header holding the client IP when behind a load balancer (e.g. X-Forwarded-For), used by per IP rate limits
+		ProxyHeader: os.Getenv("PROXY_HEADER"),
+	})
+
+	if oidcConfig.Mock {
+		mockIssuer, err := oidc.NewMockIssuer(oidcConfig.MockIssuer)
+		if err != nil {
+			log.Fatalf("unable to start mock OIDC issuer: %v", err)
+		}
+		app.All("/mock-oidc/*", adaptor.HTTPHandler(mockIssuer))
+		log.Printf("[WARN] mock OIDC issuer enabled at %s, anyone can log in as any email", oidcConfig.MockIssuer)
+	}
 
-	routes.SetupRoutes(app, appServices, db, authService)
+	routes.SetupRoutes(app, appServices, db, authService, rateLimits, limitStore)
 
 	log.Fatal(app.Listen(":8080"))
 }
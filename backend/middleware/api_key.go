@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// What an API key needs to call a route
+type APIKeyRule struct {
+	Scope string                    // scope the key must have
+	Event func(c *fiber.Ctx) string // event the request is for, nil when keys limited to an event cannot use the route
+}
+
+// Routes API keys may call by path, every other route needs a login token
+type APIKeyRoutes map[string]APIKeyRule
+
+// Look up the rule for a request path, routes match ignoring case and a trailing slash like fiber does
+func (r APIKeyRoutes) find(path string) (APIKeyRule, bool) {
+	path = strings.ToLower(strings.TrimSuffix(path, "/"))
+	for route, rule := range r {
+		if strings.ToLower(strings.TrimSuffix(route, "/")) == path {
+			return rule, true
+		}
+	}
+	return APIKeyRule{}, false
+}
+
+// Check an API key may make this request, responding 403 when it may not.
+// Returns true when a response has already been sent.
+func (r APIKeyRoutes) deny(c *fiber.Ctx, key *models.APIKey) (bool, error) {
+	rule, ok := r.find(c.Path())
+	if !ok {
+		return true, c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"error": "API keys cannot use this route",
+		})
+	}
+	if rule.Scope != key.Scope {
+		return true, c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"error": fmt.Sprintf("API key needs the %s scope for this route", rule.Scope),
+		})
+	}
+
+	if key.EventID == nil {
+		return false, nil
+	}
+	if rule.Event == nil || !sameEvent(rule.Event(c), *key.EventID) {
+		return true, c.Status(http.StatusForbidden).JSON(fiber.Map{
+			"error": "API key is limited to another event",
+		})
+	}
+	return false, nil
+}
+
+// JSON numbers decode as floats, so ids may arrive as "12" or "1.2e+06"
+func sameEvent(value string, eventId uint) bool {
+	if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return uint(id) == eventId
+	}
+	if id, err := strconv.ParseFloat(value, 64); err == nil {
+		return id == float64(eventId)
+	}
+	return false
+}
+
+// Key requests by a field read like parseRequest does, from the query for GET and the JSON body otherwise
+func ByRequestField(field string) func(c *fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		if c.Method() == fiber.MethodGet {
+			return c.Query(field)
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return ""
+		}
+		value, ok := body[field]
+		if !ok || value == nil {
+			return ""
+		}
+		return fmt.Sprint(value)
+	}
+}
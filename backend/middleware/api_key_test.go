@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+var testAPIKeyRoutes = APIKeyRoutes{
+	"/api/event/data":        {Scope: models.APIKeyScopeRead, Event: ByRequestField("event_id")},
+	"/api/image/upload-urls": {Scope: models.APIKeyScopeUpload, Event: ByRequestField("event_id")},
+	"/api/event/list":        {Scope: models.APIKeyScopeRead},
+}
+
+// Status of a request made with key, 200 when deny lets it through
+func apiKeyStatus(t *testing.T, key *models.APIKey, method, target, body string) int {
+	t.Helper()
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if done, err := testAPIKeyRoutes.deny(c, key); done {
+			return err
+		}
+		return c.SendStatus(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestAPIKeyRoutesDeny(t *testing.T) {
+	event := uint(12)
+	readKey := &models.APIKey{Scope: models.APIKeyScopeRead}
+	uploadKey := &models.APIKey{Scope: models.APIKeyScopeUpload}
+	eventReadKey := &models.APIKey{Scope: models.APIKeyScopeRead, EventID: &event}
+	eventUploadKey := &models.APIKey{Scope: models.APIKeyScopeUpload, EventID: &event}
+
+	tests := []struct {
+		name   string
+		key    *models.APIKey
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{"unknown route", readKey, http.MethodGet, "/api/account", "", http.StatusForbidden},
+		{"route matched ignoring case and trailing slash", readKey, http.MethodGet, "/API/Event/Data/?event_id=3", "", http.StatusOK},
+		{"read key on an upload route", readKey, http.MethodPost, "/api/image/upload-urls", `{"event_id":12}`, http.StatusForbidden},
+		{"upload key on a read route", uploadKey, http.MethodGet, "/api/event/data?event_id=12", "", http.StatusForbidden},
+		{"key for every event", uploadKey, http.MethodPost, "/api/image/upload-urls", `{"event_id":99}`, http.StatusOK},
+		{"event key in the query", eventReadKey, http.MethodGet, "/api/event/data?event_id=12", "", http.StatusOK},
+		{"event key in the body", eventUploadKey, http.MethodPost, "/api/image/upload-urls", `{"event_id":12}`, http.StatusOK},
+		{"event key for another event", eventReadKey, http.MethodGet, "/api/event/data?event_id=13", "", http.StatusForbidden},
+		{"event key for another event in the body", eventUploadKey, http.MethodPost, "/api/image/upload-urls", `{"event_id":13}`, http.StatusForbidden},
+		{"event key without an event", eventReadKey, http.MethodGet, "/api/event/data", "", http.StatusForbidden},
+		{"event key with a malformed body", eventUploadKey, http.MethodPost, "/api/image/upload-urls", `{"event_id":`, http.StatusForbidden},
+		{"event key on a route across events", eventReadKey, http.MethodGet, "/api/event/list", "", http.StatusForbidden},
+		{"key for every event on a route across events", readKey, http.MethodGet, "/api/event/list", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := apiKeyStatus(t, tt.key, tt.method, tt.target, tt.body); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSameEvent(t *testing.T) {
+	tests := []struct {
+		value   string
+		eventId uint
+		want    bool
+	}{
+		{"12", 12, true},
+		{"12", 13, false},
+		{"1.2e+06", 1200000, true},
+		{"1.2e+06", 1200001, false},
+		{"12.5", 12, false},
+		{"-12", 12, false},
+		{"", 0, false},
+		{"12abc", 12, false},
+		{"[12]", 12, false},
+	}
+	for _, tt := range tests {
+		if got := sameEvent(tt.value, tt.eventId); got != tt.want {
+			t.Errorf("sameEvent(%q, %d) = %v, want %v", tt.value, tt.eventId, got, tt.want)
+		}
+	}
+}
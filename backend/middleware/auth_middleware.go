@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -10,8 +11,14 @@ import (
 	"gorm.io/gorm"
 )
 
-func AuthMiddleware(db *gorm.DB, authService *services.AuthService) fiber.Handler {
+// Authenticate with a login token, or an API key for the routes in apiKeyRoutes.
+// API keys are sent as a Bearer token or in the X-API-Key header.
+func AuthMiddleware(db *gorm.DB, authService *services.AuthService, apiKeys *services.APIKeyService, apiKeyRoutes APIKeyRoutes) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if key := c.Get("X-API-Key"); key != "" {
+			return authenticateAPIKey(c, apiKeys, apiKeyRoutes, key)
+		}
+
 		// Get token from Authorisation header
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -28,6 +35,10 @@ func AuthMiddleware(db *gorm.DB, authService *services.AuthService) fiber.Handle
 			})
 		}
 
+		if services.IsAPIKey(tokenParts[1]) {
+			return authenticateAPIKey(c, apiKeys, apiKeyRoutes, tokenParts[1])
+		}
+
 		// Validate token
 		claims, err := authService.ValidateToken(tokenParts[1])
 		if err != nil {
@@ -50,3 +61,28 @@ func AuthMiddleware(db *gorm.DB, authService *services.AuthService) fiber.Handle
 		return c.Next()
 	}
 }
+
+// Authenticate an API key and check it may call the route
+func authenticateAPIKey(c *fiber.Ctx, apiKeys *services.APIKeyService, routes APIKeyRoutes, raw string) error {
+	key, err := apiKeys.Authenticate(raw)
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeyInvalid) {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Invalid API key",
+			})
+		}
+		return c.Status(http.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check API key",
+		})
+	}
+
+	if done, err := routes.deny(c, key); done {
+		return err
+	}
+
+	// Store user and key in context for use in handlers
+	c.Locals("user", &key.User)
+	c.Locals("api_key", key)
+
+	return c.Next()
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/services/ratelimit"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRateLimitRespondsWithRetryAfter(t *testing.T) {
+	app := fiber.New()
+	app.Use(RateLimit(ratelimit.NewMemoryStore(), RateRule{
+		Name:  "test",
+		Limit: ratelimit.Limit{Requests: 1, Per: time.Minute},
+		Key:   ByIP,
+	}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("first request status = %d, want 200", resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want 429", resp.StatusCode)
+	}
+	if got := resp.Header.Get(fiber.HeaderRetryAfter); got != "60" {
+		t.Fatalf("Retry-After = %q, want 60", got)
+	}
+}
+
+func TestRateLimitSkipsDisabledRulesAndEmptyKeys(t *testing.T) {
+	app := fiber.New()
+	app.Use(RateLimit(ratelimit.NewMemoryStore(),
+		RateRule{Name: "off", Limit: ratelimit.Limit{}, Key: ByIP},
+		RateRule{Name: "nokey", Limit: ratelimit.Limit{Requests: 1, Per: time.Minute}, Key: func(c *fiber.Ctx) string { return "" }},
+	))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusOK)
+	})
+
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i+1, resp.StatusCode)
+		}
+	}
+}
+
+func TestTooManyRequestsRoundsRetryAfterUp(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want string
+	}{
+		{0, "1"},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1001 * time.Millisecond, "2"},
+		{90 * time.Second, "90"},
+	}
+	for _, tt := range tests {
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			return TooManyRequests(c, tt.wait, "slow down")
+		})
+
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get(fiber.HeaderRetryAfter); got != tt.want {
+			t.Errorf("TooManyRequests(%v) Retry-After = %q, want %q", tt.wait, got, tt.want)
+		}
+	}
+}
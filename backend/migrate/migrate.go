@@ -2,21 +2,111 @@ package migrate
 
 import (
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/Rynoo1/PicSort/backend/models"
 	"gorm.io/gorm"
 )
 
 func RunMigrations(db *gorm.DB) error {
+	// use EventUser (with membership role) as the event_users join table
+	if err := db.SetupJoinTable(&models.Event{}, "Users", &models.EventUser{}); err != nil {
+		return fmt.Errorf("failed to setup event_users join table: %v", err)
+	}
+	if err := db.SetupJoinTable(&models.User{}, "Events", &models.EventUser{}); err != nil {
+		return fmt.Errorf("failed to setup event_users join table: %v", err)
+	}
+
 	err := db.AutoMigrate(
 		&models.EventPerson{},
 		&models.Event{},
 		&models.FaceDetection{},
 		&models.Photos{},
 		&models.User{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.WebhookAttempt{},
+		&models.RateLimitBucket{},
+		&models.AuditLog{},
+		&models.FaceAPIUsage{},
+		&models.ReferenceFace{},
+		&models.ReferenceFaceIndex{},
+		&models.Notification{},
+		&models.ConsentRecord{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.RecoveryCode{},
+		&models.APIKey{},
+		&models.Organization{},
+		&models.OrganizationMember{},
+		&models.Album{},
+		&models.AlbumPhoto{},
+		&models.AlbumShare{},
+		&models.Favorite{},
+		&models.PhotoReaction{},
+		&models.PhotoComment{},
+		&models.DataMigration{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %v", err)
 	}
+
+	if err := db.Exec(auditLogAppendOnly).Error; err != nil {
+		return fmt.Errorf("failed to make audit_log append-only: %v", err)
+	}
+	if err := runOnce(db, "backfill_event_owners", func(tx *gorm.DB) error {
+		return tx.Exec(backfillEventOwners, models.RoleOwner, models.RoleOwner).Error
+	}); err != nil {
+		return fmt.Errorf("failed to backfill event owners: %v", err)
+	}
 	return nil
 }
+
+// Run a data migration unless it has already been applied, recording it in the same transaction.
+// The lock keeps instances starting together from applying it twice.
+func runOnce(db *gorm.DB, name string, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("LOCK TABLE data_migrations IN EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		var applied int64
+		if err := tx.Model(&models.DataMigration{}).Where("name = ?", name).Count(&applied).Error; err != nil {
+			return err
+		}
+		if applied > 0 {
+			return nil
+		}
+
+		if err := fn(tx); err != nil {
+			return err
+		}
+		log.Printf("[MIGRATE] applied data migration %s", name)
+		return tx.Create(&models.DataMigration{Name: name, AppliedAt: time.Now()}).Error
+	})
+}
+
+// Events created before roles existed have no owner, their longest standing member becomes one.
+// Runs once, later events without an owner are left for an admin to sort out.
+const backfillEventOwners = `
+UPDATE event_users SET role = ?
+WHERE (event_id, user_id) IN (
+	SELECT DISTINCT ON (event_id) event_id, user_id FROM event_users
+	WHERE event_id NOT IN (SELECT event_id FROM event_users WHERE role = ?)
+	ORDER BY event_id, created_at, user_id
+)
+`
+
+// Reject updates and deletes on audit_log at the database level
+const auditLogAppendOnly = `
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+	FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+`
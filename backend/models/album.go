@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// A named, ordered collection of photos inside an event, a photo can be in any number of albums
+type Album struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	Position  int       `json:"position" gorm:"not null;default:0"` // order of the album within its event
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	EventID uint `json:"event_id" gorm:"not null;index"` // foreign key
+
+	Event  Event        `json:"-" gorm:"foreignKey:EventID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to Event
+	Photos []AlbumPhoto `json:"-" gorm:"foreignKey:AlbumID;constraint:OnDelete:CASCADE;"`               // One to Many relationship with AlbumPhotos
+	Shares []AlbumShare `json:"-" gorm:"foreignKey:AlbumID;constraint:OnDelete:CASCADE;"`               // One to Many relationship with AlbumShares
+}
+
+// A photo's place in an album
+type AlbumPhoto struct {
+	AlbumID   uint      `json:"album_id" gorm:"primaryKey"`
+	PhotoID   uint      `json:"photo_id" gorm:"primaryKey;index"`
+	Position  int       `json:"position" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Photo Photos `json:"-" gorm:"foreignKey:PhotoID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to Photos
+}
+
+// A link that lets anyone view and download an album without logging in.
+// Only a hash of the token is stored, the link itself is shown once when it is created.
+type AlbumShare struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"` // sha256 of the link token
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`          // nil never expires
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	AlbumID   uint  `json:"album_id" gorm:"not null;index"` // foreign key
+	CreatedBy *uint `json:"created_by"`                     // foreign key, cleared when the user is deleted
+
+	User *User `json:"-" gorm:"foreignKey:CreatedBy;references:ID;constraint:OnDelete:SET NULL;"` // Relationship - Belongs to User
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// API key scopes
+const (
+	APIKeyScopeRead   = "read"   // read event photos and people
+	APIKeyScopeUpload = "upload" // upload photos, nothing else
+)
+
+// A personal API key for scripts, such as pushing shots from a tethered camera into an event.
+// Only a hash of the key is stored, the key itself is shown once when it is created.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null;uniqueIndex"` // identifies the key in lists and lookups
+	KeyHash    string     `json:"-" gorm:"not null"`                  // sha256 of the full key
+	Scope      string     `json:"scope" gorm:"not null"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // nil never expires
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	UserID  uint  `json:"user_id" gorm:"not null;index"` // foreign key
+	EventID *uint `json:"event_id,omitempty"`            // foreign key, limits the key to one event
+
+	User  User   `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`  // Relationship - Belongs to User
+	Event *Event `json:"-" gorm:"foreignKey:EventID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to Event
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Audit actions
+const (
+	AuditEventDeleted      = "event.deleted"
+	AuditEventRestored     = "event.restored"
+	AuditEventRenamed      = "event.renamed"
+	AuditEventUpdated      = "event.updated"
+	AuditUsersAdded        = "event.users_added"
+	AuditPhotoDeleted      = "photo.deleted"
+	AuditPhotoRestored     = "photo.restored"
+	AuditPersonRenamed     = "person.renamed"
+	AuditPersonLinked      = "person.linked"
+	AuditPersonOptOut      = "person.do_not_recognize"
+	AuditRecognition       = "event.recognition_mode"
+	AuditRetention         = "event.retention"
+	AuditEventArchived     = "event.archived"
+	AuditEventOrganization = "event.organization"
+	AuditAlbumCreated      = "album.created"
+	AuditAlbumDeleted      = "album.deleted"
+	AuditAlbumShared       = "album.shared"
+	AuditAlbumShareRevoked = "album.share_revoked"
+)
+
+// Append-only record of changes. No foreign keys so entries outlive the rows they describe
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	EventID    uint      `json:"event_id" gorm:"not null;index"`
+	ActorID    *uint     `json:"actor_id"`
+	Action     string    `json:"action" gorm:"not null"`
+	TargetType string    `json:"target_type" gorm:"not null"`
+	TargetID   uint      `json:"target_id" gorm:"not null"`
+	Before     *string   `json:"before" gorm:"type:jsonb"`
+	After      *string   `json:"after" gorm:"type:jsonb"`
+	RequestID  string    `json:"request_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_log"
+}
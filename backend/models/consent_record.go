@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Consent scopes
+const (
+	ConsentScopeUser  = "user"
+	ConsentScopeEvent = "event"
+)
+
+// Append-only history of biometric consent changes. No foreign keys so records outlive the user and event
+type ConsentRecord struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	EventID   *uint     `json:"event_id"` // set for event scoped changes
+	Scope     string    `json:"scope" gorm:"not null"`
+	OptOut    bool      `json:"opt_out" gorm:"not null"`
+	RequestID string    `json:"request_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
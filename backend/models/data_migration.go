@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+// A one-off data migration that has already been applied
+type DataMigration struct {
+	Name      string    `json:"name" gorm:"primaryKey"`
+	AppliedAt time.Time `json:"applied_at" gorm:"not null"`
+}
@@ -1,11 +1,49 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Event face recognition modes
+const (
+	RecognitionAll     = "all"     // everyone is recognised unless they opt out
+	RecognitionConsent = "consent" // only members with an enrolled reference selfie are recognised, other faces are removed
+	RecognitionOff     = "off"     // photos are stored without indexing faces
+)
+
+// What happens to an event once it expires
+const (
+	ExpiryDelete  = "delete"  // event is moved to the trash
+	ExpiryArchive = "archive" // photos are kept but the face collection is dropped and recognition turned off
+)
+
+// Who can open an event
+const (
+	VisibilityMembers      = "members"      // people added to the event and admins of the organization that owns it
+	VisibilityOrganization = "organization" // also every member of the organization that owns the event
+)
 
 type Event struct {
-	ID        uint      `json:"id" gorm:"primaryKey"` // primary key
-	EventName string    `json:"event_name" gorm:"not null"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uint           `json:"id" gorm:"primaryKey"` // primary key
+	EventName       string         `json:"event_name" gorm:"not null"`
+	Description     string         `json:"description" gorm:"not null;default:''"`
+	Location        string         `json:"location" gorm:"not null;default:''"` // venue name or address
+	StartsAt        *time.Time     `json:"starts_at" gorm:"index"`
+	EndsAt          *time.Time     `json:"ends_at"`
+	CoverPhotoID    *uint          `json:"cover_photo_id"` // photo shown in event lists, the newest photo is used when unset
+	Visibility      string         `json:"visibility" gorm:"not null;default:members"`
+	RecognitionMode string         `json:"recognition_mode" gorm:"not null;default:all"`
+	ExpiresAt       *time.Time     `json:"expires_at"`                                   // retention end, nil keeps the event forever
+	ExpiryAction    string         `json:"expiry_action" gorm:"not null;default:delete"` // delete or archive
+	ExpiryWarnedAt  *time.Time     `json:"-"`                                            // members were warned about the coming expiry
+	ArchivedAt      *time.Time     `json:"archived_at,omitempty" gorm:"index"`           // set once an archive expiry has run
+	CreatedAt       time.Time      `json:"created_at" gorm:"not null;default:CURRENT_TIMESTAMP"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"` // soft delete, purged after the trash retention window
+
+	OrganizationID *uint `json:"organization_id,omitempty" gorm:"index"` // foreign key, set when an organization owns the event
 
 	Users []User `json:"users" gorm:"many2many:event_users;constraint:OnDelete:CASCADE;"` // Many to Many relationship with Users
 
@@ -3,9 +3,14 @@ package models
 type EventPerson struct {
 	ID      uint   `json:"id" gorm:"primaryKey"`
 	Name    string `json:"name" gorm:"not null"`
-	EventID uint   `json:"event_id" gorm:"not null"` // Foreign Key
+	EventID uint   `json:"event_id" gorm:"not null;uniqueIndex:idx_event_people_user"` // Foreign Key
+	UserID  *uint  `json:"user_id" gorm:"uniqueIndex:idx_event_people_user"`           // Foreign Key - registered user this person is, one per event
 
-	Event Event `json:"event" gorm:"foreignKey:EventID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to Event
+	DoNotRecognize    bool   `json:"do_not_recognize" gorm:"not null;default:false"` // faces are removed from the collection and never matched or searched
+	SuppressionFaceID string `json:"-" gorm:"not null;default:''"`                   // one face kept in the collection while opted out, so new uploads of the person are recognised and dropped
+
+	Event Event `json:"event" gorm:"foreignKey:EventID;references:ID;constraint:OnDelete:CASCADE;"`          // Relationship - Belongs to Event
+	User  *User `json:"user,omitempty" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:SET NULL;"` // Relationship - Belongs to User
 
 	FaceDetections []FaceDetection `json:"face_detections" gorm:"foreignKey:EventPersonID;constraint:OnDelete:SET NULL;"` // One to many relationship with FaceDetections
 }
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Event membership roles
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+)
+
+// Join table for the Event <-> User many to many relationship
+type EventUser struct {
+	EventID   uint      `json:"event_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	Role      string    `json:"role" gorm:"not null;default:member"`
+	CreatedAt time.Time `json:"created_at"`
+
+	RecognitionOptOut bool `json:"recognition_opt_out" gorm:"not null;default:false"` // member opted out of face recognition in this event
+}
@@ -0,0 +1,11 @@
+package models
+
+// Count of paid Rekognition face API calls per user, event and month.
+// No foreign keys so usage outlives deleted users and events
+type FaceAPIUsage struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	UserID  uint   `json:"user_id" gorm:"not null;uniqueIndex:idx_face_api_usage"`
+	EventID uint   `json:"event_id" gorm:"not null;uniqueIndex:idx_face_api_usage;index"`
+	Period  string `json:"period" gorm:"not null;uniqueIndex:idx_face_api_usage"` // YYYY-MM
+	Calls   int64  `json:"calls" gorm:"not null;default:0"`
+}
@@ -1,13 +1,22 @@
 package models
 
+// Position of a face as ratios of the photo's width and height, all zero if it was not recorded
+type FaceBox struct {
+	Left   float64 `json:"left"`
+	Top    float64 `json:"top"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
 type FaceDetection struct {
 	ID            uint    `json:"id" gorm:"primaryKey"`
 	RekognitionID string  `json:"rekognition_id"`
 	Confidence    float32 `json:"confidence"`
+	Box           FaceBox `json:"bounding_box" gorm:"embedded;embeddedPrefix:box_"`
 
-	PhotoID       uint  `json:"photo_id" gorm:"not null"` // foreign key
-	EventPersonID *uint `json:"event_person_id"`          // foreign key
-	EventID       uint  `json:"event_id" gorm:"not null"` // foreign key
+	PhotoID       uint  `json:"photo_id" gorm:"not null;index;index:idx_face_detections_person_photo,priority:2"` // foreign key
+	EventPersonID *uint `json:"event_person_id" gorm:"index:idx_face_detections_person_photo,priority:1"`         // foreign key
+	EventID       uint  `json:"event_id" gorm:"not null"`                                                         // foreign key
 
 	Photo  Photos      `json:"photo" gorm:"foreignKey:PhotoID;references:ID;constraint:OnDelete:CASCADE;"`         // Relationship - Belongs to Photos
 	Person EventPerson `json:"person" gorm:"foreignKey:EventPersonID;references:ID;constraint:OnDelete:SET NULL;"` // Relationship - Belongs to EventPeople
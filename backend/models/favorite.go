@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// A photo a user has marked as a favorite
+type Favorite struct {
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	PhotoID   uint      `json:"photo_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+
+	User  User   `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`  // Relationship - Belongs to User
+	Photo Photos `json:"-" gorm:"foreignKey:PhotoID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to Photos
+}
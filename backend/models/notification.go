@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Notification types
+const (
+	NotificationTaggedInPhotos = "tagged_in_photos"
+	NotificationEventExpiring  = "event_expiring"
+	NotificationPhotoFavorited = "photo_favorited"
+	NotificationPhotoReaction  = "photo_reaction"
+	NotificationPhotoComment   = "photo_comment"
+	NotificationCommentReply   = "comment_reply"
+)
+
+type Notification struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Type      string     `json:"type" gorm:"not null"`
+	Data      *string    `json:"data" gorm:"type:jsonb"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	UserID  uint `json:"user_id" gorm:"not null;index"` // foreign key
+	EventID uint `json:"event_id" gorm:"not null"`      // foreign key
+
+	User  User  `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`  // Relationship - Belongs to User
+	Event Event `json:"-" gorm:"foreignKey:EventID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to Event
+}
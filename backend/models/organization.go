@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Organization membership roles
+const (
+	OrgRoleOwner  = "owner"  // manages the organization, including other owners
+	OrgRoleAdmin  = "admin"  // manages members and has access to every organization event
+	OrgRoleMember = "member" // can create organization events, sees only the events they are in
+)
+
+// Roles with implicit access to every event an organization owns
+var OrgAdminRoles = []string{OrgRoleOwner, OrgRoleAdmin}
+
+// A studio or team that owns events on behalf of its members, with one shared quota plan
+type Organization struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"not null"`
+	Plan      string    `json:"plan" gorm:"not null;default:free"` // quota plan shared by the organization's events
+	CreatedAt time.Time `json:"created_at"`
+
+	Members []OrganizationMember `json:"-" gorm:"foreignKey:OrganizationID;constraint:OnDelete:CASCADE;"` // One to Many relationship with OrganizationMembers
+	Events  []Event              `json:"-" gorm:"foreignKey:OrganizationID;constraint:OnDelete:SET NULL;"`
+}
+
+// A user's membership of an organization
+type OrganizationMember struct {
+	OrganizationID uint      `json:"organization_id" gorm:"primaryKey"`
+	UserID         uint      `json:"user_id" gorm:"primaryKey;index"`
+	Role           string    `json:"role" gorm:"not null;default:member"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	User User `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to User
+}
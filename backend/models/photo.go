@@ -1,8 +1,14 @@
 package models
 
+import "gorm.io/gorm"
+
 type Photos struct {
-	ID         uint   `json:"id" gorm:"primaryKey"`
-	StorageKey string `json:"storage_key" gorm:"not null;uniqueIndex"`
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	StorageKey string         `json:"storage_key" gorm:"not null;uniqueIndex"`
+	SizeBytes  int64          `json:"size_bytes" gorm:"not null;default:0"`
+	BlurredKey string         `json:"-" gorm:"not null;default:''"`      // copy with opted out faces blurred, empty when no one in the photo opted out
+	NeedsBlur  bool           `json:"-" gorm:"not null;default:false"`   // opted out faces are not blurred yet, restricted viewers get a placeholder
+	DeletedAt  gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"` // soft delete, purged after the trash retention window
 
 	EventID    uint `json:"event_id" gorm:"not null"`    // foreign key
 	UploadedBy uint `json:"uploaded_by" gorm:"not null"` // foreign key
@@ -12,3 +18,11 @@ type Photos struct {
 	Event Event `json:"event" gorm:"foreignKey:EventID;references:ID;constraint:OnDelete:CASCADE"` // Relationship - Belongs to Events
 	User  User  `json:"user" gorm:"foreignKey:UploadedBy;references:ID"`                           // Relationship - Belongs to Users
 }
+
+// All S3 keys stored for a photo, including renditions
+func (p Photos) ObjectKeys() []string {
+	if p.BlurredKey == "" {
+		return []string{p.StorageKey}
+	}
+	return []string{p.StorageKey, p.BlurredKey}
+}
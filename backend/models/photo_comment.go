@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// A comment on a photo, replies point at the comment they answer and are deleted with it
+type PhotoComment struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Body      string    `json:"body" gorm:"type:text;not null"`
+	CreatedAt time.Time `json:"created_at"`
+
+	PhotoID  uint  `json:"photo_id" gorm:"not null;index"`   // foreign key
+	UserID   uint  `json:"user_id" gorm:"not null"`          // foreign key
+	ParentID *uint `json:"parent_id,omitempty" gorm:"index"` // foreign key, set for replies
+
+	Photo   Photos         `json:"-" gorm:"foreignKey:PhotoID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to Photos
+	User    User           `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`  // Relationship - Belongs to User
+	Replies []PhotoComment `json:"-" gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE;"`              // One to Many relationship with replies
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// An emoji reaction to a photo, a user can react with several different emoji
+type PhotoReaction struct {
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	PhotoID   uint      `json:"photo_id" gorm:"primaryKey;index"`
+	Emoji     string    `json:"emoji" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+
+	User  User   `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"`  // Relationship - Belongs to User
+	Photo Photos `json:"-" gorm:"foreignKey:PhotoID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to Photos
+}
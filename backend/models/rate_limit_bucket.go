@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Token bucket state for the shared rate limit store
+type RateLimitBucket struct {
+	Key       string    `json:"key" gorm:"primaryKey"`
+	Tokens    float64   `json:"tokens" gorm:"not null"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"index"`
+}
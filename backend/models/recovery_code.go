@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// A single use code that stands in for a TOTP code when the user has lost their authenticator
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	CodeHash  string     `json:"-" gorm:"not null"` // sha256 of the code, the code itself is only shown once
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	UserID uint `json:"user_id" gorm:"not null;index"` // foreign key
+
+	User User `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to User
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// A selfie a user enrolled so they are recognised automatically in new uploads
+type ReferenceFace struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	StorageKey string    `json:"storage_key" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	UserID uint `json:"user_id" gorm:"not null;index"` // foreign key
+
+	User User `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to User
+
+	Indexes []ReferenceFaceIndex `json:"-" gorm:"foreignKey:ReferenceFaceID;constraint:OnDelete:CASCADE;"` // One to Many relationship with ReferenceFaceIndexes
+}
+
+// A reference selfie indexed into one event's Rekognition collection
+type ReferenceFaceIndex struct {
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	RekognitionID string `json:"rekognition_id" gorm:"not null;uniqueIndex"`
+
+	ReferenceFaceID uint `json:"reference_face_id" gorm:"not null;uniqueIndex:idx_reference_face_event"` // foreign key
+	EventID         uint `json:"event_id" gorm:"not null;uniqueIndex:idx_reference_face_event;index"`    // foreign key
+
+	Event Event `json:"-" gorm:"foreignKey:EventID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to Event
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -8,15 +10,32 @@ import (
 type User struct {
 	ID       uint   `json:"id" gorm:"primaryKey"`
 	Email    string `json:"email" gorm:"uniqueIndex;not null"`
-	Password string `json:"-" gorm:"not null"`
+	Password string `json:"-" gorm:"not null"` // empty for users who only sign in with an external provider
 	Username string `json:"username"`
+	Plan     string `json:"plan" gorm:"not null;default:free"` // quota plan
+
+	EmailVerified   bool       `json:"email_verified" gorm:"not null;default:false"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	TOTPSecret    string     `json:"-"`                                          // base32 secret, set while enrolling and once enabled
+	TOTPEnabled   bool       `json:"totp_enabled" gorm:"not null;default:false"` // login needs a code from an authenticator app
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at,omitempty"`
+	TOTPLastStep  int64      `json:"-" gorm:"not null;default:0"` // time step of the last accepted code, so codes cannot be replayed
+
+	FailedLogins int        `json:"-" gorm:"not null;default:0"` // consecutive failed logins since the last success or lockout
+	LockedUntil  *time.Time `json:"-"`                           // login is refused until this time
+
+	RecognitionOptOut bool `json:"recognition_opt_out" gorm:"not null;default:false"` // opted out of face recognition in every event
 
 	Photos []Photos `json:"photos" gorm:"foreignKey:UploadedBy"` // One to Many relationship with Photos
 	Events []Event  `json:"events" gorm:"many2many:event_users"` // Many to Many relationship with Events
 }
 
-// Hash password before saving
+// Hash password before saving, an empty password is kept empty
 func (u *User) HashPassword() error {
+	if u.Password == "" {
+		return nil
+	}
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -25,12 +44,28 @@ func (u *User) HashPassword() error {
 	return nil
 }
 
-// Compare password to hashed password
+// Compare password to hashed password, always false for users without a password
 func (u *User) CheckPassword(password string) bool {
+	if !u.HasPassword() {
+		return false
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
 }
 
+// Whether the user can sign in with a password
+func (u *User) HasPassword() bool {
+	return u.Password != ""
+}
+
+// Check if login is locked, returns the time remaining
+func (u *User) LockedFor(now time.Time) (time.Duration, bool) {
+	if u.LockedUntil == nil || !u.LockedUntil.After(now) {
+		return 0, false
+	}
+	return u.LockedUntil.Sub(now), true
+}
+
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return u.HashPassword()
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// A login with an external OpenID Connect provider linked to a user
+type UserIdentity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Provider  string    `json:"provider" gorm:"not null;uniqueIndex:idx_identity_provider_subject"`
+	Subject   string    `json:"-" gorm:"not null;uniqueIndex:idx_identity_provider_subject"` // the provider's stable id for the user
+	Email     string    `json:"email"`                                                       // email the provider reported when linked
+	CreatedAt time.Time `json:"created_at"`
+
+	UserID uint `json:"user_id" gorm:"not null;index"` // foreign key
+
+	User User `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to User
+}
+
+// A pending OpenID Connect login, consumed by the provider's callback
+type OIDCLoginState struct {
+	State        string    `gorm:"primaryKey"`
+	Provider     string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"` // PKCE verifier, only its challenge is sent to the provider
+	Nonce        string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Webhook struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	URL        string    `json:"url" gorm:"not null"`
+	Secret     string    `json:"-" gorm:"not null"`
+	EventTypes string    `json:"event_types" gorm:"not null"` // comma separated list of subscribed event types
+	CreatedAt  time.Time `json:"created_at"`
+
+	EventID   uint `json:"event_id" gorm:"not null;index"` // foreign key
+	CreatedBy uint `json:"created_by" gorm:"not null"`     // foreign key
+
+	Event Event `json:"-" gorm:"foreignKey:EventID;references:ID;constraint:OnDelete:CASCADE;"`   // Relationship - Belongs to Event
+	User  User  `json:"-" gorm:"foreignKey:CreatedBy;references:ID;constraint:OnDelete:CASCADE;"` // Relationship - Belongs to User
+
+	Deliveries []WebhookDelivery `json:"-" gorm:"foreignKey:WebhookID;constraint:OnDelete:CASCADE;"` // One to Many relationship with WebhookDeliveries
+}
+
+// Check if the webhook is subscribed to an event type
+func (w *Webhook) Subscribes(eventType string) bool {
+	for _, t := range strings.Split(w.EventTypes, ",") {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Outbox entry for a single webhook delivery, also acts as the delivery log
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	EventType      string     `json:"event_type" gorm:"not null"`
+	Payload        string     `json:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"not null;default:pending;index:idx_webhook_delivery_due,priority:1"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_webhook_delivery_due,priority:2"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	WebhookID uint `json:"webhook_id" gorm:"not null;index"` // foreign key
+
+	Webhook    Webhook          `json:"-" gorm:"foreignKey:WebhookID;references:ID;constraint:OnDelete:CASCADE;"`        // Relationship - Belongs to Webhook
+	AttemptLog []WebhookAttempt `json:"attempt_log,omitempty" gorm:"foreignKey:DeliveryID;constraint:OnDelete:CASCADE;"` // One to Many relationship with WebhookAttempts
+}
+
+// Log entry for each attempt to send a delivery
+type WebhookAttempt struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	StatusCode  int       `json:"status_code"`
+	Error       string    `json:"error"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+
+	DeliveryID uint `json:"delivery_id" gorm:"not null;index"` // foreign key
+}
@@ -1,32 +1,98 @@
 package routes
 
 import (
+	"github.com/Rynoo1/PicSort/backend/config"
 	"github.com/Rynoo1/PicSort/backend/handlers"
 	"github.com/Rynoo1/PicSort/backend/middleware"
+	"github.com/Rynoo1/PicSort/backend/models"
 	"github.com/Rynoo1/PicSort/backend/services"
+	"github.com/Rynoo1/PicSort/backend/services/ratelimit"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(app *fiber.App, svc *services.AppServices, db *gorm.DB, authService *services.AuthService) {
-	authHandler := handlers.NewAuthHandler(db, authService, svc.UserService)
+func SetupRoutes(app *fiber.App, svc *services.AppServices, db *gorm.DB, authService *services.AuthService, limits config.RateLimitConfig, limitStore ratelimit.Store) {
+	authHandler := handlers.NewAuthHandler(db, authService, svc.UserService, svc.VerificationService, svc.OIDCService, svc.TwoFactorService)
+
+	// Tag every request with an X-Request-ID, recorded in the audit log
+	app.Use(requestid.New())
+
+	// Rate limits - per IP on public routes, per user and per event on paid/expensive routes
+	registerLimit := middleware.RateLimit(limitStore,
+		middleware.RateRule{Name: "register-ip", Limit: limits.RegisterPerIP, Key: middleware.ByIP},
+	)
+	loginLimit := middleware.RateLimit(limitStore,
+		middleware.RateRule{Name: "login-ip", Limit: limits.LoginPerIP, Key: middleware.ByIP},
+	)
+	searchLimit := middleware.RateLimit(limitStore,
+		middleware.RateRule{Name: "search-user", Limit: limits.SearchPerUser, Key: middleware.ByUser},
+		middleware.RateRule{Name: "search-event", Limit: limits.SearchPerEvent, Key: middleware.ByEventMember("event_id", svc.EventRepo.CheckAccess)},
+	)
+	verifyLimit := middleware.RateLimit(limitStore,
+		middleware.RateRule{Name: "verify-user", Limit: limits.VerifyPerUser, Key: middleware.ByUser},
+	)
+	shareLimit := middleware.RateLimit(limitStore,
+		middleware.RateRule{Name: "share-ip", Limit: limits.SharePerIP, Key: middleware.ByIP},
+	)
+	uploadLimit := middleware.RateLimit(limitStore,
+		middleware.RateRule{Name: "upload-user", Limit: limits.UploadPerUser, Key: middleware.ByUser, Cost: middleware.CostBodyList("files")},
+		middleware.RateRule{Name: "upload-event", Limit: limits.UploadPerEvent, Key: middleware.ByEventMember("prefix", svc.EventRepo.CheckAccess), Cost: middleware.CostBodyList("files")},
+	)
 
 	// Public Routes
-	app.Post("/auth/register", authHandler.Register)
-	app.Post("/auth/login", authHandler.Login)
+	app.Post("/auth/register", registerLimit, authHandler.Register)
+	app.Post("/auth/login", loginLimit, authHandler.Login)
+	app.Post("/auth/login/2fa", loginLimit, authHandler.LoginTwoFactor) // challenge_token; code
+
+	// Verify email address - token from the emailed link
+	app.Get("/auth/verify-email", authHandler.VerifyEmail) // ?token=
+	app.Post("/auth/verify-email", authHandler.VerifyEmail)
+
+	// Login with an external OpenID Connect provider - start redirects to the provider, which redirects back to callback
+	app.Get("/auth/oidc/providers", authHandler.OIDCProviders)
+	app.Get("/auth/oidc/:provider/start", loginLimit, authHandler.OIDCStart) // ?login_hint= optional
+	app.Get("/auth/oidc/:provider/callback", authHandler.OIDCCallback)       // ?code=&state= from the provider
+
+	// Shared albums - anyone with the link can view and download, blurred copies are served where they exist
+	app.Get("/share/albums/:token", shareLimit, func(c *fiber.Ctx) error {
+		return handlers.ReturnSharedAlbum(c, svc)
+	})
+	app.Get("/share/albums/:token/download", shareLimit, func(c *fiber.Ctx) error {
+		return handlers.DownloadSharedAlbum(c, svc)
+	})
+
+	// Routes API keys can call and the scope they need, every other route needs a login token.
+	// Event gives the event a request is for, routes without one cannot be used by keys limited to an event.
+	apiKeyRoutes := middleware.APIKeyRoutes{
+		"/api/image/upload-URL":       {Scope: models.APIKeyScopeUpload, Event: middleware.ByRequestField("prefix")},
+		"/api/image/processing-batch": {Scope: models.APIKeyScopeUpload, Event: middleware.ByRequestField("event_id")},
+		"/api/event/all":              {Scope: models.APIKeyScopeRead},
+		"/api/event/eventdata":        {Scope: models.APIKeyScopeRead, Event: middleware.ByRequestField("event_id")},
+		"/api/event/eventmeta":        {Scope: models.APIKeyScopeRead, Event: middleware.ByRequestField("event_id")},
+		"/api/event/people":           {Scope: models.APIKeyScopeRead, Event: middleware.ByRequestField("event_id")},
+		"/api/event/people-photos":    {Scope: models.APIKeyScopeRead, Event: middleware.ByRequestField("event_id")},
+		"/api/event/person-images":    {Scope: models.APIKeyScopeRead},
+		"/api/event/subscribe":        {Scope: models.APIKeyScopeRead, Event: middleware.ByRequestField("event_id")},
+		"/api/user/my-photos":         {Scope: models.APIKeyScopeRead},
+		"/api/album/all":              {Scope: models.APIKeyScopeRead, Event: middleware.ByRequestField("event_id")},
+		"/api/album/photos":           {Scope: models.APIKeyScopeRead},
+		"/api/user/favorites":         {Scope: models.APIKeyScopeRead},
+		"/api/photo/comments":         {Scope: models.APIKeyScopeRead},
+	}
 
 	// Protected Routes
-	protected := app.Group("/api", middleware.AuthMiddleware(db, authService))
+	protected := app.Group("/api", middleware.AuthMiddleware(db, authService, svc.APIKeyService, apiKeyRoutes))
 
 	// **IMAGES**
 	// Batch image pipeline
 	protected.Post("/image/processing-batch", func(c *fiber.Ctx) error {
-		return handlers.ImageProcessingBatch(c, svc.ImageService)
+		return handlers.ImageProcessingBatch(c, svc)
 	})
 
 	// Generate upload URLs
-	protected.Post("/image/upload-URL", func(c *fiber.Ctx) error {
-		return handlers.GenerateUploadURLs(c, svc.S3Service)
+	protected.Post("/image/upload-URL", uploadLimit, func(c *fiber.Ctx) error { // []files{filename; content_type; size}; prefix (event_id)
+		return handlers.GenerateUploadURLs(c, svc, limits.MaxUploadFiles)
 	})
 
 	// Delete image
@@ -36,7 +102,7 @@ func SetupRoutes(app *fiber.App, svc *services.AppServices, db *gorm.DB, authSer
 
 	// **EVENTS**  all images?
 	// Create event
-	protected.Post("/event/create", func(c *fiber.Ctx) error { // event_mame; []user_ids
+	protected.Post("/event/create", func(c *fiber.Ctx) error { // event_mame; []user_ids; organization_id, description, location, starts_at, ends_at optional
 		return handlers.CreateEvent(c, svc)
 	})
 
@@ -45,34 +111,64 @@ func SetupRoutes(app *fiber.App, svc *services.AppServices, db *gorm.DB, authSer
 		return handlers.DeleteEvent(c, svc)
 	})
 
-	// Rename event
+	// Rename event - superseded by /event/update
 	protected.Post("/event/rename", func(c *fiber.Ctx) error { // event_id; new_name
 		return handlers.RenameEvent(c, svc)
 	})
 
+	// Update event details, only the fields sent are changed
+	protected.Post("/event/update", func(c *fiber.Ctx) error { // event_id; event_name, description, location, starts_at, ends_at, cover_photo_id, visibility (members/organization) optional; []clear
+		return handlers.UpdateEvent(c, svc)
+	})
+
 	// Return all info for all events for user
 	protected.Post("/event/all", func(c *fiber.Ctx) error {
 		return handlers.ReturnAllEvents(c, svc)
 	})
 
+	// Event read endpoints send ETag/Last-Modified from the event updated_at and answer
+	// If-None-Match/If-Modified-Since with 304. GET variants take the same fields as query params.
 	// Return all images and people for specific event
-	protected.Post("/event/eventdata", func(c *fiber.Ctx) error {
+	eventData := func(c *fiber.Ctx) error {
 		return handlers.ReturnEventData(c, svc)
-	})
+	}
+	protected.Post("/event/eventdata", eventData)
+	protected.Get("/event/eventdata", eventData)
 
 	// Return event updated at value
-	protected.Post("/event/eventmeta", func(c *fiber.Ctx) error {
+	eventMeta := func(c *fiber.Ctx) error {
 		return handlers.ReturnMeta(c, svc)
-	})
+	}
+	protected.Post("/event/eventmeta", eventMeta)
+	protected.Get("/event/eventmeta", eventMeta)
 
 	// Return all images for specific event person
-	protected.Post("/event/person-images", func(c *fiber.Ctx) error { // event_person_id; event_id
+	personImages := func(c *fiber.Ctx) error { // event_person_id; event_id
 		return handlers.ReturnAllEventPersonImages(c, svc)
+	}
+	protected.Post("/event/person-images", personImages)
+	protected.Get("/event/person-images", personImages)
+
+	// Return photos with all included people and none of the excluded
+	protected.Post("/event/people-photos", func(c *fiber.Ctx) error { // event_id; []include; []exclude; face_count; min_faces
+		return handlers.SearchPeoplePhotos(c, svc)
 	})
 
 	// Return all event_person names and ids for specific event
-	protected.Post("/event/people", func(c *fiber.Ctx) error { // event_id
+	eventPeople := func(c *fiber.Ctx) error { // event_id
 		return handlers.ReturnAllPeople(c, svc)
+	}
+	protected.Post("/event/people", eventPeople)
+	protected.Get("/event/people", eventPeople)
+
+	// Return audit history for an event - event owner only
+	protected.Post("/event/history", func(c *fiber.Ctx) error { // event_id; before_id; limit
+		return handlers.ReturnEventHistory(c, svc)
+	})
+
+	// Stream live updates for an event (Server-Sent Events)
+	protected.Get("/event/subscribe", func(c *fiber.Ctx) error { // ?event_id=
+		return handlers.SubscribeEvent(c, svc)
 	})
 
 	// Add users to events
@@ -85,6 +181,130 @@ func SetupRoutes(app *fiber.App, svc *services.AppServices, db *gorm.DB, authSer
 		return handlers.UpdatePersonName(c, svc)
 	})
 
+	// Link logged in user to an event person
+	protected.Post("/event/person/claim", func(c *fiber.Ctx) error { // person_id
+		return handlers.ClaimPerson(c, svc)
+	})
+
+	// Link an event member to an event person - event owner only
+	protected.Post("/event/person/assign", func(c *fiber.Ctx) error { // person_id; user_id (0 to unlink)
+		return handlers.AssignPerson(c, svc)
+	})
+
+	// Flag event person as do not recognise - event owner or linked user
+	protected.Post("/event/person/do-not-recognize", func(c *fiber.Ctx) error { // person_id; do_not_recognize
+		return handlers.SetDoNotRecognize(c, svc)
+	})
+
+	// Change event face recognition mode - event owner only
+	protected.Post("/event/recognition", func(c *fiber.Ctx) error { // event_id; mode (all/consent/off)
+		return handlers.SetRecognitionMode(c, svc)
+	})
+
+	// Set event expiry - event owner only
+	protected.Post("/event/retention", func(c *fiber.Ctx) error { // event_id; expires_at or retention_days (neither clears); action (delete/archive)
+		return handlers.SetEventRetention(c, svc)
+	})
+
+	// **CONSENT**
+	// Return face recognition consent settings
+	consent := func(c *fiber.Ctx) error { // user in locals
+		return handlers.ReturnConsent(c, svc)
+	}
+	protected.Post("/consent", consent)
+	protected.Get("/consent", consent)
+
+	// Opt in/out of face recognition in every event
+	protected.Post("/consent/user", func(c *fiber.Ctx) error { // opt_out
+		return handlers.SetUserConsent(c, svc)
+	})
+
+	// Opt in/out of face recognition in one event
+	protected.Post("/consent/event", func(c *fiber.Ctx) error { // event_id; opt_out
+		return handlers.SetEventConsent(c, svc)
+	})
+
+	// **REFERENCE SELFIES**
+	// Upload reference selfie
+	protected.Post("/reference/upload-url", func(c *fiber.Ctx) error { // filename; content_type
+		return handlers.GetReferenceUpload(c, svc)
+	})
+
+	// Enroll uploaded reference selfie
+	protected.Post("/reference/enroll", func(c *fiber.Ctx) error { // storage_key
+		return handlers.EnrollReference(c, svc)
+	})
+
+	// Return all reference selfies
+	protected.Post("/reference/all", func(c *fiber.Ctx) error { // user in locals
+		return handlers.ReturnReferences(c, svc)
+	})
+
+	// Delete reference selfie
+	protected.Post("/reference/delete", func(c *fiber.Ctx) error { // reference_id
+		return handlers.DeleteReference(c, svc)
+	})
+
+	// **NOTIFICATIONS**
+	// Return recent notifications
+	notifications := func(c *fiber.Ctx) error { // unread_only optional
+		return handlers.ReturnNotifications(c, svc)
+	}
+	protected.Post("/notifications", notifications)
+	protected.Get("/notifications", notifications)
+
+	// Mark notifications as read
+	protected.Post("/notifications/read", func(c *fiber.Ctx) error { // []ids (empty for all)
+		return handlers.MarkNotificationsRead(c, svc)
+	})
+
+	// Stream new notifications (Server-Sent Events)
+	protected.Get("/notifications/subscribe", func(c *fiber.Ctx) error {
+		return handlers.SubscribeNotifications(c, svc)
+	})
+
+	// **TRASH**
+	// Return deleted events, and deleted photos for an event
+	protected.Post("/trash", func(c *fiber.Ctx) error { // event_id (optional)
+		return handlers.ReturnTrash(c, svc)
+	})
+
+	// Restore photo from trash
+	protected.Post("/trash/restore-photo", func(c *fiber.Ctx) error { // photo_id
+		return handlers.RestorePhoto(c, svc)
+	})
+
+	// Restore event from trash - event owner only
+	protected.Post("/trash/restore-event", func(c *fiber.Ctx) error { // event_id
+		return handlers.RestoreEvent(c, svc)
+	})
+
+	// **WEBHOOKS** - event owner only
+	// Register webhook
+	protected.Post("/webhook/create", func(c *fiber.Ctx) error { // event_id; url; []event_types
+		return handlers.CreateWebhook(c, svc)
+	})
+
+	// Return all webhooks for an event
+	protected.Post("/webhook/all", func(c *fiber.Ctx) error { // event_id
+		return handlers.ReturnWebhooks(c, svc)
+	})
+
+	// Delete webhook
+	protected.Post("/webhook/delete", func(c *fiber.Ctx) error { // webhook_id
+		return handlers.DeleteWebhook(c, svc)
+	})
+
+	// Return delivery log for a webhook
+	protected.Post("/webhook/deliveries", func(c *fiber.Ctx) error { // webhook_id
+		return handlers.ReturnWebhookDeliveries(c, svc)
+	})
+
+	// Replay a delivery
+	protected.Post("/webhook/replay", func(c *fiber.Ctx) error { // delivery_id
+		return handlers.ReplayWebhookDelivery(c, svc)
+	})
+
 	// **USER**
 	// Return all events for specific user
 	protected.Post("/user/events", func(c *fiber.Ctx) error { // user in locals
@@ -97,13 +317,193 @@ func SetupRoutes(app *fiber.App, svc *services.AppServices, db *gorm.DB, authSer
 	})
 
 	// Upload search image
-	protected.Post("/search/upload-url", func(c *fiber.Ctx) error { // event_id, filename; content_type
-		return handlers.GetSearchUpload(c, svc.S3Service)
+	protected.Post("/search/upload-url", searchLimit, func(c *fiber.Ctx) error { // event_id optional; content_type
+		return handlers.GetSearchUpload(c, svc)
 	})
 
 	// Search using image
-	protected.Post("/search", func(c *fiber.Ctx) error { // storage_key; event_id
-		return handlers.SearchCollection(c, svc.ImageService)
+	protected.Post("/search", searchLimit, func(c *fiber.Ctx) error { // storage_key; event_id; threshold optional; mode single/group
+		return handlers.SearchCollection(c, svc)
+	})
+
+	// Return quota usage
+	protected.Post("/usage", func(c *fiber.Ctx) error { // event_id optional
+		return handlers.ReturnUsage(c, svc)
+	})
+
+	// Search every event the user is in using image
+	protected.Post("/search/find-me", searchLimit, func(c *fiber.Ctx) error { // storage_key; threshold optional
+		return handlers.FindMe(c, svc)
+	})
+
+	// Return all photos of the logged in user across their events
+	myPhotos := func(c *fiber.Ctx) error { // user in locals
+		return handlers.MyPhotos(c, svc)
+	}
+	protected.Post("/user/my-photos", myPhotos)
+	protected.Get("/user/my-photos", myPhotos)
+
+	// Return the logged in user's favorite photos across their events
+	myFavorites := func(c *fiber.Ctx) error { // user in locals
+		return handlers.MyFavorites(c, svc)
+	}
+	protected.Post("/user/favorites", myFavorites)
+	protected.Get("/user/favorites", myFavorites)
+
+	// Resend email verification link
+	protected.Post("/user/resend-verification", verifyLimit, func(c *fiber.Ctx) error { // user in locals
+		return handlers.ResendVerification(c, svc)
+	})
+
+	// Export all personal data as a zip archive
+	protected.Post("/user/export", func(c *fiber.Ctx) error { // user in locals
+		return handlers.ExportAccount(c, svc)
+	})
+
+	// Two-factor authentication - enroll returns a secret, confirm turns it on with a code from the app
+	protected.Get("/user/2fa", func(c *fiber.Ctx) error { // user in locals
+		return handlers.TwoFactorStatus(c, svc)
+	})
+	protected.Post("/user/2fa/enroll", func(c *fiber.Ctx) error { // user in locals
+		return handlers.BeginTwoFactor(c, svc)
+	})
+	protected.Post("/user/2fa/confirm", loginLimit, func(c *fiber.Ctx) error { // code
+		return handlers.ConfirmTwoFactor(c, svc)
+	})
+	protected.Post("/user/2fa/disable", loginLimit, func(c *fiber.Ctx) error { // code (TOTP or recovery code)
+		return handlers.DisableTwoFactor(c, svc)
+	})
+	protected.Post("/user/2fa/recovery-codes", loginLimit, func(c *fiber.Ctx) error { // code (TOTP or recovery code)
+		return handlers.RegenerateRecoveryCodes(c, svc)
+	})
+
+	// Personal API keys - login token only, keys cannot manage keys
+	apiKeys := func(c *fiber.Ctx) error { // user in locals
+		return handlers.ListAPIKeys(c, svc)
+	}
+	protected.Post("/user/api-keys", apiKeys)
+	protected.Get("/user/api-keys", apiKeys)
+	protected.Post("/user/api-keys/create", func(c *fiber.Ctx) error { // name; scope (read/upload); event_id optional; expires_at or expires_in_days optional
+		return handlers.CreateAPIKey(c, svc)
+	})
+	protected.Post("/user/api-keys/revoke", func(c *fiber.Ctx) error { // key_id
+		return handlers.RevokeAPIKey(c, svc)
+	})
+
+	// **ALBUMS** - members view and download, event owners manage albums and share links
+	protected.Post("/album/create", func(c *fiber.Ctx) error { // event_id; name
+		return handlers.CreateAlbum(c, svc)
+	})
+	albums := func(c *fiber.Ctx) error { // event_id
+		return handlers.ReturnAlbums(c, svc)
+	}
+	protected.Post("/album/all", albums)
+	protected.Get("/album/all", albums)
+	albumPhotos := func(c *fiber.Ctx) error { // album_id
+		return handlers.ReturnAlbumPhotos(c, svc)
+	}
+	protected.Post("/album/photos", albumPhotos)
+	protected.Get("/album/photos", albumPhotos)
+	protected.Post("/album/rename", func(c *fiber.Ctx) error { // album_id; name
+		return handlers.RenameAlbum(c, svc)
+	})
+	protected.Post("/album/delete", func(c *fiber.Ctx) error { // album_id
+		return handlers.DeleteAlbum(c, svc)
+	})
+	protected.Post("/album/reorder", func(c *fiber.Ctx) error { // event_id; []album_ids
+		return handlers.ReorderAlbums(c, svc)
+	})
+	protected.Post("/album/add-photos", func(c *fiber.Ctx) error { // album_id; []photo_ids
+		return handlers.AddAlbumPhotos(c, svc)
+	})
+	protected.Post("/album/remove-photos", func(c *fiber.Ctx) error { // album_id; []photo_ids
+		return handlers.RemoveAlbumPhotos(c, svc)
+	})
+	protected.Post("/album/reorder-photos", func(c *fiber.Ctx) error { // album_id; []photo_ids
+		return handlers.ReorderAlbumPhotos(c, svc)
+	})
+	protected.Post("/album/download", func(c *fiber.Ctx) error { // album_id
+		return handlers.DownloadAlbum(c, svc)
+	})
+	protected.Post("/album/share", func(c *fiber.Ctx) error { // album_id; expires_at or expires_in_days optional
+		return handlers.ShareAlbum(c, svc)
+	})
+	albumShares := func(c *fiber.Ctx) error { // album_id
+		return handlers.ReturnAlbumShares(c, svc)
+	}
+	protected.Post("/album/shares", albumShares)
+	protected.Get("/album/shares", albumShares)
+	protected.Post("/album/share/revoke", func(c *fiber.Ctx) error { // album_id; share_id
+		return handlers.RevokeAlbumShare(c, svc)
+	})
+
+	// **PHOTO FEEDBACK** - members favorite, react and comment, the uploader is notified, event owners can remove any comment
+	protected.Post("/photo/favorite", func(c *fiber.Ctx) error { // photo_id
+		return handlers.FavoritePhoto(c, svc)
+	})
+	protected.Post("/photo/unfavorite", func(c *fiber.Ctx) error { // photo_id
+		return handlers.UnfavoritePhoto(c, svc)
+	})
+	protected.Post("/photo/react", func(c *fiber.Ctx) error { // photo_id; emoji
+		return handlers.ReactToPhoto(c, svc)
+	})
+	protected.Post("/photo/unreact", func(c *fiber.Ctx) error { // photo_id; emoji
+		return handlers.UnreactToPhoto(c, svc)
+	})
+	protected.Post("/photo/comment", func(c *fiber.Ctx) error { // photo_id; body; parent_id optional
+		return handlers.CommentOnPhoto(c, svc)
+	})
+	photoComments := func(c *fiber.Ctx) error { // photo_id
+		return handlers.ReturnPhotoComments(c, svc)
+	}
+	protected.Post("/photo/comments", photoComments)
+	protected.Get("/photo/comments", photoComments)
+	protected.Post("/photo/comment/delete", func(c *fiber.Ctx) error { // comment_id
+		return handlers.DeletePhotoComment(c, svc)
+	})
+
+	// **ORGANIZATIONS** - owners and admins can open every event the organization owns
+	protected.Post("/org/create", func(c *fiber.Ctx) error { // name
+		return handlers.CreateOrganization(c, svc)
+	})
+	orgs := func(c *fiber.Ctx) error { // user in locals
+		return handlers.ReturnOrganizations(c, svc)
+	}
+	protected.Post("/org/all", orgs)
+	protected.Get("/org/all", orgs)
+	orgMembers := func(c *fiber.Ctx) error { // organization_id
+		return handlers.ReturnOrgMembers(c, svc)
+	}
+	protected.Post("/org/members", orgMembers)
+	protected.Get("/org/members", orgMembers)
+	protected.Post("/org/addmembers", func(c *fiber.Ctx) error { // organization_id; []user_ids; role optional (owner/admin/member)
+		return handlers.AddOrgMembers(c, svc)
+	})
+	protected.Post("/org/set-role", func(c *fiber.Ctx) error { // organization_id; user_id; role
+		return handlers.SetOrgRole(c, svc)
+	})
+	protected.Post("/org/remove-member", func(c *fiber.Ctx) error { // organization_id; user_id
+		return handlers.RemoveOrgMember(c, svc)
+	})
+	orgEvents := func(c *fiber.Ctx) error { // organization_id
+		return handlers.ReturnOrgEvents(c, svc)
+	}
+	protected.Post("/org/events", orgEvents)
+	protected.Get("/org/events", orgEvents)
+	orgUsage := func(c *fiber.Ctx) error { // organization_id
+		return handlers.ReturnOrgUsage(c, svc)
+	}
+	protected.Post("/org/usage", orgUsage)
+	protected.Get("/org/usage", orgUsage)
+
+	// Move an event into an organization or back out of it
+	protected.Post("/event/organization", func(c *fiber.Ctx) error { // event_id; organization_id (0 to detach)
+		return handlers.SetEventOrganization(c, svc)
+	})
+
+	// Permanently delete account
+	protected.Post("/user/delete", func(c *fiber.Ctx) error { // password (or email without one); uploads (delete/reassign)
+		return handlers.DeleteAccount(c, svc)
 	})
 
 	// Search users
@@ -111,7 +511,6 @@ func SetupRoutes(app *fiber.App, svc *services.AppServices, db *gorm.DB, authSer
 		return handlers.SearchUsers(c, svc)
 	})
 
-	// TODO: Remove a user
 	// TODO: Leave event
 	// TODO: Download images?
 }
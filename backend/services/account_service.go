@@ -0,0 +1,292 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/google/uuid"
+)
+
+// What happens to a deleted user's uploads in events that other members keep
+const (
+	UploadsDelete   = "delete"   // photos are purged
+	UploadsReassign = "reassign" // photos are handed to an owner of the event
+)
+
+const accountPurgeBatchSize = 200
+
+var ErrUploadsMode = errors.New("uploads must be delete or reassign")
+
+// Personal data export and account deletion
+type AccountService struct {
+	AccountRepo      *db.AccountRepo
+	ReferenceRepo    *db.ReferenceRepo
+	ImageService     *ImageService
+	EventService     *EventService
+	ConsentService   *ConsentService
+	ReferenceService *ReferenceService
+	S3Service        *S3Service
+}
+
+// A finished export ready to download
+type AccountExport struct {
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// S3 prefix for a user's data exports
+func ExportPrefix(userId uint) string {
+	return fmt.Sprintf("exports/%d/", userId)
+}
+
+// Bundle everything held about a user into a zip archive and return a presigned link to it.
+// The archive has a json file per record type plus the original photos and reference selfies.
+func (s *AccountService) Export(ctx context.Context, user *models.User) (*AccountExport, error) {
+	bucketName := os.Getenv("BUCKET_NAME")
+
+	file, err := os.CreateTemp("", "picsort-export-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := s.writeExport(ctx, zip.NewWriter(file), user); err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("failed to rewind export file: %w", err)
+	}
+
+	key := fmt.Sprintf("%s%s-%s.zip", ExportPrefix(user.ID), time.Now().UTC().Format("20060102-150405"), uuid.NewString())
+	if err := s.S3Service.PutObject(ctx, bucketName, key, "application/zip", file); err != nil {
+		return nil, err
+	}
+
+	url, err := s.S3Service.PresignGetObject(ctx, bucketName, key)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[ACCOUNT] exported data for user %d to %s", user.ID, key)
+	return &AccountExport{
+		URL:       url,
+		ExpiresAt: time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (s *AccountService) writeExport(ctx context.Context, archive *zip.Writer, user *models.User) error {
+	memberships, err := s.AccountRepo.FindMemberships(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find memberships: %w", err)
+	}
+	photos, err := s.AccountRepo.FindUploadedPhotos(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find uploaded photos: %w", err)
+	}
+	detections, err := s.AccountRepo.FindLinkedDetections(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find face detections: %w", err)
+	}
+	audit, err := s.AccountRepo.FindAuditEntries(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find audit entries: %w", err)
+	}
+	consent, err := s.AccountRepo.FindConsentRecords(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find consent records: %w", err)
+	}
+	notifications, err := s.AccountRepo.FindNotifications(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find notifications: %w", err)
+	}
+	identities, err := s.AccountRepo.FindIdentities(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find linked logins: %w", err)
+	}
+	apiKeys, err := s.AccountRepo.FindAPIKeys(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find API keys: %w", err)
+	}
+	organizations, err := s.AccountRepo.FindOrganizations(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find organizations: %w", err)
+	}
+	favorites, err := s.AccountRepo.FindFavorites(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find favorites: %w", err)
+	}
+	reactions, err := s.AccountRepo.FindReactions(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find reactions: %w", err)
+	}
+	comments, err := s.AccountRepo.FindComments(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find comments: %w", err)
+	}
+	references, err := s.ReferenceRepo.FindUserReferences(user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find reference selfies: %w", err)
+	}
+
+	records := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"memberships.json", memberships},
+		{"photos.json", photos},
+		{"face_detections.json", detections},
+		{"audit_log.json", audit},
+		{"consent_records.json", consent},
+		{"notifications.json", notifications},
+		{"linked_logins.json", identities},
+		{"api_keys.json", apiKeys},
+		{"organizations.json", organizations},
+		{"favorites.json", favorites},
+		{"reactions.json", reactions},
+		{"comments.json", comments},
+		{"reference_selfies.json", references},
+	}
+	for _, record := range records {
+		w, err := archive.Create(record.name)
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", record.name, err)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(record.data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", record.name, err)
+		}
+	}
+
+	for _, photo := range photos {
+		name := fmt.Sprintf("photos/%d/%d-%s", photo.EventId, photo.ID, path.Base(photo.StorageKey))
+		s.addObject(ctx, archive, name, photo.StorageKey)
+	}
+	for _, ref := range references {
+		name := fmt.Sprintf("reference_selfies/%d-%s", ref.ID, path.Base(ref.StorageKey))
+		s.addObject(ctx, archive, name, ref.StorageKey)
+	}
+
+	return archive.Close()
+}
+
+// Copy an S3 object into the archive, objects that cannot be read are logged and left out
+func (s *AccountService) addObject(ctx context.Context, archive *zip.Writer, name, key string) {
+	data, err := s.S3Service.GetObjectBytes(ctx, os.Getenv("BUCKET_NAME"), key)
+	if err != nil {
+		log.Printf("[ACCOUNT] skipping %s in export: %v", key, err)
+		return
+	}
+
+	w, err := archive.Create(name)
+	if err != nil {
+		log.Printf("[ACCOUNT] failed to add %s to export: %v", name, err)
+		return
+	}
+	if _, err := w.Write(data); err != nil {
+		log.Printf("[ACCOUNT] failed to write %s to export: %v", name, err)
+	}
+}
+
+// Permanently delete a user. Events no one else can access are purged, in the rest their uploads are
+// purged or handed to the next owner, and their biometric data is removed from every collection.
+func (s *AccountService) DeleteAccount(ctx context.Context, userId uint, uploads string, actor db.Actor) error {
+	if uploads != UploadsDelete && uploads != UploadsReassign {
+		return ErrUploadsMode
+	}
+
+	memberships, err := s.AccountRepo.FindMemberships(userId)
+	if err != nil {
+		return fmt.Errorf("failed to find memberships: %w", err)
+	}
+
+	successors := make(map[uint]*models.EventUser)
+	promote := make(map[uint]bool)
+	for _, m := range memberships {
+		successor, err := s.AccountRepo.FindSuccessor(userId, m.EventId)
+		if err != nil {
+			return fmt.Errorf("failed to find successor for event %d: %w", m.EventId, err)
+		}
+		if successor == nil {
+			if err := s.EventService.PurgeEvent(ctx, m.EventId); err != nil {
+				return err
+			}
+			log.Printf("[ACCOUNT] purged event %d with user %d as the only member", m.EventId, userId)
+			continue
+		}
+		successors[m.EventId] = successor
+		// organization admins taking over have no membership to promote
+		promote[m.EventId] = m.Role == models.RoleOwner && successor.Role == models.RoleMember
+	}
+
+	// forget the user's face in the events that remain, suppression faces included
+	people, err := s.ConsentService.ConsentRepo.FindUserPeople(userId, 0)
+	if err != nil {
+		return err
+	}
+	for i := range people {
+		if err := s.ConsentService.ForgetPerson(ctx, &people[i], actor); err != nil {
+			return err
+		}
+	}
+	if err := s.ReferenceService.DeleteAll(ctx, userId); err != nil {
+		return err
+	}
+
+	// uploads in events the user already left have no one to hand them to, so they are purged either way
+	var keepEvents []uint
+	if uploads == UploadsReassign {
+		for eventId := range successors {
+			keepEvents = append(keepEvents, eventId)
+		}
+	}
+	if err := s.purgeUploads(ctx, userId, keepEvents); err != nil {
+		return err
+	}
+
+	if err := s.AccountRepo.DeleteAccount(userId, successors, promote); err != nil {
+		return fmt.Errorf("failed to delete user %d: %w", userId, err)
+	}
+
+	bucketName := os.Getenv("BUCKET_NAME")
+	exports, err := s.S3Service.ListKeys(ctx, bucketName, ExportPrefix(userId))
+	if err == nil {
+		err = s.S3Service.DeleteObjects(ctx, bucketName, exports)
+	}
+	if err != nil {
+		log.Printf("[ACCOUNT] failed to delete exports for user %d: %v", userId, err)
+	}
+
+	log.Printf("[ACCOUNT] deleted user %d", userId)
+	return nil
+}
+
+// Purge every photo a user uploaded outside the keepEvents events, including photos in the trash
+func (s *AccountService) purgeUploads(ctx context.Context, userId uint, keepEvents []uint) error {
+	for {
+		photos, err := s.AccountRepo.FindUploadedPhotoBatch(userId, keepEvents, accountPurgeBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to find uploaded photos: %w", err)
+		}
+		if len(photos) == 0 {
+			return nil
+		}
+		if err := s.ImageService.PurgePhotos(ctx, photos); err != nil {
+			return err
+		}
+		if len(photos) < accountPurgeBatchSize {
+			return nil
+		}
+	}
+}
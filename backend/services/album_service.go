@@ -0,0 +1,276 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+)
+
+const (
+	maxAlbumDownloadPhotos = 500
+	albumDownloadLifetime  = time.Hour      // presigned download links
+	albumDownloadRetention = 24 * time.Hour // archives are swept after this, and reused until shortly before it
+)
+
+var (
+	ErrAlbumName   = errors.New("album name is required")
+	ErrAlbumEmpty  = errors.New("album has no photos")
+	ErrAlbumLarge  = fmt.Errorf("albums of more than %d photos cannot be downloaded at once", maxAlbumDownloadPhotos)
+	ErrShareExpiry = errors.New("expiry must be in the future")
+	ErrShareLink   = errors.New("share link is invalid or has expired")
+)
+
+// Albums inside events, their downloads and public share links
+type AlbumService struct {
+	AlbumRepo        *db.AlbumRepo
+	RenditionService *RenditionService
+	S3Service        *S3Service
+	AppURL           string // base url of share links
+}
+
+// A photo in an album with its presigned view url
+type AlbumImage struct {
+	ID      uint   `json:"id"`
+	URL     string `json:"url"`
+	Expires string `json:"expires"`
+}
+
+// A finished album archive ready to download
+type AlbumDownload struct {
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// A new share link, the url is only shown this once
+type AlbumShareLink struct {
+	URL   string             `json:"url"`
+	Share *models.AlbumShare `json:"share"`
+}
+
+// S3 prefix for an album's zip downloads
+func AlbumDownloadPrefix(albumId uint) string {
+	return fmt.Sprintf("downloads/albums/%d/", albumId)
+}
+
+// Create an album at the end of an event's album list
+func (s *AlbumService) Create(eventId uint, name string, actor db.Actor) (*models.Album, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrAlbumName
+	}
+
+	album := &models.Album{Name: name, EventID: eventId}
+	if err := s.AlbumRepo.CreateAlbum(album, actor); err != nil {
+		return nil, fmt.Errorf("failed to create album: %w", err)
+	}
+	return album, nil
+}
+
+// Rename an album
+func (s *AlbumService) Rename(album *models.Album, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ErrAlbumName
+	}
+	return s.AlbumRepo.RenameAlbum(album.ID, name)
+}
+
+// Presigned view urls for an album's photos in order, through the same renditions as the event's photos.
+// viewerId 0 is someone with a share link, they see the blurred copy of every photo that has one.
+func (s *AlbumService) Photos(ctx context.Context, viewerId uint, album *models.Album) ([]AlbumImage, error) {
+	photos, err := s.AlbumRepo.FindAlbumPhotos(album.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find album photos: %w", err)
+	}
+
+	keys := make([]string, len(photos))
+	for i, photo := range photos {
+		keys[i] = photo.StorageKey
+	}
+	urls, err := s.RenditionService.PresignViewObjects(ctx, viewerId, keys, album.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]AlbumImage, len(photos))
+	for i, photo := range photos {
+		images[i] = AlbumImage{ID: photo.ID, URL: urls[i].URL, Expires: urls[i].ExpiresAt}
+	}
+	return images, nil
+}
+
+// Bundle an album's photos into a zip archive in album order and return a presigned link to it.
+// The archive holds the same renditions the viewer is shown, and is named after them so
+// repeat downloads of an unchanged album reuse it instead of packing it again.
+func (s *AlbumService) Download(ctx context.Context, viewerId uint, album *models.Album) (*AlbumDownload, error) {
+	bucketName := os.Getenv("BUCKET_NAME")
+
+	photos, err := s.AlbumRepo.FindAlbumPhotos(album.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find album photos: %w", err)
+	}
+	if len(photos) == 0 {
+		return nil, ErrAlbumEmpty
+	}
+	if len(photos) > maxAlbumDownloadPhotos {
+		return nil, ErrAlbumLarge
+	}
+
+	keys := make([]string, len(photos))
+	for i, photo := range photos {
+		keys[i] = photo.StorageKey
+	}
+	viewKeys, err := s.RenditionService.ViewKeys(viewerId, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find view keys: %w", err)
+	}
+
+	key := albumDownloadKey(album.ID, keys, viewKeys)
+	modified, err := s.S3Service.ObjectModified(ctx, bucketName, key)
+	if err == nil && time.Since(modified) < albumDownloadRetention-albumDownloadLifetime {
+		return s.presignDownload(ctx, bucketName, key)
+	}
+
+	file, err := os.CreateTemp("", "picsort-album-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create album file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	for i, photo := range photos {
+		name := fmt.Sprintf("%04d-%s", i+1, path.Base(photo.StorageKey))
+		// archives are reused by content, so a missing photo fails the download instead of being cached
+		if err := s.addObject(ctx, archive, name, viewKeys[i]); err != nil {
+			return nil, fmt.Errorf("failed to pack album %d: %w", album.ID, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write album archive: %w", err)
+	}
+	if _, err := file.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("failed to rewind album file: %w", err)
+	}
+
+	if err := s.S3Service.PutObject(ctx, bucketName, key, "application/zip", file); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[ALBUM] packed %d photos of album %d to %s", len(photos), album.ID, key)
+	return s.presignDownload(ctx, bucketName, key)
+}
+
+// Presign a link to an album archive
+func (s *AlbumService) presignDownload(ctx context.Context, bucketName, key string) (*AlbumDownload, error) {
+	url, err := s.S3Service.PresignGetObject(ctx, bucketName, key)
+	if err != nil {
+		return nil, err
+	}
+	return &AlbumDownload{
+		URL:       url,
+		ExpiresAt: time.Now().Add(albumDownloadLifetime).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// Delete album archives older than the retention window
+func (s *AlbumService) PurgeDownloads(ctx context.Context) error {
+	bucketName := os.Getenv("BUCKET_NAME")
+
+	keys, err := s.S3Service.ListKeysBefore(ctx, bucketName, "downloads/albums/", time.Now().Add(-albumDownloadRetention))
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := s.S3Service.DeleteObjects(ctx, bucketName, keys); err != nil {
+		return err
+	}
+	log.Printf("[ALBUM] deleted %d expired downloads", len(keys))
+	return nil
+}
+
+// Archive key for an album's photos in order and the renditions packed for them
+func albumDownloadKey(albumId uint, keys, viewKeys []string) string {
+	h := sha256.New()
+	for i := range keys {
+		fmt.Fprintf(h, "%s\x00%s\x00", keys[i], viewKeys[i])
+	}
+	return fmt.Sprintf("%s%s.zip", AlbumDownloadPrefix(albumId), hex.EncodeToString(h.Sum(nil)))
+}
+
+// Copy an S3 object into the archive
+func (s *AlbumService) addObject(ctx context.Context, archive *zip.Writer, name, key string) error {
+	data, err := s.S3Service.GetObjectBytes(ctx, os.Getenv("BUCKET_NAME"), key)
+	if err != nil {
+		return err
+	}
+
+	w, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to download: %w", name, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s to download: %w", name, err)
+	}
+	return nil
+}
+
+// Create a share link for an album, expiresAt nil keeps it working until it is revoked
+func (s *AlbumService) Share(user *models.User, album *models.Album, expiresAt *time.Time, actor db.Actor) (*AlbumShareLink, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrShareExpiry
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	share := &models.AlbumShare{
+		TokenHash: hashShareToken(token),
+		ExpiresAt: expiresAt,
+		AlbumID:   album.ID,
+		CreatedBy: &user.ID,
+	}
+	if err := s.AlbumRepo.CreateShare(share, album.EventID, actor); err != nil {
+		return nil, fmt.Errorf("failed to save share link: %w", err)
+	}
+
+	return &AlbumShareLink{
+		URL:   fmt.Sprintf("%s/share/albums/%s", strings.TrimRight(s.AppURL, "/"), token),
+		Share: share,
+	}, nil
+}
+
+// Return the album a share link token opens
+func (s *AlbumService) SharedAlbum(token string) (*models.Album, error) {
+	album, err := s.AlbumRepo.FindSharedAlbum(hashShareToken(token), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if album == nil {
+		return nil, ErrShareLink
+	}
+	return album, nil
+}
+
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
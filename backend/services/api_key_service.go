@@ -0,0 +1,149 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+)
+
+// Keys look like psk_<prefix>_<secret>, the prefix is stored in the clear to find the key
+const (
+	apiKeyTag        = "psk_"
+	apiKeyUsedWindow = time.Minute // last_used_at is updated at most this often
+)
+
+var (
+	ErrAPIKeyScope   = errors.New("scope must be read or upload")
+	ErrAPIKeyName    = errors.New("name is required")
+	ErrAPIKeyExpiry  = errors.New("expiry must be in the future")
+	ErrAPIKeyEvent   = errors.New("user is not part of this event")
+	ErrAPIKeyInvalid = errors.New("invalid API key")
+)
+
+// Stored API keys, *db.APIKeyRepo outside of tests
+type APIKeyStore interface {
+	CreateKey(key *models.APIKey) error
+	FindByPrefix(prefix string) (*models.APIKey, error)
+	FindUserKeys(userId uint) ([]models.APIKey, error)
+	RevokeKey(userId, keyId uint) (bool, error)
+	TouchLastUsed(keyId uint, now time.Time, interval time.Duration) error
+}
+
+// Checks event membership, *db.EventRepo outside of tests
+type EventAccess interface {
+	CheckAccess(userId, eventId uint) (bool, error)
+}
+
+// Personal API keys, scoped to reading or uploading and optionally limited to one event
+type APIKeyService struct {
+	APIKeyRepo APIKeyStore
+	EventRepo  EventAccess
+}
+
+// Whether a bearer token is an API key rather than a login token
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyTag)
+}
+
+// Create a key for a user, returns the key to show once alongside its stored record
+func (s *APIKeyService) CreateKey(user *models.User, name, scope string, eventId *uint, expiresAt *time.Time) (string, *models.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, ErrAPIKeyName
+	}
+	if scope != models.APIKeyScopeRead && scope != models.APIKeyScopeUpload {
+		return "", nil, ErrAPIKeyScope
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, ErrAPIKeyExpiry
+	}
+	if eventId != nil {
+		member, err := s.EventRepo.CheckAccess(user.ID, *eventId)
+		if err != nil {
+			return "", nil, err
+		}
+		if !member {
+			return "", nil, ErrAPIKeyEvent
+		}
+	}
+
+	// the prefix is hex so it never contains the _ separator
+	b := make([]byte, 32+6)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	prefix := hex.EncodeToString(b[32:])
+	raw := apiKeyTag + prefix + "_" + base64.RawURLEncoding.EncodeToString(b[:32])
+
+	key := &models.APIKey{
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   hashAPIKey(raw),
+		Scope:     scope,
+		ExpiresAt: expiresAt,
+		UserID:    user.ID,
+		EventID:   eventId,
+	}
+	if err := s.APIKeyRepo.CreateKey(key); err != nil {
+		return "", nil, fmt.Errorf("failed to save API key: %w", err)
+	}
+	return raw, key, nil
+}
+
+// Return a user's keys, the keys themselves cannot be shown again
+func (s *APIKeyService) ListKeys(userId uint) ([]models.APIKey, error) {
+	return s.APIKeyRepo.FindUserKeys(userId)
+}
+
+// Revoke one of a user's keys, returns false when they have no such active key
+func (s *APIKeyService) RevokeKey(userId, keyId uint) (bool, error) {
+	return s.APIKeyRepo.RevokeKey(userId, keyId)
+}
+
+// Look up an active key and its user. Keys limited to an event stop working once the user leaves it.
+func (s *APIKeyService) Authenticate(raw string) (*models.APIKey, error) {
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(raw, apiKeyTag), "_")
+	if !IsAPIKey(raw) || !ok {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	key, err := s.APIKeyRepo.FindByPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashAPIKey(raw))) != 1 {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(now)) {
+		return nil, ErrAPIKeyInvalid
+	}
+	if key.EventID != nil {
+		member, err := s.EventRepo.CheckAccess(key.UserID, *key.EventID)
+		if err != nil {
+			return nil, err
+		}
+		if !member {
+			return nil, ErrAPIKeyInvalid
+		}
+	}
+
+	if err := s.APIKeyRepo.TouchLastUsed(key.ID, now, apiKeyUsedWindow); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
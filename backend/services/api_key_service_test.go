@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+)
+
+// In-memory APIKeyStore, keys are found by prefix like the unique index does
+type memoryAPIKeys struct {
+	keys    []*models.APIKey
+	touched []uint
+}
+
+func (m *memoryAPIKeys) CreateKey(key *models.APIKey) error {
+	key.ID = uint(len(m.keys) + 1)
+	m.keys = append(m.keys, key)
+	return nil
+}
+
+func (m *memoryAPIKeys) FindByPrefix(prefix string) (*models.APIKey, error) {
+	for _, key := range m.keys {
+		if key.Prefix == prefix {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryAPIKeys) FindUserKeys(userId uint) ([]models.APIKey, error) {
+	return nil, nil
+}
+
+func (m *memoryAPIKeys) RevokeKey(userId, keyId uint) (bool, error) {
+	for _, key := range m.keys {
+		if key.ID == keyId && key.UserID == userId && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryAPIKeys) TouchLastUsed(keyId uint, now time.Time, interval time.Duration) error {
+	m.touched = append(m.touched, keyId)
+	return nil
+}
+
+// Event membership as a set of {user, event} pairs
+type memberSet map[[2]uint]bool
+
+func (m memberSet) CheckAccess(userId, eventId uint) (bool, error) {
+	return m[[2]uint{userId, eventId}], nil
+}
+
+func newTestAPIKeys() (*APIKeyService, *memoryAPIKeys, memberSet) {
+	keys := &memoryAPIKeys{}
+	members := memberSet{{1, 7}: true}
+	return &APIKeyService{APIKeyRepo: keys, EventRepo: members}, keys, members
+}
+
+func TestAuthenticateValidKey(t *testing.T) {
+	service, keys, _ := newTestAPIKeys()
+	raw, created, err := service.CreateKey(&models.User{ID: 1}, "ci", models.APIKeyScopeUpload, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsAPIKey(raw) || !strings.HasPrefix(raw, apiKeyTag+created.Prefix+"_") {
+		t.Fatalf("key %q does not carry its prefix %q", raw, created.Prefix)
+	}
+	if created.KeyHash != hashAPIKey(raw) || strings.Contains(created.KeyHash, raw) {
+		t.Fatal("stored key is not the hash of the key")
+	}
+
+	key, err := service.Authenticate(raw)
+	if err != nil {
+		t.Fatalf("Authenticate = %v, want the key", err)
+	}
+	if key.ID != created.ID {
+		t.Fatalf("Authenticate found key %d, want %d", key.ID, created.ID)
+	}
+	if len(keys.touched) != 1 {
+		t.Fatalf("last used was recorded %d times, want once", len(keys.touched))
+	}
+}
+
+func TestAuthenticateChecksTheWholeKey(t *testing.T) {
+	service, _, _ := newTestAPIKeys()
+	raw, _, err := service.CreateKey(&models.User{ID: 1}, "ci", models.APIKeyScopeRead, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the prefix alone finds the row, the secret has to hash to the stored value
+	prefix := raw[:strings.LastIndex(raw, "_")+1]
+	last := raw[len(raw)-1:]
+	flipped := "A"
+	if last == "A" {
+		flipped = "B"
+	}
+
+	invalid := []string{
+		prefix + "guessed",
+		raw[:len(raw)-1] + flipped,
+		raw + "x",
+		prefix,
+		"psk_unknown_secret",
+		"psk_nosecret",
+		strings.TrimPrefix(raw, apiKeyTag),
+		"",
+	}
+	for _, token := range invalid {
+		if _, err := service.Authenticate(token); !errors.Is(err, ErrAPIKeyInvalid) {
+			t.Errorf("Authenticate(%q) = %v, want ErrAPIKeyInvalid", token, err)
+		}
+	}
+}
+
+func TestAuthenticateRefusesRevokedAndExpiredKeys(t *testing.T) {
+	service, keys, _ := newTestAPIKeys()
+	user := &models.User{ID: 1}
+
+	revoked, created, err := service.CreateKey(user, "revoked", models.APIKeyScopeRead, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := service.RevokeKey(1, created.ID); !ok {
+		t.Fatal("RevokeKey did not revoke the key")
+	}
+	if _, err := service.Authenticate(revoked); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Fatalf("revoked key = %v, want ErrAPIKeyInvalid", err)
+	}
+
+	soon := time.Now().Add(time.Hour)
+	expired, created, err := service.CreateKey(user, "expired", models.APIKeyScopeRead, nil, &soon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute)
+	created.ExpiresAt = &past
+	if _, err := service.Authenticate(expired); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Fatalf("expired key = %v, want ErrAPIKeyInvalid", err)
+	}
+
+	if len(keys.touched) != 0 {
+		t.Fatal("refused keys were recorded as used")
+	}
+}
+
+func TestAuthenticateRefusesEventKeyAfterLeaving(t *testing.T) {
+	service, _, members := newTestAPIKeys()
+	eventId := uint(7)
+
+	raw, _, err := service.CreateKey(&models.User{ID: 1}, "event", models.APIKeyScopeUpload, &eventId, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Authenticate(raw); err != nil {
+		t.Fatalf("Authenticate = %v, want the key", err)
+	}
+
+	delete(members, [2]uint{1, 7})
+	if _, err := service.Authenticate(raw); !errors.Is(err, ErrAPIKeyInvalid) {
+		t.Fatalf("key of a former member = %v, want ErrAPIKeyInvalid", err)
+	}
+}
+
+func TestCreateKeyChecksEventMembership(t *testing.T) {
+	service, _, _ := newTestAPIKeys()
+	other := uint(8)
+
+	if _, _, err := service.CreateKey(&models.User{ID: 1}, "event", models.APIKeyScopeRead, &other, nil); !errors.Is(err, ErrAPIKeyEvent) {
+		t.Fatalf("CreateKey for another event = %v, want ErrAPIKeyEvent", err)
+	}
+	if _, _, err := service.CreateKey(&models.User{ID: 1}, "admin", "admin", nil, nil); !errors.Is(err, ErrAPIKeyScope) {
+		t.Fatalf("CreateKey with an unknown scope = %v, want ErrAPIKeyScope", err)
+	}
+}
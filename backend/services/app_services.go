@@ -1,12 +1,33 @@
 package services
 
-import "github.com/Rynoo1/PicSort/backend/services/db"
+import (
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/Rynoo1/PicSort/backend/services/pubsub"
+)
 
 type AppServices struct {
-	S3Service       *S3Service
-	ImageService    *ImageService
-	EventRepo       *db.EventRepo
-	UserService     *UserService
-	EventPersonRepo *db.EventPersonRepo
-	EventService    *EventService
+	S3Service           *S3Service
+	ImageService        *ImageService
+	EventRepo           *db.EventRepo
+	UserService         *UserService
+	EventPersonRepo     *db.EventPersonRepo
+	EventService        *EventService
+	Broker              *pubsub.Broker
+	WebhookService      *WebhookService
+	AuditRepo           *db.AuditRepo
+	TrashService        *TrashService
+	QuotaService        *QuotaService
+	ReferenceService    *ReferenceService
+	NotificationRepo    *db.NotificationRepo
+	ConsentService      *ConsentService
+	RenditionService    *RenditionService
+	AccountService      *AccountService
+	RetentionService    *RetentionService
+	VerificationService *VerificationService
+	OIDCService         *OIDCService
+	TwoFactorService    *TwoFactorService
+	APIKeyService       *APIKeyService
+	OrganizationService *OrganizationService
+	AlbumService        *AlbumService
+	InteractionService  *InteractionService
 }
@@ -8,9 +8,16 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Token purposes, tokens with a purpose are only accepted for that purpose and never as a login
+const (
+	PurposeVerifyEmail = "verify_email"
+	PurposeTwoFactor   = "two_factor" // password accepted, a TOTP or recovery code is still needed
+)
+
 type Claims struct {
-	UserID uint   `json:"user_id"`
-	Email  string `json:"email"`
+	UserID  uint   `json:"user_id"`
+	Email   string `json:"email"`
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -39,8 +46,47 @@ func (s *AuthService) GenerateToken(user *models.User) (string, error) {
 	return token.SignedString(s.jwtSecret)
 }
 
-// Validate JWT token
+// Create a signed token for a single purpose, such as an email verification link
+func (s *AuthService) GeneratePurposeToken(user *models.User, purpose string, ttl time.Duration) (string, error) {
+	claims := Claims{
+		UserID:  user.ID,
+		Email:   user.Email,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(s.jwtSecret)
+}
+
+// Validate a login token, purpose tokens are refused
 func (s *AuthService) ValidateToken(tokenString string) (*Claims, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// Validate a token created for purpose
+func (s *AuthService) ValidatePurposeToken(tokenString, purpose string) (*Claims, error) {
+	claims, err := s.parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != purpose {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+func (s *AuthService) parseToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("invalid token")
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+)
+
+// Applies biometric consent changes, removing faces from Rekognition when someone opts out
+type ConsentService struct {
+	ConsentRepo       *db.ConsentRepo
+	ReferenceService  *ReferenceService
+	RekognitionClient *rekognition.Client
+	Renditions        *RenditionService
+}
+
+// Opt a user in or out of face recognition in every event.
+// Opting out forgets every person linked to the user and deletes their reference selfies.
+func (s *ConsentService) SetUserOptOut(ctx context.Context, userId uint, optOut bool, actor db.Actor) error {
+	if err := s.ConsentRepo.SetUserOptOut(userId, optOut, actor); err != nil {
+		return err
+	}
+	if !optOut {
+		return nil
+	}
+
+	people, err := s.ConsentRepo.FindUserPeople(userId, 0)
+	if err != nil {
+		return err
+	}
+	for i := range people {
+		if err := s.SetDoNotRecognize(ctx, &people[i], true, actor); err != nil {
+			return err
+		}
+	}
+
+	return s.ReferenceService.DeleteAll(ctx, userId)
+}
+
+// Opt a member in or out of face recognition in one event.
+// Opting out forgets their person in the event and removes their reference selfies from its collection.
+func (s *ConsentService) SetEventOptOut(ctx context.Context, userId, eventId uint, optOut bool, actor db.Actor) error {
+	if err := s.ConsentRepo.SetEventOptOut(userId, eventId, optOut, actor); err != nil {
+		return err
+	}
+
+	if !optOut {
+		// opting back in lets reference selfies recognise the user again
+		s.ReferenceService.IndexUsersInEvent(ctx, []uint{userId}, eventId)
+		return nil
+	}
+
+	people, err := s.ConsentRepo.FindUserPeople(userId, eventId)
+	if err != nil {
+		return err
+	}
+	for i := range people {
+		if err := s.SetDoNotRecognize(ctx, &people[i], true, actor); err != nil {
+			return err
+		}
+	}
+
+	return s.ReferenceService.RemoveFromEvent(ctx, userId, eventId)
+}
+
+// Apply a user's opt-out to an event person just linked to them, whether they opted out everywhere or in the person's event
+func (s *ConsentService) ApplyOptOut(ctx context.Context, userId uint, person *models.EventPerson, actor db.Actor) error {
+	if person.DoNotRecognize {
+		return nil
+	}
+	optedOut, err := s.ConsentRepo.IsOptedOut(userId, person.EventID)
+	if err != nil {
+		return fmt.Errorf("failed to check opt-out of user %d: %w", userId, err)
+	}
+	if !optedOut {
+		return nil
+	}
+	return s.SetDoNotRecognize(ctx, person, true, actor)
+}
+
+// Flag an event person as do not recognise and delete their faces from the collection, apart from one suppression
+// face that recognises them in new uploads so those faces are blurred and dropped too.
+// Clearing the flag only allows new uploads to be matched, deleted faces are not restored.
+func (s *ConsentService) SetDoNotRecognize(ctx context.Context, person *models.EventPerson, doNotRecognize bool, actor db.Actor) error {
+	faceIds, err := s.ConsentRepo.SetDoNotRecognize(person, doNotRecognize, actor)
+	if err != nil {
+		return err
+	}
+
+	// blur the person in shared photos, or restore the originals when the flag is cleared
+	s.Renditions.RefreshPerson(ctx, person.ID)
+
+	if !doNotRecognize {
+		return nil
+	}
+
+	if err := removeEventFaces(ctx, s.RekognitionClient, person.EventID, faceIds); err != nil {
+		return fmt.Errorf("failed to remove faces for person %d: %w", person.ID, err)
+	}
+	log.Printf("[CONSENT] removed %d faces for person %d", len(faceIds), person.ID)
+	return nil
+}
+
+// Forget a person whose user is deleted. Their faces are removed like an opt-out and so is the suppression face,
+// so no face template of theirs is left to match new uploads.
+func (s *ConsentService) ForgetPerson(ctx context.Context, person *models.EventPerson, actor db.Actor) error {
+	if err := s.SetDoNotRecognize(ctx, person, true, actor); err != nil {
+		return err
+	}
+
+	faceId, err := s.ConsentRepo.ClearSuppressionFace(person.ID)
+	if err != nil {
+		return fmt.Errorf("failed to clear suppression face for person %d: %w", person.ID, err)
+	}
+	if faceId == "" {
+		return nil
+	}
+	if err := removeEventFaces(ctx, s.RekognitionClient, person.EventID, []string{faceId}); err != nil {
+		return fmt.Errorf("failed to remove suppression face for person %d: %w", person.ID, err)
+	}
+	log.Printf("[CONSENT] removed suppression face for person %d", person.ID)
+	return nil
+}
+
+// Change an event's recognition mode. Turning recognition off deletes the event's collection,
+// the other modes apply to photos processed from now on.
+func (s *ConsentService) SetRecognitionMode(ctx context.Context, eventId uint, mode string, actor db.Actor) error {
+	switch mode {
+	case models.RecognitionAll, models.RecognitionConsent, models.RecognitionOff:
+	default:
+		return fmt.Errorf("unknown recognition mode: %s", mode)
+	}
+
+	if err := s.ConsentRepo.SetRecognitionMode(eventId, mode, actor); err != nil {
+		return err
+	}
+	if mode != models.RecognitionOff {
+		return nil
+	}
+
+	collectionId := fmt.Sprintf("event-%d", eventId)
+	exists, err := CollectionExists(ctx, s.RekognitionClient, collectionId)
+	if err != nil || !exists {
+		return err
+	}
+	return DeleteCollection(ctx, s.RekognitionClient, collectionId)
+}
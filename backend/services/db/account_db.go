@@ -0,0 +1,316 @@
+package db
+
+import (
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AccountRepo struct {
+	DB *gorm.DB
+}
+
+// An event the user is a member of, including events in the trash
+type ExportMembership struct {
+	EventId           uint       `json:"event_id"`
+	EventName         string     `json:"event_name"`
+	Role              string     `json:"role"`
+	JoinedAt          time.Time  `json:"joined_at"`
+	RecognitionOptOut bool       `json:"recognition_opt_out"`
+	DeletedAt         *time.Time `json:"deleted_at,omitempty"`
+}
+
+// A photo the user uploaded, including photos in the trash
+type ExportPhoto struct {
+	ID         uint       `json:"id"`
+	EventId    uint       `json:"event_id"`
+	StorageKey string     `json:"storage_key"`
+	SizeBytes  int64      `json:"size_bytes"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+}
+
+// A face detection linked to an event person that is the user
+type ExportDetection struct {
+	ID            uint           `json:"id"`
+	PhotoId       uint           `json:"photo_id"`
+	EventId       uint           `json:"event_id"`
+	EventPersonId uint           `json:"event_person_id"`
+	PersonName    string         `json:"person_name"`
+	Confidence    float32        `json:"confidence"`
+	Box           models.FaceBox `json:"bounding_box" gorm:"embedded;embeddedPrefix:box_"`
+}
+
+// repo constructor
+func NewAccountRepo(db *gorm.DB) *AccountRepo {
+	return &AccountRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *AccountRepo) WithTx(tx *gorm.DB) *AccountRepo {
+	return &AccountRepo{
+		DB: tx,
+	}
+}
+
+// Return every event membership of a user
+func (r *AccountRepo) FindMemberships(userId uint) ([]ExportMembership, error) {
+	var result []ExportMembership
+	err := r.DB.Table("event_users").
+		Select("events.id AS event_id, events.event_name, event_users.role, event_users.created_at AS joined_at, event_users.recognition_opt_out, events.deleted_at").
+		Joins("JOIN events ON events.id = event_users.event_id").
+		Where("event_users.user_id = ?", userId).
+		Order("events.id").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Return every photo a user uploaded
+func (r *AccountRepo) FindUploadedPhotos(userId uint) ([]ExportPhoto, error) {
+	var result []ExportPhoto
+	err := r.DB.Table("photos").
+		Select("id, event_id, storage_key, size_bytes, deleted_at").
+		Where("uploaded_by = ?", userId).
+		Order("id").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Return the face detections of every event person linked to a user
+func (r *AccountRepo) FindLinkedDetections(userId uint) ([]ExportDetection, error) {
+	var result []ExportDetection
+	err := r.DB.Table("face_detections").
+		Select("face_detections.id, face_detections.photo_id, face_detections.event_id, face_detections.event_person_id, event_people.name AS person_name, face_detections.confidence, face_detections.box_left, face_detections.box_top, face_detections.box_width, face_detections.box_height").
+		Joins("JOIN event_people ON event_people.id = face_detections.event_person_id").
+		Where("event_people.user_id = ?", userId).
+		Order("face_detections.id").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Return every audit entry for changes a user made
+func (r *AccountRepo) FindAuditEntries(userId uint) ([]models.AuditLog, error) {
+	var entries []models.AuditLog
+	if err := r.DB.Where("actor_id = ?", userId).Order("id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Return a user's consent history
+func (r *AccountRepo) FindConsentRecords(userId uint) ([]models.ConsentRecord, error) {
+	var records []models.ConsentRecord
+	if err := r.DB.Where("user_id = ?", userId).Order("id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Return every notification sent to a user
+func (r *AccountRepo) FindNotifications(userId uint) ([]models.Notification, error) {
+	var notifications []models.Notification
+	if err := r.DB.Where("user_id = ?", userId).Order("id").Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// Return the external login providers linked to a user
+func (r *AccountRepo) FindIdentities(userId uint) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	if err := r.DB.Where("user_id = ?", userId).Order("id").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// Return a user's API keys, only their hashes are stored
+func (r *AccountRepo) FindAPIKeys(userId uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.DB.Where("user_id = ?", userId).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Return the organizations a user belongs to with their role
+func (r *AccountRepo) FindOrganizations(userId uint) ([]ReturnOrganization, error) {
+	return NewOrganizationRepo(r.DB).FindUserOrganizations(userId)
+}
+
+// Return the photos a user favorited
+func (r *AccountRepo) FindFavorites(userId uint) ([]models.Favorite, error) {
+	var favorites []models.Favorite
+	if err := r.DB.Where("user_id = ?", userId).Order("created_at").Find(&favorites).Error; err != nil {
+		return nil, err
+	}
+	return favorites, nil
+}
+
+// Return a user's reactions to photos
+func (r *AccountRepo) FindReactions(userId uint) ([]models.PhotoReaction, error) {
+	var reactions []models.PhotoReaction
+	if err := r.DB.Where("user_id = ?", userId).Order("created_at").Find(&reactions).Error; err != nil {
+		return nil, err
+	}
+	return reactions, nil
+}
+
+// Return every comment a user wrote on photos
+func (r *AccountRepo) FindComments(userId uint) ([]models.PhotoComment, error) {
+	var comments []models.PhotoComment
+	if err := r.DB.Where("user_id = ?", userId).Order("id").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// Find the member that takes over a user's uploads in an event, owners first then the longest standing member.
+// Organization events without other members stay with the organization, its longest standing owner or admin
+// takes over with no membership row since the organization gives them access.
+// Returns nil when no one else has access to the event.
+func (r *AccountRepo) FindSuccessor(userId, eventId uint) (*models.EventUser, error) {
+	var members []models.EventUser
+	err := r.DB.Where("event_id = ? AND user_id <> ?", eventId, userId).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "role = ? DESC, created_at, user_id", Vars: []interface{}{models.RoleOwner}}}).
+		Limit(1).
+		Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(members) > 0 {
+		return &members[0], nil
+	}
+
+	var admins []models.OrganizationMember
+	err = r.DB.Table("organization_members").
+		Select("organization_members.*").
+		Joins("JOIN events ON events.organization_id = organization_members.organization_id").
+		Where("events.id = ? AND organization_members.user_id <> ? AND organization_members.role IN ?", eventId, userId, models.OrgAdminRoles).
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "organization_members.role = ? DESC, organization_members.created_at, organization_members.user_id", Vars: []interface{}{models.OrgRoleOwner}}}).
+		Limit(1).
+		Scan(&admins).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(admins) == 0 {
+		return nil, nil
+	}
+	return &models.EventUser{EventID: eventId, UserID: admins[0].UserID}, nil
+}
+
+// Return a batch of photos a user uploaded with their face detections, including photos in the trash.
+// Photos in the keepEvents events are left out.
+func (r *AccountRepo) FindUploadedPhotoBatch(userId uint, keepEvents []uint, limit int) ([]models.Photos, error) {
+	tx := r.DB.Unscoped().Preload("FaceDetections").Where("uploaded_by = ?", userId)
+	if len(keepEvents) > 0 {
+		tx = tx.Where("event_id NOT IN ?", keepEvents)
+	}
+
+	var photos []models.Photos
+	err := tx.Order("id").
+		Limit(limit).
+		Find(&photos).Error
+	if err != nil {
+		return nil, err
+	}
+	return photos, nil
+}
+
+// Delete a user and everything tied to them. Uploads and webhooks in the events of successors
+// (event id -> member) are handed over first, successors are made owners when promote is set for their event.
+// audit_log and consent_records are append-only, entries keep the id of the deleted user but nothing links it to them anymore.
+func (r *AccountRepo) DeleteAccount(userId uint, successors map[uint]*models.EventUser, promote map[uint]bool) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		for eventId, successor := range successors {
+			if promote[eventId] {
+				err := tx.Model(&models.EventUser{}).
+					Where("event_id = ? AND user_id = ?", eventId, successor.UserID).
+					Update("role", models.RoleOwner).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			err := tx.Unscoped().Model(&models.Photos{}).
+				Where("event_id = ? AND uploaded_by = ?", eventId, userId).
+				Update("uploaded_by", successor.UserID).Error
+			if err != nil {
+				return err
+			}
+
+			err = tx.Model(&models.Webhook{}).
+				Where("event_id = ? AND created_by = ?", eventId, userId).
+				Update("created_by", successor.UserID).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := handOverOrganizations(tx, userId); err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", userId).Delete(&models.EventUser{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userId).Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+
+		// linked event people are unlinked, reference selfies and photo favorites, reactions and comments cascade with the user
+		return tx.Delete(&models.User{}, userId).Error
+	})
+}
+
+// Give every organization the user is the only owner of a new owner, the longest standing admin
+// then the longest standing member. Organizations with no other members are deleted, their events
+// go back to belonging to their members.
+func handOverOrganizations(tx *gorm.DB, userId uint) error {
+	var orgIds []uint
+	err := tx.Model(&models.OrganizationMember{}).
+		Where("user_id = ? AND role = ?", userId, models.OrgRoleOwner).
+		Where("NOT EXISTS (SELECT 1 FROM organization_members other WHERE other.organization_id = organization_members.organization_id AND other.user_id <> ? AND other.role = ?)", userId, models.OrgRoleOwner).
+		Pluck("organization_id", &orgIds).Error
+	if err != nil {
+		return err
+	}
+
+	for _, orgId := range orgIds {
+		var successors []models.OrganizationMember
+		err := tx.Where("organization_id = ? AND user_id <> ?", orgId, userId).
+			Order(clause.OrderBy{Expression: clause.Expr{SQL: "role = ? DESC, created_at, user_id", Vars: []interface{}{models.OrgRoleAdmin}}}).
+			Limit(1).
+			Find(&successors).Error
+		if err != nil {
+			return err
+		}
+
+		if len(successors) == 0 {
+			if err := tx.Delete(&models.Organization{}, orgId).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = tx.Model(&models.OrganizationMember{}).
+			Where("organization_id = ? AND user_id = ?", orgId, successors[0].UserID).
+			Update("role", models.OrgRoleOwner).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
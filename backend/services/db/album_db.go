@@ -0,0 +1,295 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AlbumRepo struct {
+	DB *gorm.DB
+}
+
+// An album in an event's album list
+type ReturnAlbum struct {
+	ID         uint      `json:"id"`
+	Name       string    `json:"name"`
+	Position   int       `json:"position"`
+	PhotoCount int64     `json:"photo_count"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// repo constructor
+func NewAlbumRepo(db *gorm.DB) *AlbumRepo {
+	return &AlbumRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *AlbumRepo) WithTx(tx *gorm.DB) *AlbumRepo {
+	return &AlbumRepo{
+		DB: tx,
+	}
+}
+
+// Create an album at the end of its event's album list
+func (r *AlbumRepo) CreateAlbum(album *models.Album, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var last int
+		if err := tx.Model(&models.Album{}).Where("event_id = ?", album.EventID).Select("COALESCE(MAX(position), -1)").Row().Scan(&last); err != nil {
+			return err
+		}
+		album.Position = last + 1
+
+		if err := tx.Create(album).Error; err != nil {
+			return err
+		}
+		return WriteAudit(tx, actor, album.EventID, models.AuditAlbumCreated, "album", album.ID,
+			nil, map[string]interface{}{"name": album.Name})
+	})
+}
+
+// Find an album by id
+func (r *AlbumRepo) FindAlbum(albumId uint) (*models.Album, error) {
+	var album models.Album
+	if err := r.DB.First(&album, albumId).Error; err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+// Return an event's albums in order with how many photos each holds, photos in the trash are not counted
+func (r *AlbumRepo) FindEventAlbums(eventId uint) ([]ReturnAlbum, error) {
+	var result []ReturnAlbum
+	err := r.DB.Table("albums").
+		Select("albums.id, albums.name, albums.position, albums.updated_at, COUNT(photos.id) AS photo_count").
+		Joins("LEFT JOIN album_photos ON album_photos.album_id = albums.id").
+		Joins("LEFT JOIN photos ON photos.id = album_photos.photo_id AND photos.deleted_at IS NULL").
+		Where("albums.event_id = ?", eventId).
+		Group("albums.id").
+		Order("albums.position, albums.id").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Rename an album
+func (r *AlbumRepo) RenameAlbum(albumId uint, name string) error {
+	return r.DB.Model(&models.Album{}).Where("id = ?", albumId).Update("name", name).Error
+}
+
+// Delete an album, its photos stay in the event
+func (r *AlbumRepo) DeleteAlbum(album *models.Album, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.Album{}, album.ID).Error; err != nil {
+			return err
+		}
+		return WriteAudit(tx, actor, album.EventID, models.AuditAlbumDeleted, "album", album.ID,
+			map[string]interface{}{"name": album.Name}, nil)
+	})
+}
+
+// Put an event's albums in the given order, albums left out follow in their current order
+func (r *AlbumRepo) ReorderAlbums(eventId uint, albumIds []uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var current []uint
+		if err := tx.Model(&models.Album{}).Where("event_id = ?", eventId).Order("position, id").Pluck("id", &current).Error; err != nil {
+			return err
+		}
+
+		for i, id := range reorder(current, albumIds) {
+			if err := tx.Model(&models.Album{}).Where("id = ?", id).UpdateColumn("position", i).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Add photos to the end of an album in the given order. Photos from other events, photos in the trash
+// and photos already in the album are skipped. Returns how many were added.
+func (r *AlbumRepo) AddPhotos(album *models.Album, photoIds []uint) (int, error) {
+	added := 0
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var valid []uint
+		err := tx.Model(&models.Photos{}).
+			Where("id IN ? AND event_id = ?", photoIds, album.EventID).
+			Where("id NOT IN (?)", tx.Table("album_photos").Select("photo_id").Where("album_id = ?", album.ID)).
+			Pluck("id", &valid).Error
+		if err != nil {
+			return err
+		}
+		if len(valid) == 0 {
+			return nil
+		}
+
+		var last int
+		if err := tx.Model(&models.AlbumPhoto{}).Where("album_id = ?", album.ID).Select("COALESCE(MAX(position), -1)").Row().Scan(&last); err != nil {
+			return err
+		}
+		next := last + 1
+
+		rows := make([]models.AlbumPhoto, 0, len(valid))
+		for _, id := range uniqueIDs(photoIds) {
+			if !containsID(valid, id) {
+				continue
+			}
+			rows = append(rows, models.AlbumPhoto{AlbumID: album.ID, PhotoID: id, Position: next})
+			next++
+		}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error; err != nil {
+			return err
+		}
+		added = len(rows)
+		return tx.Model(&models.Album{}).Where("id = ?", album.ID).Update("updated_at", time.Now()).Error
+	})
+	return added, err
+}
+
+// Remove photos from an album, returns how many were removed
+func (r *AlbumRepo) RemovePhotos(albumId uint, photoIds []uint) (int64, error) {
+	var removed int64
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("album_id = ? AND photo_id IN ?", albumId, photoIds).Delete(&models.AlbumPhoto{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected
+		return tx.Model(&models.Album{}).Where("id = ?", albumId).Update("updated_at", time.Now()).Error
+	})
+	return removed, err
+}
+
+// Put an album's photos in the given order, photos left out follow in their current order
+func (r *AlbumRepo) ReorderPhotos(albumId uint, photoIds []uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var current []uint
+		if err := tx.Model(&models.AlbumPhoto{}).Where("album_id = ?", albumId).Order("position, photo_id").Pluck("photo_id", &current).Error; err != nil {
+			return err
+		}
+
+		for i, id := range reorder(current, photoIds) {
+			err := tx.Model(&models.AlbumPhoto{}).
+				Where("album_id = ? AND photo_id = ?", albumId, id).
+				UpdateColumn("position", i).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Album{}).Where("id = ?", albumId).Update("updated_at", time.Now()).Error
+	})
+}
+
+// Return an album's photos in order, photos in the trash are left out
+func (r *AlbumRepo) FindAlbumPhotos(albumId uint) ([]ImageResults, error) {
+	var result []ImageResults
+	err := r.DB.Table("album_photos").
+		Select("photos.id, photos.storage_key").
+		Joins("JOIN photos ON photos.id = album_photos.photo_id AND photos.deleted_at IS NULL").
+		Where("album_photos.album_id = ?", albumId).
+		Order("album_photos.position, album_photos.photo_id").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Save a new share link
+func (r *AlbumRepo) CreateShare(share *models.AlbumShare, eventId uint, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(share).Error; err != nil {
+			return err
+		}
+		return WriteAudit(tx, actor, eventId, models.AuditAlbumShared, "album", share.AlbumID,
+			nil, map[string]interface{}{"share_id": share.ID, "expires_at": share.ExpiresAt})
+	})
+}
+
+// Return an album's share links, newest first
+func (r *AlbumRepo) FindShares(albumId uint) ([]models.AlbumShare, error) {
+	var shares []models.AlbumShare
+	if err := r.DB.Where("album_id = ?", albumId).Order("id DESC").Find(&shares).Error; err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+// Revoke one of an album's share links, returns false when the album has no such active link
+func (r *AlbumRepo) RevokeShare(album *models.Album, shareId uint, actor Actor) (bool, error) {
+	revoked := false
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.AlbumShare{}).
+			Where("id = ? AND album_id = ? AND revoked_at IS NULL", shareId, album.ID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		revoked = true
+		return WriteAudit(tx, actor, album.EventID, models.AuditAlbumShareRevoked, "album", album.ID,
+			map[string]interface{}{"share_id": shareId}, nil)
+	})
+	return revoked, err
+}
+
+// Find the album an active share link points to, returns nil when the link is unknown, revoked,
+// expired or its event is in the trash
+func (r *AlbumRepo) FindSharedAlbum(tokenHash string, now time.Time) (*models.Album, error) {
+	var album models.Album
+	err := r.DB.
+		Joins("JOIN album_shares ON album_shares.album_id = albums.id").
+		Joins("JOIN events ON events.id = albums.event_id AND events.deleted_at IS NULL").
+		Where("album_shares.token_hash = ? AND album_shares.revoked_at IS NULL", tokenHash).
+		Where("(album_shares.expires_at IS NULL OR album_shares.expires_at > ?)", now).
+		First(&album).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+// New order for current ids: the requested ids that are in current come first, then the rest in their current order
+func reorder(current, requested []uint) []uint {
+	order := make([]uint, 0, len(current))
+	for _, id := range uniqueIDs(requested) {
+		if containsID(current, id) {
+			order = append(order, id)
+		}
+	}
+	for _, id := range current {
+		if !containsID(order, id) {
+			order = append(order, id)
+		}
+	}
+	return order
+}
+
+// ids in their first order with duplicates removed
+func uniqueIDs(ids []uint) []uint {
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !containsID(unique, id) {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
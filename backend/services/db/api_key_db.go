@@ -0,0 +1,72 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepo struct {
+	DB *gorm.DB
+}
+
+// repo constructor
+func NewAPIKeyRepo(db *gorm.DB) *APIKeyRepo {
+	return &APIKeyRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *APIKeyRepo) WithTx(tx *gorm.DB) *APIKeyRepo {
+	return &APIKeyRepo{
+		DB: tx,
+	}
+}
+
+// Save a new key
+func (r *APIKeyRepo) CreateKey(key *models.APIKey) error {
+	return r.DB.Create(key).Error
+}
+
+// Find a key and its user by prefix, returns nil when there is no such key
+func (r *APIKeyRepo) FindByPrefix(prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.DB.Preload("User").Where("prefix = ?", prefix).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Return a user's keys, newest first
+func (r *APIKeyRepo) FindUserKeys(userId uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.DB.Where("user_id = ?", userId).Order("id DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke one of a user's keys, returns false when the user has no such active key
+func (r *APIKeyRepo) RevokeKey(userId, keyId uint) (bool, error) {
+	result := r.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyId, userId).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Record when a key was used, at most once per interval so busy keys do not write on every request
+func (r *APIKeyRepo) TouchLastUsed(keyId uint, now time.Time, interval time.Duration) error {
+	return r.DB.Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", keyId, now.Add(-interval)).
+		UpdateColumn("last_used_at", now).Error
+}
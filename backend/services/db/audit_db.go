@@ -0,0 +1,81 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+)
+
+// Who made a change, recorded with every audit entry
+type Actor struct {
+	UserID    uint
+	RequestID string
+}
+
+type AuditRepo struct {
+	DB *gorm.DB
+}
+
+// repo constructor
+func NewAuditRepo(db *gorm.DB) *AuditRepo {
+	return &AuditRepo{
+		DB: db,
+	}
+}
+
+// Write an audit entry, pass the transaction making the change so both commit together.
+// before and after are stored as JSON, nil values are stored as null.
+func WriteAudit(tx *gorm.DB, actor Actor, eventID uint, action, targetType string, targetID uint, before, after interface{}) error {
+	entry := models.AuditLog{
+		EventID:    eventID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RequestID:  actor.RequestID,
+	}
+	if actor.UserID != 0 {
+		entry.ActorID = &actor.UserID
+	}
+
+	var err error
+	if entry.Before, err = auditJSON(before); err != nil {
+		return err
+	}
+	if entry.After, err = auditJSON(after); err != nil {
+		return err
+	}
+
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+func auditJSON(value interface{}) (*string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit value: %w", err)
+	}
+	out := string(encoded)
+	return &out, nil
+}
+
+// Return a page of an event's history, newest first. beforeId is the cursor from the previous page (0 for the first)
+func (r *AuditRepo) FindEventHistory(eventId, beforeId uint, limit int) ([]models.AuditLog, error) {
+	var entries []models.AuditLog
+
+	query := r.DB.Where("event_id = ?", eventId)
+	if beforeId > 0 {
+		query = query.Where("id < ?", beforeId)
+	}
+
+	if err := query.Order("id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
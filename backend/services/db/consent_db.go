@@ -0,0 +1,254 @@
+package db
+
+import (
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+)
+
+type ConsentRepo struct {
+	DB *gorm.DB
+}
+
+type EventConsent struct {
+	EventId   uint   `json:"event_id"`
+	EventName string `json:"event_name"`
+	OptOut    bool   `json:"opt_out"`
+}
+
+// repo constructor
+func NewConsentRepo(db *gorm.DB) *ConsentRepo {
+	return &ConsentRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *ConsentRepo) WithTx(tx *gorm.DB) *ConsentRepo {
+	return &ConsentRepo{
+		DB: tx,
+	}
+}
+
+// Set whether a user is opted out of face recognition everywhere
+func (r *ConsentRepo) SetUserOptOut(userId uint, optOut bool, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).Where("id = ?", userId).Update("recognition_opt_out", optOut)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Create(&models.ConsentRecord{
+			UserID:    userId,
+			Scope:     models.ConsentScopeUser,
+			OptOut:    optOut,
+			RequestID: actor.RequestID,
+		}).Error
+	})
+}
+
+// Set whether a member is opted out of face recognition in one event
+func (r *ConsentRepo) SetEventOptOut(userId, eventId uint, optOut bool, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.EventUser{}).Where("event_id = ? AND user_id = ?", eventId, userId).Update("recognition_opt_out", optOut)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Create(&models.ConsentRecord{
+			UserID:    userId,
+			EventID:   &eventId,
+			Scope:     models.ConsentScopeEvent,
+			OptOut:    optOut,
+			RequestID: actor.RequestID,
+		}).Error
+	})
+}
+
+// Return a user's event level consent settings
+func (r *ConsentRepo) FindEventConsents(userId uint) ([]EventConsent, error) {
+	var result []EventConsent
+	err := r.DB.Table("event_users").
+		Select("events.id AS event_id, events.event_name, event_users.recognition_opt_out AS opt_out").
+		Joins("JOIN events ON events.id = event_users.event_id AND events.deleted_at IS NULL").
+		Where("event_users.user_id = ?", userId).
+		Order("events.id").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Check if a user opted out of face recognition everywhere or in one event
+func (r *ConsentRepo) IsOptedOut(userId, eventId uint) (bool, error) {
+	var optedOut []bool
+	err := r.DB.Table("users").
+		Select("users.recognition_opt_out OR COALESCE(event_users.recognition_opt_out, false)").
+		Joins("LEFT JOIN event_users ON event_users.user_id = users.id AND event_users.event_id = ?", eventId).
+		Where("users.id = ?", userId).
+		Scan(&optedOut).Error
+	if err != nil {
+		return false, err
+	}
+	return len(optedOut) > 0 && optedOut[0], nil
+}
+
+// Return the event people linked to a user, limited to one event if eventId is not 0
+func (r *ConsentRepo) FindUserPeople(userId, eventId uint) ([]models.EventPerson, error) {
+	tx := r.DB.Where("user_id = ?", userId)
+	if eventId != 0 {
+		tx = tx.Where("event_id = ?", eventId)
+	}
+
+	var people []models.EventPerson
+	if err := tx.Find(&people).Error; err != nil {
+		return nil, err
+	}
+	return people, nil
+}
+
+// Flag an event person as do not recognise, returns the face ids of their detections so they can be removed from the collection.
+// Opting out keeps the person's suppression face out of the returned ids, their most confident face unless one was kept before.
+func (r *ConsentRepo) SetDoNotRecognize(person *models.EventPerson, doNotRecognize bool, actor Actor) ([]string, error) {
+	var faceIds []string
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var current models.EventPerson
+		if err := tx.Select("id", "suppression_face_id").First(&current, person.ID).Error; err != nil {
+			return err
+		}
+
+		changes := map[string]interface{}{"do_not_recognize": doNotRecognize}
+		if doNotRecognize && current.SuppressionFaceID == "" {
+			var anchors []string
+			err := tx.Model(&models.FaceDetection{}).
+				Where("event_person_id = ? AND rekognition_id <> ''", person.ID).
+				Order("confidence DESC, id").
+				Limit(1).
+				Pluck("rekognition_id", &anchors).Error
+			if err != nil {
+				return err
+			}
+			if len(anchors) > 0 {
+				current.SuppressionFaceID = anchors[0]
+				changes["suppression_face_id"] = anchors[0]
+			}
+		}
+		if err := tx.Model(&models.EventPerson{}).Where("id = ?", person.ID).Updates(changes).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&models.FaceDetection{}).
+			Where("event_person_id = ? AND rekognition_id <> ?", person.ID, current.SuppressionFaceID).
+			Pluck("rekognition_id", &faceIds).Error
+		if err != nil {
+			return err
+		}
+
+		return WriteAudit(tx, actor, person.EventID, models.AuditPersonOptOut, "event_person", person.ID,
+			map[string]bool{"do_not_recognize": person.DoNotRecognize},
+			map[string]bool{"do_not_recognize": doNotRecognize})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return faceIds, nil
+}
+
+// Drop a person's suppression face and its detections, returns the face id so it can be removed from the collection
+func (r *ConsentRepo) ClearSuppressionFace(personId uint) (string, error) {
+	var faceId string
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var person models.EventPerson
+		if err := tx.Select("id", "suppression_face_id").First(&person, personId).Error; err != nil {
+			return err
+		}
+		faceId = person.SuppressionFaceID
+		if faceId == "" {
+			return nil
+		}
+
+		if err := tx.Where("event_person_id = ? AND rekognition_id = ?", personId, faceId).Delete(&models.FaceDetection{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.EventPerson{}).Where("id = ?", personId).Update("suppression_face_id", "").Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return faceId, nil
+}
+
+// Change an event's recognition mode
+func (r *ConsentRepo) SetRecognitionMode(eventId uint, mode string, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var event models.Event
+		if err := tx.Select("id", "recognition_mode").First(&event, eventId).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Event{}).Where("id = ?", eventId).Update("recognition_mode", mode).Error; err != nil {
+			return err
+		}
+
+		// reference selfies go with the collection when recognition is turned off
+		if mode == models.RecognitionOff {
+			if err := tx.Where("event_id = ?", eventId).Delete(&models.ReferenceFaceIndex{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return WriteAudit(tx, actor, eventId, models.AuditRecognition, "event", eventId,
+			map[string]string{"recognition_mode": event.RecognitionMode},
+			map[string]string{"recognition_mode": mode})
+	})
+}
+
+// Find an event's recognition mode
+func (r *ConsentRepo) FindRecognitionMode(eventId uint) (string, error) {
+	var event models.Event
+	if err := r.DB.Select("recognition_mode").First(&event, eventId).Error; err != nil {
+		return "", err
+	}
+	return event.RecognitionMode, nil
+}
+
+// Find the face ids of detections in the given photos that are linked to do not recognise people, apart from their suppression faces
+func (r *ConsentRepo) FindOptedOutFaces(photoIds []uint) ([]string, error) {
+	var faceIds []string
+	err := r.DB.Table("face_detections").
+		Joins("JOIN event_people ON event_people.id = face_detections.event_person_id").
+		Where("face_detections.photo_id IN ? AND event_people.do_not_recognize = true", photoIds).
+		Where("face_detections.rekognition_id <> event_people.suppression_face_id").
+		Pluck("face_detections.rekognition_id", &faceIds).Error
+	if err != nil {
+		return nil, err
+	}
+	return faceIds, nil
+}
+
+// Find which of the given faces are suppression faces of do not recognise people in an event, mapped to the person id
+func (r *ConsentRepo) FindSuppressionFaces(eventId uint, faceIds []string) (map[string]uint, error) {
+	suppressed := make(map[string]uint)
+	if len(faceIds) == 0 {
+		return suppressed, nil
+	}
+
+	var people []models.EventPerson
+	err := r.DB.Select("id", "suppression_face_id").
+		Where("event_id = ? AND do_not_recognize = true AND suppression_face_id IN ?", eventId, faceIds).
+		Find(&people).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, person := range people {
+		suppressed[person.SuppressionFaceID] = person.ID
+	}
+	return suppressed, nil
+}
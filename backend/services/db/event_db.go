@@ -1,11 +1,13 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/Rynoo1/PicSort/backend/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type EventRepo struct {
@@ -18,12 +20,22 @@ type ReturnEvents struct {
 }
 
 type ReturnEventWithImages struct {
-	EventId   uint           `json:"id"`
-	EventName string         `json:"name"`
-	Images    []ImageResults `json:"images"`
-	UserCount int64          `json:"user_count"`
+	EventId        uint          `json:"id"`
+	EventName      string        `json:"name"`
+	Description    string        `json:"description,omitempty"`
+	Location       string        `json:"location,omitempty"`
+	StartsAt       *time.Time    `json:"starts_at,omitempty"`
+	EndsAt         *time.Time    `json:"ends_at,omitempty"`
+	OrganizationId *uint         `json:"organization_id,omitempty"`
+	CoverPhoto     *ImageResults `json:"cover_photo"` // nil when the event has no photos
+	UserCount      int64         `json:"user_count"`
 }
 
+var (
+	ErrCoverPhoto = errors.New("cover photo must be a photo in this event")
+	ErrEventDates = errors.New("event cannot end before it starts")
+)
+
 // constructor
 func NewEventRepo(db *gorm.DB) *EventRepo {
 	return &EventRepo{
@@ -44,52 +56,106 @@ func (r *EventRepo) CreateEvent(event *models.Event) error {
 }
 
 // Add multiple users to an event
-func (r *EventRepo) AddUsersToEvent(userIDs []uint, eventID uint) error {
+func (r *EventRepo) AddUsersToEvent(userIDs []uint, eventID uint, actor Actor) error {
 	if len(userIDs) == 0 {
 		return fmt.Errorf("no user IDs provided")
 	}
 
-	event := models.Event{ID: eventID}
-
-	var existing []models.User
-	if err := r.DB.Model(&event).Association("Users").Find(&existing); err != nil {
-		return fmt.Errorf("failed to fetch existing users: %w", err)
-	}
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		event := models.Event{ID: eventID}
 
-	existingIDs := make(map[uint]struct{})
-	for _, u := range existing {
-		existingIDs[u.ID] = struct{}{}
-	}
+		var existing []models.User
+		if err := tx.Model(&event).Association("Users").Find(&existing); err != nil {
+			return fmt.Errorf("failed to fetch existing users: %w", err)
+		}
 
-	for _, id := range userIDs {
-		if _, exists := existingIDs[id]; exists {
-			continue
+		existingIDs := make(map[uint]struct{})
+		for _, u := range existing {
+			existingIDs[u.ID] = struct{}{}
 		}
-		user := models.User{ID: id}
-		if err := r.DB.Model(&event).Association("Users").Append(&user); err != nil {
-			return fmt.Errorf("failed to add user %d: %w", id, err)
+
+		var added []uint
+		for _, id := range userIDs {
+			if _, exists := existingIDs[id]; exists {
+				continue
+			}
+			user := models.User{ID: id}
+			if err := tx.Model(&event).Association("Users").Append(&user); err != nil {
+				return fmt.Errorf("failed to add user %d: %w", id, err)
+			}
+			existingIDs[id] = struct{}{}
+			added = append(added, id)
 		}
-	}
 
-	return nil
+		if len(added) == 0 {
+			return nil
+		}
+		return WriteAudit(tx, actor, eventID, models.AuditUsersAdded, "event", eventID, nil, map[string]interface{}{"user_ids": added})
+	})
 }
 
-// Rename Event
-func (r *EventRepo) RenameEvent(eventId uint, newName string) error {
-	if newName == "" {
-		return fmt.Errorf("event name cannot be empty")
+// Editable event details by column name
+func eventDetails(event *models.Event) map[string]interface{} {
+	return map[string]interface{}{
+		"event_name":     event.EventName,
+		"description":    event.Description,
+		"location":       event.Location,
+		"starts_at":      event.StartsAt,
+		"ends_at":        event.EndsAt,
+		"cover_photo_id": event.CoverPhotoID,
+		"visibility":     event.Visibility,
 	}
+}
 
-	result := r.DB.Model(&models.Event{}).Where("id = ?", eventId).Update("event_name", newName)
-	if result.Error != nil {
-		return result.Error
-	}
+// Update event details, changes maps column names to new values with nil clearing a date or the cover photo.
+// Returns the updated event.
+func (r *EventRepo) UpdateEvent(eventId uint, changes map[string]interface{}, actor Actor) (*models.Event, error) {
+	var event models.Event
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&event, eventId).Error; err != nil {
+			return fmt.Errorf("event not found: %w", err)
+		}
 
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("event not found or name unchanged")
-	}
+		current := eventDetails(&event)
+		before := make(map[string]interface{}, len(changes))
+		for column, value := range changes {
+			old, ok := current[column]
+			if !ok {
+				return fmt.Errorf("event field %s cannot be updated", column)
+			}
+			before[column] = old
+			current[column] = value
+		}
 
-	return nil
+		starts, _ := current["starts_at"].(*time.Time)
+		ends, _ := current["ends_at"].(*time.Time)
+		if starts != nil && ends != nil && ends.Before(*starts) {
+			return ErrEventDates
+		}
+
+		if coverId, _ := changes["cover_photo_id"].(*uint); coverId != nil {
+			var count int64
+			if err := tx.Model(&models.Photos{}).Where("id = ? AND event_id = ?", *coverId, eventId).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrCoverPhoto
+			}
+		}
+
+		if err := tx.Model(&models.Event{}).Where("id = ?", eventId).Updates(changes).Error; err != nil {
+			return err
+		}
+		if err := WriteAudit(tx, actor, eventId, models.AuditEventUpdated, "event", eventId, before, changes); err != nil {
+			return err
+		}
+
+		return tx.First(&event, eventId).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
 }
 
 // Remove users from events
@@ -113,39 +179,169 @@ func (r *EventRepo) CheckUser(userId, eventId uint) (bool, error) {
 	return count > 0, nil
 }
 
-// Returns all event names and ids for a specific user,
+// Check if a user can access an event, as a member, as an admin of the organization that owns it,
+// or as any member of that organization when the event is visible to the whole organization
+func (r *EventRepo) CheckAccess(userId, eventId uint) (bool, error) {
+	member, err := r.CheckUser(userId, eventId)
+	if err != nil || member {
+		return member, err
+	}
+
+	var count int64
+	err = r.DB.Table("events").
+		Joins("JOIN organization_members ON organization_members.organization_id = events.organization_id").
+		Where("events.id = ? AND organization_members.user_id = ?", eventId, userId).
+		Where("(organization_members.role IN ? OR events.visibility = ?)", models.OrgAdminRoles, models.VisibilityOrganization).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Check if a user is an owner or admin of the organization that owns an event
+func (r *EventRepo) CheckOrgAdmin(userId, eventId uint) (bool, error) {
+	var count int64
+	err := r.DB.Table("events").
+		Joins("JOIN organization_members ON organization_members.organization_id = events.organization_id").
+		Where("events.id = ? AND organization_members.user_id = ? AND organization_members.role IN ?", eventId, userId, models.OrgAdminRoles).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Check if a user owns an event. Admins of the organization that owns the event count as owners.
+func (r *EventRepo) CheckOwner(userId, eventId uint) (bool, error) {
+	admin, err := r.CheckOrgAdmin(userId, eventId)
+	if err != nil || admin {
+		return admin, err
+	}
+
+	var count int64
+	err = r.DB.Table("event_users").Where("event_id = ? AND user_id = ? AND role = ?", eventId, userId, models.RoleOwner).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Set a user's role in an event, adding them to the event if needed
+func (r *EventRepo) SetUserRole(userId, eventId uint, role string) error {
+	member := models.EventUser{
+		EventID: eventId,
+		UserID:  userId,
+		Role:    role,
+	}
+	return r.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "event_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(&member).Error
+}
+
+// Returns the names and ids of every event a user belongs to
+func (r *EventRepo) FindUserEvents(userId uint) ([]ReturnEvents, error) {
+	var events []models.Event
+	if err := r.DB.Model(&models.User{ID: userId}).Association("Events").Find(&events); err != nil {
+		return nil, err
+	}
+
+	result := make([]ReturnEvents, 0, len(events))
+	for _, ev := range events {
+		result = append(result, ReturnEvents{
+			EventName: ev.EventName,
+			EventId:   ev.ID,
+		})
+	}
+	return result, nil
+}
+
+// Returns all events for a specific user with their cover photo, including every event of organizations
+// they administer and organization events visible to every member. Sorted by event date, newest first.
 func (r *EventRepo) FindAllEvents(userId uint) ([]ReturnEventWithImages, error) {
-	var user models.User
-	err := r.DB.Preload("Events").First(&user, userId).Error
+	var events []models.Event
+	err := r.DB.
+		Where("id IN (?)", accessibleEventIDs(r.DB, userId)).
+		Order("COALESCE(starts_at, created_at) DESC, id DESC").
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	covers, err := r.findCoverPhotos(events)
 	if err != nil {
 		return nil, err
 	}
 
-	result := make([]ReturnEventWithImages, 0, len(user.Events))
+	result := make([]ReturnEventWithImages, 0, len(events))
 
-	for _, ev := range user.Events {
+	for _, ev := range events {
 		userCount := r.DB.Model(&ev).Association("Users").Count()
 
-		var images []ImageResults
-		err := r.DB.Model(&models.Photos{}).
-			Select("id, storage_key").
-			Where("event_id = ?", ev.ID).
-			Limit(4).
-			Find(&images).Error
-		if err != nil {
-			return nil, err
+		var cover *ImageResults
+		if c, ok := covers[ev.ID]; ok {
+			cover = &c
 		}
 
 		result = append(result, ReturnEventWithImages{
-			EventId:   ev.ID,
-			EventName: ev.EventName,
-			Images:    images,
-			UserCount: userCount,
+			EventId:        ev.ID,
+			EventName:      ev.EventName,
+			Description:    ev.Description,
+			Location:       ev.Location,
+			StartsAt:       ev.StartsAt,
+			EndsAt:         ev.EndsAt,
+			OrganizationId: ev.OrganizationID,
+			CoverPhoto:     cover,
+			UserCount:      userCount,
 		})
 	}
 	return result, nil
 }
 
+// Subquery of the ids of every event a user can access, the same rules as CheckAccess
+func accessibleEventIDs(db *gorm.DB, userId uint) *gorm.DB {
+	return db.Table("events").
+		Select("events.id").
+		Where("events.id IN (SELECT event_id FROM event_users WHERE user_id = ?)", userId).
+		Or("events.organization_id IN (SELECT organization_id FROM organization_members WHERE user_id = ? AND (role IN ? OR events.visibility = ?))",
+			userId, models.OrgAdminRoles, models.VisibilityOrganization)
+}
+
+// Find the cover photo of each event by event id, the chosen cover or else the newest photo.
+// Photos in the trash are never used.
+func (r *EventRepo) findCoverPhotos(events []models.Event) (map[uint]ImageResults, error) {
+	covers := make(map[uint]ImageResults, len(events))
+	if len(events) == 0 {
+		return covers, nil
+	}
+
+	eventIds := make([]uint, len(events))
+	for i, ev := range events {
+		eventIds[i] = ev.ID
+	}
+
+	var rows []struct {
+		EventId    uint
+		ID         uint
+		StorageKey string
+	}
+	err := r.DB.Table("photos").
+		Select("DISTINCT ON (photos.event_id) photos.event_id, photos.id, photos.storage_key").
+		Joins("JOIN events ON events.id = photos.event_id").
+		Where("photos.event_id IN ? AND photos.deleted_at IS NULL", eventIds).
+		Order("photos.event_id, COALESCE(photos.id = events.cover_photo_id, false) DESC, photos.id DESC").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		covers[row.EventId] = ImageResults{ID: row.ID, StorageKey: row.StorageKey}
+	}
+	return covers, nil
+}
+
 // Find all users who are in the same events as the given user
 func (r *EventRepo) FindAllUsers(userId uint) ([]models.User, error) {
 	var users []models.User
@@ -169,11 +365,20 @@ func (r *EventRepo) FindAllUsers(userId uint) ([]models.User, error) {
 
 // Find event updated at for specific event
 func (r *EventRepo) FindEventMeta(eventId uint) (string, error) {
+	updatedAt, err := r.FindEventUpdatedAt(eventId)
+	if err != nil {
+		return "", err
+	}
+	return updatedAt.UTC().Format(time.RFC3339), nil
+}
+
+// Find the raw updated at timestamp for a specific event
+func (r *EventRepo) FindEventUpdatedAt(eventId uint) (time.Time, error) {
 	var result models.Event
 
-	err := r.DB.Where("id = ?", eventId).First(&result).Error
+	err := r.DB.Select("id", "updated_at").Where("id = ?", eventId).First(&result).Error
 	if err != nil {
-		return "", err
+		return time.Time{}, err
 	}
-	return result.UpdatedAt.UTC().Format(time.RFC3339), nil
+	return result.UpdatedAt, nil
 }
@@ -1,21 +1,46 @@
 package db
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/pubsub"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type EventPersonRepo struct {
-	DB *gorm.DB
+	DB        *gorm.DB
+	Publisher pubsub.Publisher
 }
 
+// Co-occurrence query, photos must show every included person and none of the excluded ones
+type PeopleQuery struct {
+	EventID   uint
+	Include   []uint
+	Exclude   []uint
+	FaceCount *int // exact number of faces, matched or not
+	MinFaces  int
+}
+
+type PhotoMatch struct {
+	ID         uint   `json:"id"`
+	StorageKey string `json:"storage_key"`
+	FaceCount  int    `json:"face_count"`
+}
+
+var (
+	ErrPersonClaimed = errors.New("person is already linked to another user")
+	ErrUserLinked    = errors.New("user is already linked to a person in this event")
+)
+
 type ReturnPeople struct {
 	PersonName string `json:"person_name"`
 	PersonId   uint   `json:"person_id"`
+	UserId     *uint  `json:"user_id"`
 	Key        string `json:"key"`
 	PhotoId    uint   `json:"photo_id"`
 }
@@ -30,7 +55,16 @@ func NewEventPersonRepo(db *gorm.DB) *EventPersonRepo {
 // db transaction setup
 func (r *EventPersonRepo) WithTx(tx *gorm.DB) *EventPersonRepo {
 	return &EventPersonRepo{
-		DB: tx,
+		DB:        tx,
+		Publisher: r.Publisher,
+	}
+}
+
+// live update setup
+func (r *EventPersonRepo) WithPublisher(publisher pubsub.Publisher) *EventPersonRepo {
+	return &EventPersonRepo{
+		DB:        r.DB,
+		Publisher: publisher,
 	}
 }
 
@@ -53,27 +87,127 @@ func (r *EventPersonRepo) NewEventPerson(person *models.EventPerson) (uint, erro
 	if err := r.DB.Model(models.Event{}).Where("id = ?", person.EventID).Update("updated_at", time.Now()).Error; err != nil {
 		return 0, err
 	}
+	if err := EnqueueWebhooks(r.DB, person.EventID, pubsub.PersonCreated, pubsub.PersonData{PersonID: person.ID, Name: person.Name}); err != nil {
+		return 0, err
+	}
+
+	pubsub.Send(context.Background(), r.Publisher, pubsub.Message{
+		Type:    pubsub.PersonCreated,
+		EventID: person.EventID,
+		Data:    pubsub.PersonData{PersonID: person.ID, Name: person.Name},
+	})
 	return person.ID, nil
 }
 
 // Update Event Person name
-func (r *EventPersonRepo) UpdatePersonName(personId uint, newName string) error {
-	// fetch the person's event id
+func (r *EventPersonRepo) UpdatePersonName(personId uint, newName string, actor Actor) error {
+	// fetch the person's event id and current name
 	var person models.EventPerson
-	if err := r.DB.Select("event_id").First(&person, personId).Error; err != nil {
+	if err := r.DB.Select("event_id", "name").First(&person, personId).Error; err != nil {
 		return err
 	}
 
-	if err := r.DB.Model(&models.EventPerson{}).Where("id = ?", personId).Update("name", newName).Error; err != nil {
-		return err
-	}
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.EventPerson{}).Where("id = ?", personId).Update("name", newName).Error; err != nil {
+			return err
+		}
 
-	if err := r.DB.Model(models.Event{}).Where("id = ?", person.EventID).Update("updated_at", time.Now()).Error; err != nil {
+		if err := tx.Model(models.Event{}).Where("id = ?", person.EventID).Update("updated_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		if err := WriteAudit(tx, actor, person.EventID, models.AuditPersonRenamed, "event_person", personId,
+			map[string]string{"name": person.Name},
+			map[string]string{"name": newName}); err != nil {
+			return err
+		}
+
+		return EnqueueWebhooks(tx, person.EventID, pubsub.PersonRenamed, pubsub.PersonData{PersonID: personId, Name: newName})
+	})
+	if err != nil {
 		return err
 	}
+
+	pubsub.Send(context.Background(), r.Publisher, pubsub.Message{
+		Type:    pubsub.PersonRenamed,
+		EventID: person.EventID,
+		Data:    pubsub.PersonData{PersonID: personId, Name: newName},
+	})
 	return nil
 }
 
+// Find an event person by id
+func (r *EventPersonRepo) FindPerson(personId uint) (*models.EventPerson, error) {
+	var person models.EventPerson
+	if err := r.DB.First(&person, personId).Error; err != nil {
+		return nil, err
+	}
+	return &person, nil
+}
+
+// Find the event person linked to a user in an event, creating one named after the user if there is none
+func (r *EventPersonRepo) FindOrCreateUserPerson(eventId, userId uint) (uint, error) {
+	var person models.EventPerson
+	err := r.DB.Select("id").Where("event_id = ? AND user_id = ?", eventId, userId).First(&person).Error
+	if err == nil {
+		return person.ID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	var user models.User
+	if err := r.DB.Select("username").First(&user, userId).Error; err != nil {
+		return 0, err
+	}
+
+	return r.NewEventPerson(&models.EventPerson{
+		Name:    user.Username,
+		EventID: eventId,
+		UserID:  &userId,
+	})
+}
+
+// Link an event person to a user, or unlink them when userId is nil.
+// With onlyUnclaimed set the person must not be linked to a different user (a user claiming themselves).
+func (r *EventPersonRepo) LinkUser(personId uint, userId *uint, onlyUnclaimed bool, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var person models.EventPerson
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "event_id", "user_id").First(&person, personId).Error; err != nil {
+			return err
+		}
+
+		if onlyUnclaimed && person.UserID != nil && (userId == nil || *person.UserID != *userId) {
+			return ErrPersonClaimed
+		}
+
+		if userId != nil {
+			var linked int64
+			err := tx.Model(&models.EventPerson{}).
+				Where("event_id = ? AND user_id = ? AND id <> ?", person.EventID, *userId, personId).
+				Count(&linked).Error
+			if err != nil {
+				return err
+			}
+			if linked > 0 {
+				return ErrUserLinked
+			}
+		}
+
+		if err := tx.Model(&models.EventPerson{}).Where("id = ?", personId).Update("user_id", userId).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(models.Event{}).Where("id = ?", person.EventID).Update("updated_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return WriteAudit(tx, actor, person.EventID, models.AuditPersonLinked, "event_person", personId,
+			map[string]*uint{"user_id": person.UserID},
+			map[string]*uint{"user_id": userId})
+	})
+}
+
 // Find EventPerson name by EventPerson Id
 func (r *EventPersonRepo) FindNameById(personId uint) (string, error) {
 	var result models.EventPerson
@@ -92,10 +226,11 @@ func (r *EventPersonRepo) ReturnEventPeople(eventId uint) ([]ReturnPeople, error
 	err := r.DB.Table("event_people").
 		Select("DISTINCT ON (event_people.id) event_people.name as person_name",
 			"event_people.id as person_id",
+			"event_people.user_id as user_id",
 			"photos.storage_key as key",
 			"photos.id as photo_id").
 		Joins("LEFT JOIN face_detections ON face_detections.event_person_id = event_people.id").
-		Joins("LEFT JOIN photos ON photos.id = face_detections.photo_id").
+		Joins("LEFT JOIN photos ON photos.id = face_detections.photo_id AND photos.deleted_at IS NULL").
 		Where("event_people.event_id = ?", eventId).
 		Order("event_people.id, photos.id").
 		Find(&result).Error
@@ -107,14 +242,91 @@ func (r *EventPersonRepo) ReturnEventPeople(eventId uint) ([]ReturnPeople, error
 	return result, nil
 }
 
-// Find all photo keys for a specific event person
-func (r *EventPersonRepo) FindPhotoKeysForPerson(eventPersonId uint) ([]string, error) {
+// Find photos in an event matching a co-occurrence query.
+// Each photo's detections are grouped once, then counted per include/exclude set in the HAVING clause.
+func (r *EventPersonRepo) FindPhotosWithPeople(query PeopleQuery) ([]PhotoMatch, error) {
+	var result []PhotoMatch
+
+	// repeated ids would make the include count unreachable
+	include := uniqueIDs(query.Include)
+	exclude := uniqueIDs(query.Exclude)
+
+	tx := r.DB.Table("photos").
+		Select("photos.id, photos.storage_key, COUNT(fd.id) AS face_count").
+		Joins("LEFT JOIN face_detections fd ON fd.photo_id = photos.id").
+		Where("photos.event_id = ? AND photos.deleted_at IS NULL", query.EventID).
+		Group("photos.id, photos.storage_key").
+		Order("photos.id")
+
+	if len(include) > 0 {
+		// only group photos that contain at least one included person
+		tx = tx.Where("photos.id IN (?)", r.DB.Table("face_detections").
+			Select("photo_id").
+			Where("event_person_id IN ?", include)).
+			Having("COUNT(DISTINCT fd.event_person_id) FILTER (WHERE fd.event_person_id IN ?) = ?", include, len(include))
+	}
+	if len(exclude) > 0 {
+		tx = tx.Having("COUNT(fd.id) FILTER (WHERE fd.event_person_id IN ?) = 0", exclude)
+	}
+	if query.FaceCount != nil {
+		tx = tx.Having("COUNT(fd.id) = ?", *query.FaceCount)
+	}
+	if query.MinFaces > 0 {
+		tx = tx.Having("COUNT(fd.id) >= ?", query.MinFaces)
+	}
+
+	if err := tx.Scan(&result).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Count photos for each event person, and the distinct photos showing any of them
+func (r *EventPersonRepo) CountPersonPhotos(personIds []uint) (map[uint]int64, int64, error) {
+	counts := make(map[uint]int64, len(personIds))
+	if len(personIds) == 0 {
+		return counts, 0, nil
+	}
+
+	var rows []struct {
+		EventPersonID uint
+		Photos        int64
+	}
+	err := r.DB.Table("face_detections fd").
+		Select("fd.event_person_id, COUNT(DISTINCT fd.photo_id) AS photos").
+		Joins("JOIN photos ON photos.id = fd.photo_id AND photos.deleted_at IS NULL").
+		Where("fd.event_person_id IN ?", personIds).
+		Group("fd.event_person_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, row := range rows {
+		counts[row.EventPersonID] = row.Photos
+	}
+
+	var total int64
+	err = r.DB.Table("face_detections fd").
+		Select("COUNT(DISTINCT fd.photo_id)").
+		Joins("JOIN photos ON photos.id = fd.photo_id AND photos.deleted_at IS NULL").
+		Where("fd.event_person_id IN ?", personIds).
+		Scan(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return counts, total, nil
+}
+
+// Find all photo keys for a specific event person, people from other events find nothing
+func (r *EventPersonRepo) FindPhotoKeysForPerson(eventPersonId, eventId uint) ([]string, error) {
 	var keys []string
 
 	err := r.DB.Table("photos").
 		Select("DISTINCT photos.storage_key").
 		Joins("JOIN face_detections fd ON fd.photo_id = photos.id").
-		Where("fd.event_person_id = ?", eventPersonId).
+		Joins("JOIN event_people ep ON ep.id = fd.event_person_id").
+		Where("fd.event_person_id = ? AND ep.event_id = ? AND photos.event_id = ? AND photos.deleted_at IS NULL", eventPersonId, eventId, eventId).
 		Scan(&keys).Error
 
 	if err != nil {
@@ -11,6 +11,12 @@ type DetectionResults struct {
 	PhotoID       uint    `json:"photo_id"`
 }
 
+type MatchedPerson struct {
+	RekognitionID string
+	PersonID      uint
+	Name          string
+}
+
 type DetectionRepo struct {
 	DB *gorm.DB
 }
@@ -49,6 +55,26 @@ func (r *DetectionRepo) FindMatches(matchID string) (uint, error) {
 	return *matchedDetection.EventPersonID, nil
 }
 
+// Finds the event people for matched faces, ignoring faces that are unassigned, opted out, or in photos or events that are in the trash
+func (r *DetectionRepo) FindActiveMatches(faceIDs []string) ([]MatchedPerson, error) {
+	var result []MatchedPerson
+	if len(faceIDs) == 0 {
+		return result, nil
+	}
+
+	err := r.DB.Table("face_detections").
+		Select("face_detections.rekognition_id, event_people.id AS person_id, event_people.name").
+		Joins("JOIN event_people ON event_people.id = face_detections.event_person_id AND event_people.do_not_recognize = false").
+		Joins("JOIN photos ON photos.id = face_detections.photo_id AND photos.deleted_at IS NULL").
+		Joins("JOIN events ON events.id = face_detections.event_id AND events.deleted_at IS NULL").
+		Where("face_detections.rekognition_id IN ?", faceIDs).
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // Updates FaceDetections table with matching event person ID
 func (r *DetectionRepo) UpdateDetectionsWithPersonID(faceID string, personID string) error {
 	err := r.DB.Model(&models.FaceDetection{}).Where("rekognition_id = ?", faceID).Update("event_person_id", personID).Error
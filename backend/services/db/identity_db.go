@@ -0,0 +1,79 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdentityRepo struct {
+	DB *gorm.DB
+}
+
+// repo constructor
+func NewIdentityRepo(db *gorm.DB) *IdentityRepo {
+	return &IdentityRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *IdentityRepo) WithTx(tx *gorm.DB) *IdentityRepo {
+	return &IdentityRepo{
+		DB: tx,
+	}
+}
+
+// Store a pending login and drop any that have expired
+func (r *IdentityRepo) CreateLoginState(state *models.OIDCLoginState) error {
+	if err := r.DB.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{}).Error; err != nil {
+		return err
+	}
+	return r.DB.Create(state).Error
+}
+
+// Remove and return a pending login so each state is used once, returns nil when it is unknown
+func (r *IdentityRepo) TakeLoginState(state string) (*models.OIDCLoginState, error) {
+	var states []models.OIDCLoginState
+	err := r.DB.Clauses(clause.Returning{}).Where("state = ?", state).Delete(&states).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(states) == 0 {
+		return nil, nil
+	}
+	return &states[0], nil
+}
+
+// Find the user linked to a provider's subject, returns nil when the identity is not linked
+func (r *IdentityRepo) FindUser(provider, subject string) (*models.User, error) {
+	var identity models.UserIdentity
+	err := r.DB.Preload("User").Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity.User, nil
+}
+
+// Link an identity to an existing user
+func (r *IdentityRepo) LinkIdentity(user *models.User, identity *models.UserIdentity) error {
+	identity.UserID = user.ID
+	return r.DB.Create(identity).Error
+}
+
+// Create a user together with their first identity
+func (r *IdentityRepo) CreateUser(user *models.User, identity *models.UserIdentity) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return tx.Create(identity).Error
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/pubsub"
 	"gorm.io/gorm"
 )
 
@@ -31,6 +32,12 @@ type EventImages struct {
 	} `json:"event_people"`
 }
 
+type UserPhoto struct {
+	ID         uint   `json:"id"`
+	StorageKey string `json:"storage_key"`
+	EventID    uint   `json:"event_id"`
+}
+
 type EventPersonInfo struct {
 	ID   uint   `json:"id"`
 	Name string `json:"name"`
@@ -63,6 +70,9 @@ func (r *ImageRepo) AddImage(image *models.Photos) (uint, error) {
 	if err := r.DB.Model(models.Event{}).Where("id = ?", image.EventID).Update("updated_at", time.Now()).Error; err != nil {
 		return 0, err
 	}
+	if err := EnqueueWebhooks(r.DB, image.EventID, pubsub.PhotoAdded, pubsub.PhotoData{PhotoID: image.ID, UploadedBy: image.UploadedBy}); err != nil {
+		return 0, err
+	}
 	return image.ID, nil
 }
 
@@ -73,7 +83,7 @@ func (r *ImageRepo) FindAllInCollection(eventPersonId uint) ([]string, []uint, e
 		Table("photos").
 		Select("photos.id, photos.storage_key").
 		Joins("JOIN face_detection ON face_detection.photo_id = photos.id").
-		Where("face_detection.person_id = ?", eventPersonId).
+		Where("face_detection.person_id = ? AND photos.deleted_at IS NULL", eventPersonId).
 		Scan(&storageKeys).Error
 
 	if err != nil {
@@ -89,6 +99,24 @@ func (r *ImageRepo) FindAllInCollection(eventPersonId uint) ([]string, []uint, e
 	return keys, ids, nil
 }
 
+// Find every photo of a user, through the event people linked to them, in events they still belong to
+func (r *ImageRepo) FindUserPhotos(userId uint) ([]UserPhoto, error) {
+	var result []UserPhoto
+	err := r.DB.Table("photos").
+		Select("DISTINCT photos.id, photos.storage_key, photos.event_id").
+		Joins("JOIN face_detections fd ON fd.photo_id = photos.id").
+		Joins("JOIN event_people ep ON ep.id = fd.event_person_id").
+		Joins("JOIN event_users eu ON eu.event_id = photos.event_id AND eu.user_id = ep.user_id").
+		Joins("JOIN events ON events.id = photos.event_id AND events.deleted_at IS NULL").
+		Where("ep.user_id = ? AND photos.deleted_at IS NULL", userId).
+		Order("photos.event_id, photos.id").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // Find all images in a specific event
 func (r *ImageRepo) FindAllEventImages(eventId uint) ([]EventImages, error) {
 	var photos []models.Photos
@@ -0,0 +1,220 @@
+package db
+
+import (
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type InteractionRepo struct {
+	DB *gorm.DB
+}
+
+// Favorites, reactions and comments on one photo, as seen by one viewer
+type PhotoCounts struct {
+	Favorites   int64            `json:"favorites"`
+	Favorited   bool             `json:"favorited"` // the viewer favorited the photo
+	Reactions   map[string]int64 `json:"reactions"` // emoji -> count
+	MyReactions []string         `json:"my_reactions"`
+	Comments    int64            `json:"comments"`
+}
+
+// A comment with its author's name
+type ReturnComment struct {
+	ID        uint      `json:"id"`
+	Body      string    `json:"body"`
+	ParentID  *uint     `json:"parent_id,omitempty"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// repo constructor
+func NewInteractionRepo(db *gorm.DB) *InteractionRepo {
+	return &InteractionRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *InteractionRepo) WithTx(tx *gorm.DB) *InteractionRepo {
+	return &InteractionRepo{
+		DB: tx,
+	}
+}
+
+// Find a photo by id, photos in the trash are not found
+func (r *InteractionRepo) FindPhoto(photoId uint) (*models.Photos, error) {
+	var photo models.Photos
+	if err := r.DB.First(&photo, photoId).Error; err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+// Update the event timestamp so cached event data with the counts is refreshed
+func (r *InteractionRepo) TouchEvent(eventId uint) error {
+	return r.DB.Model(&models.Event{}).Where("id = ?", eventId).Update("updated_at", time.Now()).Error
+}
+
+// Favorite a photo, returns false when the user already had
+func (r *InteractionRepo) AddFavorite(userId, photoId uint) (bool, error) {
+	result := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Favorite{UserID: userId, PhotoID: photoId})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Remove a favorite, returns false when the user had not favorited the photo
+func (r *InteractionRepo) RemoveFavorite(userId, photoId uint) (bool, error) {
+	result := r.DB.Where("user_id = ? AND photo_id = ?", userId, photoId).Delete(&models.Favorite{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Return a user's favorite photos across every event they can still access, newest favorite first.
+// Photos and events in the trash are left out.
+func (r *InteractionRepo) FindUserFavorites(userId uint) ([]UserPhoto, error) {
+	var result []UserPhoto
+	err := r.DB.Table("favorites").
+		Select("photos.id, photos.storage_key, photos.event_id").
+		Joins("JOIN photos ON photos.id = favorites.photo_id AND photos.deleted_at IS NULL").
+		Joins("JOIN events ON events.id = photos.event_id AND events.deleted_at IS NULL").
+		Where("favorites.user_id = ? AND photos.event_id IN (?)", userId, accessibleEventIDs(r.DB, userId)).
+		Order("favorites.created_at DESC, photos.id DESC").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// React to a photo, returns false when the user already reacted with that emoji
+func (r *InteractionRepo) AddReaction(userId, photoId uint, emoji string) (bool, error) {
+	result := r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PhotoReaction{UserID: userId, PhotoID: photoId, Emoji: emoji})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Remove a reaction, returns false when the user had not reacted with that emoji
+func (r *InteractionRepo) RemoveReaction(userId, photoId uint, emoji string) (bool, error) {
+	result := r.DB.Where("user_id = ? AND photo_id = ? AND emoji = ?", userId, photoId, emoji).Delete(&models.PhotoReaction{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Save a new comment
+func (r *InteractionRepo) CreateComment(comment *models.PhotoComment) error {
+	return r.DB.Create(comment).Error
+}
+
+// Find a comment by id
+func (r *InteractionRepo) FindComment(commentId uint) (*models.PhotoComment, error) {
+	var comment models.PhotoComment
+	if err := r.DB.First(&comment, commentId).Error; err != nil {
+		return nil, err
+	}
+	return &comment, nil
+}
+
+// Delete a comment and every reply below it
+func (r *InteractionRepo) DeleteComment(commentId uint) error {
+	return r.DB.Delete(&models.PhotoComment{}, commentId).Error
+}
+
+// Return a photo's comments oldest first, replies carry the id of the comment they answer
+func (r *InteractionRepo) FindComments(photoId uint) ([]ReturnComment, error) {
+	var result []ReturnComment
+	err := r.DB.Table("photo_comments").
+		Select("photo_comments.id, photo_comments.body, photo_comments.parent_id, photo_comments.user_id, users.username, photo_comments.created_at").
+		Joins("JOIN users ON users.id = photo_comments.user_id").
+		Where("photo_comments.photo_id = ?", photoId).
+		Order("photo_comments.created_at, photo_comments.id").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Favorite, reaction and comment counts for every photo in an event that has any, by photo id
+func (r *InteractionRepo) FindEventCounts(eventId, viewerId uint) (map[uint]*PhotoCounts, error) {
+	counts := make(map[uint]*PhotoCounts)
+	get := func(photoId uint) *PhotoCounts {
+		if counts[photoId] == nil {
+			counts[photoId] = &PhotoCounts{Reactions: map[string]int64{}, MyReactions: []string{}}
+		}
+		return counts[photoId]
+	}
+
+	var favorites []struct {
+		PhotoId uint
+		Count   int64
+		Mine    bool
+	}
+	err := r.DB.Table("favorites").
+		Select("favorites.photo_id, COUNT(*) AS count, BOOL_OR(favorites.user_id = ?) AS mine", viewerId).
+		Joins("JOIN photos ON photos.id = favorites.photo_id").
+		Where("photos.event_id = ?", eventId).
+		Group("favorites.photo_id").
+		Scan(&favorites).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range favorites {
+		get(f.PhotoId).Favorites = f.Count
+		get(f.PhotoId).Favorited = f.Mine
+	}
+
+	var reactions []struct {
+		PhotoId uint
+		Emoji   string
+		Count   int64
+		Mine    bool
+	}
+	err = r.DB.Table("photo_reactions").
+		Select("photo_reactions.photo_id, photo_reactions.emoji, COUNT(*) AS count, BOOL_OR(photo_reactions.user_id = ?) AS mine", viewerId).
+		Joins("JOIN photos ON photos.id = photo_reactions.photo_id").
+		Where("photos.event_id = ?", eventId).
+		Group("photo_reactions.photo_id, photo_reactions.emoji").
+		Order("photo_reactions.photo_id, MIN(photo_reactions.created_at)").
+		Scan(&reactions).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, re := range reactions {
+		c := get(re.PhotoId)
+		c.Reactions[re.Emoji] = re.Count
+		if re.Mine {
+			c.MyReactions = append(c.MyReactions, re.Emoji)
+		}
+	}
+
+	var comments []struct {
+		PhotoId uint
+		Count   int64
+	}
+	err = r.DB.Table("photo_comments").
+		Select("photo_comments.photo_id, COUNT(*) AS count").
+		Joins("JOIN photos ON photos.id = photo_comments.photo_id").
+		Where("photos.event_id = ?", eventId).
+		Group("photo_comments.photo_id").
+		Scan(&comments).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, co := range comments {
+		get(co.PhotoId).Comments = co.Count
+	}
+
+	return counts, nil
+}
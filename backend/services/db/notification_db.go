@@ -0,0 +1,71 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+)
+
+type NotificationRepo struct {
+	DB *gorm.DB
+}
+
+// repo constructor
+func NewNotificationRepo(db *gorm.DB) *NotificationRepo {
+	return &NotificationRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *NotificationRepo) WithTx(tx *gorm.DB) *NotificationRepo {
+	return &NotificationRepo{
+		DB: tx,
+	}
+}
+
+// Save a notification for a user, data is stored as JSON
+func (r *NotificationRepo) CreateNotification(userId, eventId uint, notificationType string, data interface{}) (*models.Notification, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode notification data: %w", err)
+	}
+	payload := string(encoded)
+
+	notification := models.Notification{
+		UserID:  userId,
+		EventID: eventId,
+		Type:    notificationType,
+		Data:    &payload,
+	}
+	if err := r.DB.Create(&notification).Error; err != nil {
+		return nil, err
+	}
+	return &notification, nil
+}
+
+// Return a user's most recent notifications, newest first
+func (r *NotificationRepo) FindUserNotifications(userId uint, unreadOnly bool, limit int) ([]models.Notification, error) {
+	tx := r.DB.Where("user_id = ?", userId)
+	if unreadOnly {
+		tx = tx.Where("read_at IS NULL")
+	}
+
+	var notifications []models.Notification
+	if err := tx.Order("id DESC").Limit(limit).Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// Mark a user's notifications as read, all of them when ids is empty
+func (r *NotificationRepo) MarkRead(userId uint, ids []uint) error {
+	tx := r.DB.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userId)
+	if len(ids) > 0 {
+		tx = tx.Where("id IN ?", ids)
+	}
+	return tx.Update("read_at", time.Now()).Error
+}
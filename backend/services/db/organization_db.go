@@ -0,0 +1,182 @@
+package db
+
+import (
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OrganizationRepo struct {
+	DB *gorm.DB
+}
+
+// An organization the user belongs to
+type ReturnOrganization struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Plan string `json:"plan"`
+	Role string `json:"role"`
+}
+
+// A member of an organization
+type ReturnOrgMember struct {
+	UserId   uint      `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// repo constructor
+func NewOrganizationRepo(db *gorm.DB) *OrganizationRepo {
+	return &OrganizationRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *OrganizationRepo) WithTx(tx *gorm.DB) *OrganizationRepo {
+	return &OrganizationRepo{
+		DB: tx,
+	}
+}
+
+// Create an organization with its first owner
+func (r *OrganizationRepo) CreateOrganization(org *models.Organization, ownerId uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.OrganizationMember{
+			OrganizationID: org.ID,
+			UserID:         ownerId,
+			Role:           models.OrgRoleOwner,
+		}).Error
+	})
+}
+
+// Find an organization by id
+func (r *OrganizationRepo) FindOrganization(orgId uint) (*models.Organization, error) {
+	var org models.Organization
+	if err := r.DB.First(&org, orgId).Error; err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+// Find a user's role in an organization, empty when they are not a member
+func (r *OrganizationRepo) FindRole(orgId, userId uint) (string, error) {
+	var roles []string
+	err := r.DB.Model(&models.OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ?", orgId, userId).
+		Limit(1).
+		Pluck("role", &roles).Error
+	if err != nil || len(roles) == 0 {
+		return "", err
+	}
+	return roles[0], nil
+}
+
+// Return every organization a user belongs to with their role
+func (r *OrganizationRepo) FindUserOrganizations(userId uint) ([]ReturnOrganization, error) {
+	var result []ReturnOrganization
+	err := r.DB.Table("organizations").
+		Select("organizations.id, organizations.name, organizations.plan, organization_members.role").
+		Joins("JOIN organization_members ON organization_members.organization_id = organizations.id").
+		Where("organization_members.user_id = ?", userId).
+		Order("organizations.id").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Return the members of an organization, owners and admins first
+func (r *OrganizationRepo) FindMembers(orgId uint) ([]ReturnOrgMember, error) {
+	var result []ReturnOrgMember
+	err := r.DB.Table("organization_members").
+		Select("users.id AS user_id, users.username, organization_members.role, organization_members.created_at AS joined_at").
+		Joins("JOIN users ON users.id = organization_members.user_id").
+		Where("organization_members.organization_id = ?", orgId).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "organization_members.role = ? DESC, organization_members.role = ? DESC, organization_members.created_at",
+			Vars: []interface{}{models.OrgRoleOwner, models.OrgRoleAdmin},
+		}}).
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Add users to an organization with a role, users who are already members keep their role
+func (r *OrganizationRepo) AddMembers(orgId uint, userIds []uint, role string) error {
+	members := make([]models.OrganizationMember, len(userIds))
+	for i, id := range userIds {
+		members[i] = models.OrganizationMember{OrganizationID: orgId, UserID: id, Role: role}
+	}
+	return r.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+}
+
+// Change a member's role, returns false when the user is not a member
+func (r *OrganizationRepo) SetRole(orgId, userId uint, role string) (bool, error) {
+	result := r.DB.Model(&models.OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ?", orgId, userId).
+		Update("role", role)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Remove a member, returns false when the user is not a member
+func (r *OrganizationRepo) RemoveMember(orgId, userId uint) (bool, error) {
+	result := r.DB.Where("organization_id = ? AND user_id = ?", orgId, userId).Delete(&models.OrganizationMember{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Count the owners of an organization
+func (r *OrganizationRepo) CountOwners(orgId uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.OrganizationMember{}).
+		Where("organization_id = ? AND role = ?", orgId, models.OrgRoleOwner).
+		Count(&count).Error
+	return count, err
+}
+
+// Return the events an organization owns, events in the trash are left out
+func (r *OrganizationRepo) FindEvents(orgId uint) ([]ReturnEvents, error) {
+	var result []ReturnEvents
+	err := r.DB.Model(&models.Event{}).
+		Select("event_name, id AS event_id").
+		Where("organization_id = ?", orgId).
+		Order("id").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Move an event into an organization, or back to its members when orgId is nil
+func (r *OrganizationRepo) SetEventOrganization(eventId uint, orgId *uint, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var event models.Event
+		if err := tx.Select("id", "organization_id").First(&event, eventId).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Event{}).Where("id = ?", eventId).Update("organization_id", orgId).Error; err != nil {
+			return err
+		}
+
+		return WriteAudit(tx, actor, eventId, models.AuditEventOrganization, "event", eventId,
+			map[string]interface{}{"organization_id": event.OrganizationID},
+			map[string]interface{}{"organization_id": orgId})
+	})
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type QuotaRepo struct {
+	DB *gorm.DB
+}
+
+// Usage counters, photos in the trash still count until purged
+type Usage struct {
+	Bytes     int64 `json:"bytes"`
+	Photos    int64 `json:"photos"`
+	FaceCalls int64 `json:"face_calls"` // for the current period
+}
+
+// repo constructor
+func NewQuotaRepo(db *gorm.DB) *QuotaRepo {
+	return &QuotaRepo{
+		DB: db,
+	}
+}
+
+// Add face API calls to the counter for a user and event in a period
+func (r *QuotaRepo) RecordFaceCalls(userId, eventId uint, period string, calls int64) error {
+	usage := models.FaceAPIUsage{
+		UserID:  userId,
+		EventID: eventId,
+		Period:  period,
+		Calls:   calls,
+	}
+	return r.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "event_id"}, {Name: "period"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"calls": gorm.Expr("face_api_usages.calls + EXCLUDED.calls"),
+		}),
+	}).Create(&usage).Error
+}
+
+// Find storage and face API usage for photos a user uploaded outside organization events
+func (r *QuotaRepo) UserUsage(userId uint, period string) (Usage, error) {
+	return r.usage("photos.uploaded_by = ? AND events.organization_id IS NULL",
+		"face_api_usages.user_id = ? AND events.organization_id IS NULL", userId, period)
+}
+
+// Find storage and face API usage for an event
+func (r *QuotaRepo) EventUsage(eventId uint, period string) (Usage, error) {
+	return r.usage("photos.event_id = ?", "face_api_usages.event_id = ?", eventId, period)
+}
+
+// Find storage and face API usage across every event an organization owns
+func (r *QuotaRepo) OrganizationUsage(orgId uint, period string) (Usage, error) {
+	return r.usage("events.organization_id = ?", "events.organization_id = ?", orgId, period)
+}
+
+// Filters can use the photo's or counter's event, usage of purged events no longer belongs to an organization
+func (r *QuotaRepo) usage(photoFilter, callFilter string, id uint, period string) (Usage, error) {
+	var usage Usage
+
+	err := r.DB.Unscoped().Model(&models.Photos{}).
+		Select("COALESCE(SUM(photos.size_bytes), 0) AS bytes, COUNT(*) AS photos").
+		Joins("LEFT JOIN events ON events.id = photos.event_id").
+		Where(photoFilter, id).
+		Scan(&usage).Error
+	if err != nil {
+		return Usage{}, err
+	}
+
+	err = r.DB.Model(&models.FaceAPIUsage{}).
+		Select("COALESCE(SUM(face_api_usages.calls), 0)").
+		Joins("LEFT JOIN events ON events.id = face_api_usages.event_id").
+		Where(callFilter+" AND face_api_usages.period = ?", id, period).
+		Scan(&usage.FaceCalls).Error
+	if err != nil {
+		return Usage{}, err
+	}
+
+	return usage, nil
+}
+
+// Find the organization owning an event and its plan, 0 when a user owns the event
+func (r *QuotaRepo) FindEventOrganization(eventId uint) (uint, string, error) {
+	var rows []struct {
+		ID   uint
+		Plan string
+	}
+	err := r.DB.Table("organizations").
+		Select("organizations.id, organizations.plan").
+		Joins("JOIN events ON events.organization_id = organizations.id").
+		Where("events.id = ?", eventId).
+		Limit(1).
+		Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return 0, "", err
+	}
+	return rows[0].ID, rows[0].Plan, nil
+}
+
+// Find the plan of the event owner, empty if the event has no owner
+func (r *QuotaRepo) FindEventPlan(eventId uint) (string, error) {
+	var plans []string
+	err := r.DB.Table("users").
+		Joins("JOIN event_users ON event_users.user_id = users.id").
+		Where("event_users.event_id = ? AND event_users.role = ?", eventId, models.RoleOwner).
+		Limit(1).
+		Pluck("users.plan", &plans).Error
+	if err != nil || len(plans) == 0 {
+		return "", err
+	}
+	return plans[0], nil
+}
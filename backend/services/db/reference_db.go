@@ -0,0 +1,123 @@
+package db
+
+import (
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+)
+
+type ReferenceRepo struct {
+	DB *gorm.DB
+}
+
+// repo constructor
+func NewReferenceRepo(db *gorm.DB) *ReferenceRepo {
+	return &ReferenceRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *ReferenceRepo) WithTx(tx *gorm.DB) *ReferenceRepo {
+	return &ReferenceRepo{
+		DB: tx,
+	}
+}
+
+// Save a new reference selfie
+func (r *ReferenceRepo) CreateReference(ref *models.ReferenceFace) error {
+	return r.DB.Create(ref).Error
+}
+
+// Find a reference selfie with the collections it is indexed in
+func (r *ReferenceRepo) FindReference(referenceId uint) (*models.ReferenceFace, error) {
+	var ref models.ReferenceFace
+	if err := r.DB.Preload("Indexes").First(&ref, referenceId).Error; err != nil {
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// Return all reference selfies for a user
+func (r *ReferenceRepo) FindUserReferences(userId uint) ([]models.ReferenceFace, error) {
+	var refs []models.ReferenceFace
+	if err := r.DB.Where("user_id = ?", userId).Order("id").Find(&refs).Error; err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// Return the reference selfies of the given users that are not indexed in the event yet and may be recognised there
+func (r *ReferenceRepo) FindUnindexed(userIds []uint, eventId uint) ([]models.ReferenceFace, error) {
+	var refs []models.ReferenceFace
+	// users that opted out everywhere or in this event are skipped
+	err := r.DB.
+		Joins("JOIN users ON users.id = reference_faces.user_id AND users.recognition_opt_out = false").
+		Joins("JOIN event_users ON event_users.user_id = reference_faces.user_id AND event_users.event_id = ? AND event_users.recognition_opt_out = false", eventId).
+		Joins("JOIN events ON events.id = event_users.event_id AND events.recognition_mode <> ?", models.RecognitionOff).
+		Where("reference_faces.user_id IN ?", userIds).
+		Where("NOT EXISTS (SELECT 1 FROM reference_face_indices rfi WHERE rfi.reference_face_id = reference_faces.id AND rfi.event_id = ?)", eventId).
+		Find(&refs).Error
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// Record a reference selfie indexed into an event collection
+func (r *ReferenceRepo) SaveIndex(index *models.ReferenceFaceIndex) error {
+	return r.DB.Create(index).Error
+}
+
+// Map matched face ids to the user whose reference selfie they are.
+// References of users who are no longer in the event map to 0 so they can still be skipped.
+func (r *ReferenceRepo) FindReferenceMatches(eventId uint, faceIds []string) (map[string]uint, error) {
+	matches := make(map[string]uint)
+	if len(faceIds) == 0 {
+		return matches, nil
+	}
+
+	var rows []struct {
+		RekognitionID string
+		UserID        uint
+	}
+	err := r.DB.Table("reference_face_indices rfi").
+		Select("rfi.rekognition_id, COALESCE(event_users.user_id, 0) AS user_id").
+		Joins("JOIN reference_faces rf ON rf.id = rfi.reference_face_id").
+		Joins("LEFT JOIN event_users ON event_users.event_id = rfi.event_id AND event_users.user_id = rf.user_id").
+		Where("rfi.event_id = ? AND rfi.rekognition_id IN ?", eventId, faceIds).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		matches[row.RekognitionID] = row.UserID
+	}
+	return matches, nil
+}
+
+// Find where a user's reference selfies are indexed in one event
+func (r *ReferenceRepo) FindEventIndexes(userId, eventId uint) ([]models.ReferenceFaceIndex, error) {
+	var indexes []models.ReferenceFaceIndex
+	err := r.DB.
+		Joins("JOIN reference_faces ON reference_faces.id = reference_face_indices.reference_face_id").
+		Where("reference_faces.user_id = ? AND reference_face_indices.event_id = ?", userId, eventId).
+		Find(&indexes).Error
+	if err != nil {
+		return nil, err
+	}
+	return indexes, nil
+}
+
+// Delete index records
+func (r *ReferenceRepo) DeleteIndexes(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.DB.Delete(&models.ReferenceFaceIndex{}, ids).Error
+}
+
+// Delete a reference selfie and its index records
+func (r *ReferenceRepo) DeleteReference(referenceId uint) error {
+	return r.DB.Delete(&models.ReferenceFace{}, referenceId).Error
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+)
+
+type RenditionRepo struct {
+	DB *gorm.DB
+}
+
+// A stored face box with the photo it belongs to
+type PhotoBox struct {
+	PhotoID uint
+	Box     models.FaceBox `gorm:"embedded;embeddedPrefix:box_"`
+}
+
+// repo constructor
+func NewRenditionRepo(db *gorm.DB) *RenditionRepo {
+	return &RenditionRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *RenditionRepo) WithTx(tx *gorm.DB) *RenditionRepo {
+	return &RenditionRepo{
+		DB: tx,
+	}
+}
+
+// Find the given photos, including ones in the trash
+func (r *RenditionRepo) FindPhotos(photoIds []uint) ([]models.Photos, error) {
+	var photos []models.Photos
+	if err := r.DB.Unscoped().Where("id IN ?", photoIds).Find(&photos).Error; err != nil {
+		return nil, err
+	}
+	return photos, nil
+}
+
+// Find the face boxes of do not recognise people in the given photos, grouped by photo id
+func (r *RenditionRepo) FindOptedOutBoxes(photoIds []uint) (map[uint][]models.FaceBox, error) {
+	var rows []PhotoBox
+	err := r.DB.Table("face_detections").
+		Select("face_detections.photo_id, face_detections.box_left, face_detections.box_top, face_detections.box_width, face_detections.box_height").
+		Joins("JOIN event_people ON event_people.id = face_detections.event_person_id").
+		Where("face_detections.photo_id IN ? AND event_people.do_not_recognize = true", photoIds).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	boxes := make(map[uint][]models.FaceBox)
+	for _, row := range rows {
+		boxes[row.PhotoID] = append(boxes[row.PhotoID], row.Box)
+	}
+	return boxes, nil
+}
+
+// Set the key of a photo's blurred copy, empty when it no longer needs one, and clear its needs blur flag.
+// The event timestamp is bumped so cached image listings pick up the new urls.
+func (r *RenditionRepo) SetBlurredKey(photo *models.Photos, key string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		changes := map[string]interface{}{"blurred_key": key, "needs_blur": false}
+		if err := tx.Unscoped().Model(&models.Photos{}).Where("id = ?", photo.ID).Updates(changes).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Event{}).Where("id = ?", photo.EventID).Update("updated_at", time.Now()).Error
+	})
+}
+
+// Flag a photo whose blurred copy is missing or out of date, so restricted viewers get a placeholder until it is rendered.
+// The event timestamp is bumped so cached image listings pick up the change.
+func (r *RenditionRepo) SetNeedsBlur(photo *models.Photos) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Photos{}).Where("id = ?", photo.ID).Update("needs_blur", true).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Event{}).Where("id = ?", photo.EventID).Update("updated_at", time.Now()).Error
+	})
+}
+
+// Find the ids of photos still waiting for a blurred copy, oldest first
+func (r *RenditionRepo) FindNeedsBlurIds(limit int) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Unscoped().Model(&models.Photos{}).
+		Where("needs_blur = true").
+		Order("id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Find the ids of every photo an event person appears in
+func (r *RenditionRepo) FindPersonPhotoIds(personId uint) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Model(&models.FaceDetection{}).
+		Where("event_person_id = ?", personId).
+		Distinct().
+		Pluck("photo_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Map storage keys to the blurred copy the viewer should see instead, empty while the photo still needs blurring.
+// Uploaders, event owners and admins of the owning organization always see the original, keys without a blurred copy are left out.
+func (r *RenditionRepo) FindViewKeys(viewerId uint, keys []string) (map[string]string, error) {
+	var rows []struct {
+		StorageKey string
+		BlurredKey string
+	}
+	err := r.DB.Table("photos").
+		Select("photos.storage_key, CASE WHEN photos.needs_blur THEN '' ELSE photos.blurred_key END AS blurred_key").
+		Where("photos.storage_key IN ? AND (photos.blurred_key <> '' OR photos.needs_blur) AND photos.uploaded_by <> ?", keys, viewerId).
+		Where("NOT EXISTS (SELECT 1 FROM event_users o WHERE o.event_id = photos.event_id AND o.user_id = ? AND o.role = ?)", viewerId, models.RoleOwner).
+		Where("NOT EXISTS (SELECT 1 FROM events e JOIN organization_members m ON m.organization_id = e.organization_id WHERE e.id = photos.event_id AND m.user_id = ? AND m.role IN ?)", viewerId, models.OrgAdminRoles).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	viewKeys := make(map[string]string, len(rows))
+	for _, row := range rows {
+		viewKeys[row.StorageKey] = row.BlurredKey
+	}
+	return viewKeys, nil
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+)
+
+type RetentionRepo struct {
+	DB *gorm.DB
+}
+
+// repo constructor
+func NewRetentionRepo(db *gorm.DB) *RetentionRepo {
+	return &RetentionRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *RetentionRepo) WithTx(tx *gorm.DB) *RetentionRepo {
+	return &RetentionRepo{
+		DB: tx,
+	}
+}
+
+// Set or clear an event's expiry. Changing it resets the warning so members are told about the new date.
+func (r *RetentionRepo) SetRetention(eventId uint, expiresAt *time.Time, action string, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var event models.Event
+		if err := tx.Select("id", "expires_at", "expiry_action").First(&event, eventId).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&models.Event{}).Where("id = ?", eventId).Updates(map[string]interface{}{
+			"expires_at":       expiresAt,
+			"expiry_action":    action,
+			"expiry_warned_at": nil,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return WriteAudit(tx, actor, eventId, models.AuditRetention, "event", eventId,
+			map[string]interface{}{"expires_at": event.ExpiresAt, "expiry_action": event.ExpiryAction},
+			map[string]interface{}{"expires_at": expiresAt, "expiry_action": action})
+	})
+}
+
+// Find events expiring before cutoff whose members have not been warned yet
+func (r *RetentionRepo) FindUnwarned(cutoff time.Time, limit int) ([]models.Event, error) {
+	var events []models.Event
+	err := r.DB.
+		Where("expires_at IS NOT NULL AND expires_at <= ? AND expiry_warned_at IS NULL AND archived_at IS NULL", cutoff).
+		Order("expires_at").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Find events that have expired and not been archived yet, events in the trash are left out
+func (r *RetentionRepo) FindExpired(now time.Time, limit int) ([]models.Event, error) {
+	var events []models.Event
+	err := r.DB.
+		Where("expires_at IS NOT NULL AND expires_at <= ? AND archived_at IS NULL", now).
+		Order("expires_at").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Return the ids of every member of an event
+func (r *RetentionRepo) FindMemberIds(eventId uint) ([]uint, error) {
+	var ids []uint
+	if err := r.DB.Model(&models.EventUser{}).Where("event_id = ?", eventId).Pluck("user_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Record that an event's members were warned about its expiry
+func (r *RetentionRepo) MarkWarned(eventId uint) error {
+	return r.DB.Model(&models.Event{}).Where("id = ?", eventId).Update("expiry_warned_at", time.Now()).Error
+}
+
+// Record that an expired event was archived
+func (r *RetentionRepo) MarkArchived(eventId uint, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Event{}).Where("id = ?", eventId).Update("archived_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return WriteAudit(tx, actor, eventId, models.AuditEventArchived, "event", eventId, nil, nil)
+	})
+}
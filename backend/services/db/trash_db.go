@@ -0,0 +1,153 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+)
+
+type TrashRepo struct {
+	DB *gorm.DB
+}
+
+type TrashEvent struct {
+	EventId   uint      `json:"event_id"`
+	EventName string    `json:"event_name"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type TrashPhoto struct {
+	ID         uint      `json:"id"`
+	EventId    uint      `json:"event_id"`
+	StorageKey string    `json:"storage_key"`
+	DeletedAt  time.Time `json:"deleted_at"`
+}
+
+// repo constructor
+func NewTrashRepo(db *gorm.DB) *TrashRepo {
+	return &TrashRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *TrashRepo) WithTx(tx *gorm.DB) *TrashRepo {
+	return &TrashRepo{
+		DB: tx,
+	}
+}
+
+// Find deleted events the user is a member of
+func (r *TrashRepo) FindDeletedEvents(userId uint) ([]TrashEvent, error) {
+	var result []TrashEvent
+	err := r.DB.Table("events").
+		Select("events.id as event_id, events.event_name, events.deleted_at").
+		Joins("JOIN event_users ON event_users.event_id = events.id").
+		Where("event_users.user_id = ? AND events.deleted_at IS NOT NULL", userId).
+		Order("events.deleted_at DESC").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Find deleted photos in an event
+func (r *TrashRepo) FindDeletedPhotos(eventId uint) ([]TrashPhoto, error) {
+	var result []TrashPhoto
+	err := r.DB.Table("photos").
+		Select("id, event_id, storage_key, deleted_at").
+		Where("event_id = ? AND deleted_at IS NOT NULL", eventId).
+		Order("deleted_at DESC").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Find a deleted photo by id
+func (r *TrashRepo) FindDeletedPhoto(photoId uint) (*models.Photos, error) {
+	var photo models.Photos
+	if err := r.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&photo, photoId).Error; err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+// Restore a deleted photo, its event must not be in the trash
+func (r *TrashRepo) RestorePhoto(photoId uint, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var photo models.Photos
+		if err := tx.Unscoped().Where("deleted_at IS NOT NULL").First(&photo, photoId).Error; err != nil {
+			return fmt.Errorf("photo not found in trash: %w", err)
+		}
+
+		if err := tx.Select("id").First(&models.Event{}, photo.EventID).Error; err != nil {
+			return fmt.Errorf("restore the photo's event first: %w", err)
+		}
+
+		if err := tx.Unscoped().Model(&models.Photos{}).Where("id = ?", photoId).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Event{}).Where("id = ?", photo.EventID).Update("updated_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		return WriteAudit(tx, actor, photo.EventID, models.AuditPhotoRestored, "photo", photoId, nil, map[string]interface{}{"storage_key": photo.StorageKey})
+	})
+}
+
+// Restore a deleted event
+func (r *TrashRepo) RestoreEvent(eventId uint, actor Actor) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&models.Event{}).
+			Where("id = ? AND deleted_at IS NOT NULL", eventId).
+			Updates(map[string]interface{}{"deleted_at": nil, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("event not found in trash: %w", gorm.ErrRecordNotFound)
+		}
+
+		// an event restored after it expired would be deleted again by the next retention run
+		err := tx.Model(&models.Event{}).
+			Where("id = ? AND expires_at <= ?", eventId, time.Now()).
+			Updates(map[string]interface{}{"expires_at": nil, "expiry_warned_at": nil}).Error
+		if err != nil {
+			return err
+		}
+
+		return WriteAudit(tx, actor, eventId, models.AuditEventRestored, "event", eventId, nil, nil)
+	})
+}
+
+// Find ids of events deleted before the cutoff
+func (r *TrashRepo) FindExpiredEventIDs(cutoff time.Time) ([]uint, error) {
+	var ids []uint
+	err := r.DB.Unscoped().Model(&models.Event{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Find photos deleted before the cutoff, with their face detections
+func (r *TrashRepo) FindExpiredPhotos(cutoff time.Time, limit int) ([]models.Photos, error) {
+	var photos []models.Photos
+	err := r.DB.Unscoped().Preload("FaceDetections").
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Order("deleted_at").
+		Limit(limit).
+		Find(&photos).Error
+	if err != nil {
+		return nil, err
+	}
+	return photos, nil
+}
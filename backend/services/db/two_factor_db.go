@@ -0,0 +1,111 @@
+package db
+
+import (
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+)
+
+type TwoFactorRepo struct {
+	DB *gorm.DB
+}
+
+// repo constructor
+func NewTwoFactorRepo(db *gorm.DB) *TwoFactorRepo {
+	return &TwoFactorRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *TwoFactorRepo) WithTx(tx *gorm.DB) *TwoFactorRepo {
+	return &TwoFactorRepo{
+		DB: tx,
+	}
+}
+
+// Store a new secret for a user who is enrolling, TOTP stays off until a code is confirmed
+func (r *TwoFactorRepo) SetPendingSecret(userId uint, secret string) error {
+	return r.DB.Model(&models.User{}).
+		Where("id = ? AND totp_enabled = false", userId).
+		UpdateColumns(map[string]interface{}{
+			"totp_secret":    secret,
+			"totp_last_step": 0,
+		}).Error
+}
+
+// Turn TOTP on and replace the user's recovery codes
+func (r *TwoFactorRepo) Enable(userId uint, step int64, codeHashes []string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userId).UpdateColumns(map[string]interface{}{
+			"totp_enabled":    true,
+			"totp_enabled_at": time.Now(),
+			"totp_last_step":  step,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return r.WithTx(tx).ReplaceRecoveryCodes(userId, codeHashes)
+	})
+}
+
+// Turn TOTP off, clearing the secret and recovery codes
+func (r *TwoFactorRepo) Disable(userId uint) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userId).UpdateColumns(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled":    false,
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// Swap a user's recovery codes for new ones
+func (r *TwoFactorRepo) ReplaceRecoveryCodes(userId uint, codeHashes []string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		codes := make([]models.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = models.RecoveryCode{UserID: userId, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// Record the step of an accepted code. Returns false when a code for the same or a later step was already used.
+func (r *TwoFactorRepo) UseStep(userId uint, step int64) (bool, error) {
+	result := r.DB.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", userId, step).
+		UpdateColumn("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Mark an unused recovery code as used. Returns false when the code is unknown or already used.
+func (r *TwoFactorRepo) UseRecoveryCode(userId uint, codeHash string) (bool, error) {
+	result := r.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Count a user's unused recovery codes
+func (r *TwoFactorRepo) CountRecoveryCodes(userId uint) (int64, error) {
+	var count int64
+	err := r.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userId).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,214 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/pubsub"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepo struct {
+	DB *gorm.DB
+}
+
+type ReturnWebhook struct {
+	ID         uint      `json:"id"`
+	EventID    uint      `json:"event_id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// repo constructor
+func NewWebhookRepo(db *gorm.DB) *WebhookRepo {
+	return &WebhookRepo{
+		DB: db,
+	}
+}
+
+// db transaction setup
+func (r *WebhookRepo) WithTx(tx *gorm.DB) *WebhookRepo {
+	return &WebhookRepo{
+		DB: tx,
+	}
+}
+
+// Queue a delivery for every webhook on the event subscribed to this event type.
+// Pass the db handle that made the change so deliveries are only queued if its transaction commits.
+func EnqueueWebhooks(tx *gorm.DB, eventID uint, eventType string, data interface{}) error {
+	var hooks []models.Webhook
+	if err := tx.Where("event_id = ?", eventID).Find(&hooks).Error; err != nil {
+		return fmt.Errorf("failed to find webhooks for event %d: %w", eventID, err)
+	}
+
+	payload, err := json.Marshal(pubsub.Message{
+		Type:    eventType,
+		EventID: eventID,
+		Data:    data,
+		SentAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	var deliveries []models.WebhookDelivery
+	for _, hook := range hooks {
+		if !hook.Subscribes(eventType) {
+			continue
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventType:     eventType,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return tx.Create(&deliveries).Error
+}
+
+// Create a new webhook
+func (r *WebhookRepo) CreateWebhook(hook *models.Webhook) error {
+	return r.DB.Create(hook).Error
+}
+
+// Find a webhook by id
+func (r *WebhookRepo) FindWebhook(webhookId uint) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := r.DB.First(&hook, webhookId).Error; err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// Return all webhooks registered on an event
+func (r *WebhookRepo) FindEventWebhooks(eventId uint) ([]ReturnWebhook, error) {
+	var hooks []models.Webhook
+	if err := r.DB.Where("event_id = ?", eventId).Order("id").Find(&hooks).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]ReturnWebhook, 0, len(hooks))
+	for _, hook := range hooks {
+		result = append(result, ToReturnWebhook(hook))
+	}
+	return result, nil
+}
+
+// Delete a webhook along with its deliveries
+func (r *WebhookRepo) DeleteWebhook(webhookId uint) error {
+	return r.DB.Delete(&models.Webhook{}, webhookId).Error
+}
+
+// Return the most recent deliveries for a webhook with their attempt log
+func (r *WebhookRepo) FindDeliveries(webhookId uint, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := r.DB.Preload("AttemptLog", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("attempted_at")
+	}).
+		Where("webhook_id = ?", webhookId).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Find a delivery with its webhook
+func (r *WebhookRepo) FindDelivery(deliveryId uint) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := r.DB.Preload("Webhook").First(&delivery, deliveryId).Error; err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Claim pending deliveries that are due, pushing their next attempt out by lease so other instances skip them
+func (r *WebhookRepo) ClaimDueDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	var ids []uint
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		var due []models.WebhookDelivery
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Select("id").
+			Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&due).Error
+		if err != nil {
+			return err
+		}
+
+		for _, d := range due {
+			ids = append(ids, d.ID)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", time.Now().Add(lease)).Error
+	})
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := r.DB.Preload("Webhook").Where("id IN ?", ids).Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Log an attempt and update the delivery, nextAttempt is ignored once the delivery is delivered or failed
+func (r *WebhookRepo) RecordAttempt(delivery *models.WebhookDelivery, attempt models.WebhookAttempt, status string, nextAttempt time.Time) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		attempt.DeliveryID = delivery.ID
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"status":           status,
+			"attempts":         gorm.Expr("attempts + 1"),
+			"last_status_code": attempt.StatusCode,
+			"last_error":       attempt.Error,
+			"next_attempt_at":  nextAttempt,
+		}
+		if status == models.DeliveryDelivered {
+			updates["delivered_at"] = attempt.AttemptedAt
+		}
+
+		return tx.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error
+	})
+}
+
+// Reset a delivery so it is sent again on the next dispatch
+func (r *WebhookRepo) ReplayDelivery(deliveryId uint) error {
+	return r.DB.Model(&models.WebhookDelivery{}).Where("id = ?", deliveryId).Updates(map[string]interface{}{
+		"status":          models.DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+		"delivered_at":    nil,
+	}).Error
+}
+
+// Convert a webhook model to the api response
+func ToReturnWebhook(hook models.Webhook) ReturnWebhook {
+	return ReturnWebhook{
+		ID:         hook.ID,
+		EventID:    hook.EventID,
+		URL:        hook.URL,
+		EventTypes: strings.Split(hook.EventTypes, ","),
+		CreatedAt:  hook.CreatedAt,
+	}
+}
@@ -17,10 +17,40 @@ type EventService struct {
 	RekognitionClient *rekognition.Client
 }
 
-// Delete Event
-func (s *EventService) DeleteEvent(ctx context.Context, eventID uint) error {
+// Soft delete Event, photos and faces are kept until the event is purged from the trash
+func (s *EventService) DeleteEvent(ctx context.Context, eventID uint, actor db.Actor) error {
 	tx := s.EventRepo.DB.Begin()
 
+	var event models.Event
+	if err := tx.First(&event, eventID).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("event %d not found: %w", eventID, err)
+	}
+
+	var photoCount int64
+	if err := tx.Model(&models.Photos{}).Where("event_id = ?", eventID).Count(&photoCount).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to count photos for event %d: %w", eventID, err)
+	}
+
+	if err := tx.Delete(&event).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete event %d from DB: %w", eventID, err)
+	}
+
+	before := map[string]interface{}{"event_name": event.EventName, "photo_count": photoCount}
+	if err := db.WriteAudit(tx, actor, eventID, models.AuditEventDeleted, "event", eventID, before, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Permanently delete an event, its S3 objects and its Rekognition collection
+func (s *EventService) PurgeEvent(ctx context.Context, eventID uint) error {
+	tx := s.EventRepo.DB.Unscoped().Begin()
+
 	// delete photos + S3 objects
 	var photos []models.Photos
 	if err := tx.Where("event_id = ?", eventID).Find(&photos).Error; err != nil {
@@ -30,7 +60,7 @@ func (s *EventService) DeleteEvent(ctx context.Context, eventID uint) error {
 
 	var keys []string
 	for _, p := range photos {
-		keys = append(keys, p.StorageKey)
+		keys = append(keys, p.ObjectKeys()...)
 	}
 
 	bucketName := os.Getenv("BUCKET_NAME")
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// Extra space kept around each face as a fraction of the box, Rekognition needs some context to find the face again
+	cropPadding = 0.25
+	// Extra space blurred around each face so hair and edges are covered too
+	blurPadding = 0.15
+	// Blurred faces are pixelated into this many blocks across
+	blurBlocks = 8
+)
+
+// Cut each bounding box out of an encoded jpeg or png, returns the crops as jpegs.
+// Boxes are relative to the image as displayed, after its EXIF orientation is applied.
+func CropFaces(data []byte, boxes []BoundingBox) ([][]byte, error) {
+	img, err := decodeOriented(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("unsupported image format")
+	}
+
+	crops := make([][]byte, len(boxes))
+	for i, box := range boxes {
+		rect := faceRect(img.Bounds(), box, cropPadding)
+		if rect.Empty() {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, sub.SubImage(rect), &jpeg.Options{Quality: 90}); err != nil {
+			return nil, fmt.Errorf("failed to encode face %d: %w", i, err)
+		}
+		crops[i] = buf.Bytes()
+	}
+
+	return crops, nil
+}
+
+// Pixelate each bounding box in an encoded jpeg or png, returns the result as a jpeg.
+// The result is stored upright since jpegs are encoded without the EXIF orientation.
+func BlurFaces(data []byte, boxes []BoundingBox) ([]byte, error) {
+	img, err := decodeOriented(data)
+	if err != nil {
+		return nil, err
+	}
+
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	for _, box := range boxes {
+		rect := faceRect(out.Bounds(), box, blurPadding)
+		if rect.Empty() {
+			continue
+		}
+		pixelate(out, rect, max(rect.Dx()/blurBlocks, 1))
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, out, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, fmt.Errorf("failed to encode blurred image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// A plain grey jpeg shown in place of photos that cannot be shown blurred yet
+func BlurPendingImage() ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: 200, G: 200, B: 200, A: 255}}, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		return nil, fmt.Errorf("failed to encode placeholder: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode a jpeg or png and turn it the way its EXIF orientation says it is displayed
+func decodeOriented(data []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return orient(img, exifOrientation(data)), nil
+}
+
+// Apply an EXIF orientation (1-8) to an image, 1 and unknown values leave it as it is
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// source pixel shown at x, y
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // upside down
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				sx, sy = x, h-1-y
+			case 5: // mirrored across the main diagonal
+				sx, sy = y, x
+			case 6: // turned 90 counter clockwise, shown turned back clockwise
+				sx, sy = y, h-1-x
+			case 7: // mirrored across the other diagonal
+				sx, sy = w-1-y, h-1-x
+			case 8: // turned 90 clockwise, shown turned back counter clockwise
+				sx, sy = w-1-y, x
+			}
+			out.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return out
+}
+
+// Read the orientation tag from a jpeg's EXIF data, 1 (upright) when there is none
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // image data starts, no more metadata
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// Find the orientation tag in the first IFD of EXIF TIFF data
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// orientation is tag 0x0112, a single SHORT stored in the value field
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
+
+// Replace each block inside rect with its average colour
+func pixelate(img *image.RGBA, rect image.Rectangle, block int) {
+	for y := rect.Min.Y; y < rect.Max.Y; y += block {
+		for x := rect.Min.X; x < rect.Max.X; x += block {
+			cell := image.Rect(x, y, x+block, y+block).Intersect(rect)
+
+			var r, g, b, n uint64
+			for cy := cell.Min.Y; cy < cell.Max.Y; cy++ {
+				for cx := cell.Min.X; cx < cell.Max.X; cx++ {
+					c := img.RGBAAt(cx, cy)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					n++
+				}
+			}
+
+			avg := color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 255}
+			draw.Draw(img, cell, &image.Uniform{avg}, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// Pixel rectangle for a bounding box with padding on every side, clipped to the image
+func faceRect(bounds image.Rectangle, box BoundingBox, padding float64) image.Rectangle {
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	padX, padY := box.Width*padding, box.Height*padding
+
+	return image.Rect(
+		bounds.Min.X+int((box.Left-padX)*width),
+		bounds.Min.Y+int((box.Top-padY)*height),
+		bounds.Min.X+int((box.Left+box.Width+padX)*width),
+		bounds.Min.Y+int((box.Top+box.Height+padY)*height),
+	).Intersect(bounds)
+}
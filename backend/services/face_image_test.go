@@ -0,0 +1,122 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// A 400x200 jpeg as a phone stores a portrait shot, with EXIF orientation 6 so it is shown turned clockwise as 200x400.
+// The face is a checkerboard in the stored top left corner, which is the top right corner as displayed.
+func orientation6Fixture(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			c := color.RGBA{R: 255, G: 255, B: 255, A: 255}
+			if x < 100 && y < 100 && (x/8+y/8)%2 == 0 {
+				c = color.RGBA{A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return withOrientation(buf.Bytes(), 6)
+}
+
+// Insert an APP1 EXIF segment holding only an orientation tag after the jpeg's start marker
+func withOrientation(data []byte, orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00") // little endian, first IFD at offset 8
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112) // orientation
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)      // SHORT
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0) // value padding and no next IFD
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+// The face as Rekognition reports it, relative to the displayed 200x400 image
+var orientation6Face = BoundingBox{Left: 0.5, Top: 0, Width: 0.5, Height: 0.25}
+
+func gray(c color.Color) int {
+	r, g, b, _ := c.RGBA()
+	return int((r + g + b) / 3 >> 8)
+}
+
+func TestExifOrientation(t *testing.T) {
+	if got := exifOrientation(orientation6Fixture(t)); got != 6 {
+		t.Fatalf("orientation = %d, want 6", got)
+	}
+	if got := exifOrientation([]byte("not a jpeg")); got != 1 {
+		t.Fatalf("orientation of invalid data = %d, want 1", got)
+	}
+}
+
+func TestBlurFacesAppliesOrientation(t *testing.T) {
+	blurred, err := BlurFaces(orientation6Fixture(t), []BoundingBox{orientation6Face})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(blurred))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 400 {
+		t.Fatalf("blurred image is %dx%d, want it stored upright as 200x400", b.Dx(), b.Dy())
+	}
+
+	// the checkerboard is pixelated into blocks averaging its black and white squares
+	for _, p := range []image.Point{{150, 50}, {130, 30}, {170, 70}} {
+		if v := gray(img.At(p.X, p.Y)); v < 60 || v > 200 {
+			t.Fatalf("pixel %v of the face is %d, want it pixelated to grey", p, v)
+		}
+	}
+	// the rest of the photo is left alone
+	if v := gray(img.At(50, 300)); v < 240 {
+		t.Fatalf("pixel outside the face is %d, want white", v)
+	}
+}
+
+func TestCropFacesAppliesOrientation(t *testing.T) {
+	crops, err := CropFaces(orientation6Fixture(t), []BoundingBox{orientation6Face})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(crops[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the crop holds the checkerboard face rather than white background
+	var dark int
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if gray(img.At(x, y)) < 128 {
+				dark++
+			}
+		}
+	}
+	if dark < b.Dx()*b.Dy()/4 {
+		t.Fatalf("crop has %d dark pixels of %d, want the face", dark, b.Dx()*b.Dy())
+	}
+}
@@ -6,13 +6,20 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Rynoo1/PicSort/backend/models"
 	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/Rynoo1/PicSort/backend/services/pubsub"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm"
 )
 
@@ -28,12 +35,75 @@ type ImageService struct {
 	EventPersonRepo   *db.EventPersonRepo
 	RekognitionClient *rekognition.Client
 	S3Service         *S3Service
+	ReferenceRepo     *db.ReferenceRepo
+	ConsentRepo       *db.ConsentRepo
+	NotificationRepo  *db.NotificationRepo
+	Publisher         pubsub.Publisher
+	Quotas            *QuotaService
+	Renditions        *RenditionService
 }
 
+// A possible match for a searched face
+type FaceCandidate struct {
+	PersonID     uint    `json:"person_id"`
+	Name         string  `json:"name"`
+	Similarity   float32 `json:"similarity"`    // best similarity across the person's matched faces
+	MatchedFaces int     `json:"matched_faces"` // number of the person's faces that matched
+}
+
+// A face found in a group search image
+type IdentifiedFace struct {
+	BoundingBox BoundingBox     `json:"bounding_box"`
+	Status      string          `json:"status"` // matched or unknown
+	PersonID    *uint           `json:"person_id"`
+	Name        string          `json:"name,omitempty"`
+	Similarity  float32         `json:"similarity,omitempty"`
+	Candidates  []FaceCandidate `json:"candidates"`
+}
+
+// A matched event person with the number of photos they are in
+type PersonMatch struct {
+	FaceCandidate
+	PhotoCount int64 `json:"photo_count"`
+}
+
+// Find me results for one event
+type EventMatches struct {
+	EventID    uint          `json:"event_id"`
+	EventName  string        `json:"event_name"`
+	PhotoCount int64         `json:"photo_count"` // distinct photos showing any matched person
+	People     []PersonMatch `json:"people"`
+}
+
+// Group search face statuses
+const (
+	FaceMatched = "matched"
+	FaceUnknown = "unknown"
+)
+
+const (
+	// Most faces searched in one group image
+	maxGroupFaces = 20
+	// Face searches run at once for a group image
+	groupSearchWorkers = 4
+	// Event collections searched at once for find me
+	findMeWorkers = 4
+	// Similarity used when the client does not pass a threshold
+	DefaultSearchThreshold float32 = 90
+	// Most faces returned by one collection search, several can belong to the same person
+	searchMaxFaces int32 = 20
+)
+
 var (
 	ErrNoFaceMatch = errors.New("no matching face found")
+	ErrSearchKey   = errors.New("storage key is not one of your search uploads")
 )
 
+// S3 prefix for a user's search selfies, removed again once the search is done
+func SearchPrefix(userId uint) string {
+	return fmt.Sprintf("search/%d/", userId)
+}
+
 // Batch Image Processing using concurrency (waitgroups and goroutines)
 func (s *ImageService) BatchImageProcessing(ctx context.Context, storageKeys []string, uploadedBy, eventId uint) ([]uint, []error) {
 	log.Printf("[Batch] Starting batch processing for event %d with %d images", eventId, len(storageKeys))
@@ -42,6 +112,20 @@ func (s *ImageService) BatchImageProcessing(ctx context.Context, storageKeys []s
 	errChan := make(chan error, len(storageKeys))
 	idChan := make(chan uint, len(storageKeys))
 
+	// track progress for live updates
+	var progressMu sync.Mutex
+	progress := pubsub.ProgressData{Stage: "processing", Total: len(storageKeys)}
+	reportProgress := func(failed bool) {
+		progressMu.Lock()
+		progress.Processed++
+		if failed {
+			progress.Failed++
+		}
+		current := progress
+		progressMu.Unlock()
+		s.publishProgress(ctx, eventId, current)
+	}
+
 	// loop through keys - create a waitgroup for each image
 	for _, key := range storageKeys {
 		wg.Add(1)
@@ -50,6 +134,7 @@ func (s *ImageService) BatchImageProcessing(ctx context.Context, storageKeys []s
 			defer wg.Done()
 			log.Printf("[Image %s] Starting processing...", key)
 			photoId, err := s.ImageProcessing(ctx, k, uploadedBy, eventId)
+			reportProgress(err != nil)
 			if err != nil {
 				errChan <- err
 				return
@@ -77,19 +162,49 @@ func (s *ImageService) BatchImageProcessing(ctx context.Context, storageKeys []s
 
 	// Call matching and linking function
 	if len(photoIds) > 0 {
-		if err := s.MatchAndLinkFaces(ctx, eventId, photoIds); err != nil {
+		progress.Stage = "matching"
+		s.publishProgress(ctx, eventId, progress)
+		if err := s.MatchAndLinkFaces(ctx, eventId, photoIds, uploadedBy); err != nil {
 			errs = append(errs, err)
 		}
 	}
 
+	progress.Stage = "complete"
+	s.publishProgress(ctx, eventId, progress)
+
 	return photoIds, errs
 }
 
+func (s *ImageService) publishProgress(ctx context.Context, eventId uint, progress pubsub.ProgressData) {
+	pubsub.Send(ctx, s.Publisher, pubsub.Message{
+		Type:    pubsub.BatchProgress,
+		EventID: eventId,
+		Data:    progress,
+	})
+}
+
 // Process saved images
 func (s *ImageService) ImageProcessing(ctx context.Context, storageKey string, uploadedBy, eventID uint) (uint, error) {
 	var photoId uint
+
+	BucketName := os.Getenv("BUCKET_NAME")
+	if BucketName == "" {
+		return 0, fmt.Errorf("BUCKET_NAME environment variable not set")
+	}
+
+	// record the object size for storage quotas
+	sizeBytes, err := s.S3Service.ObjectSize(ctx, BucketName, storageKey)
+	if err != nil {
+		return 0, err
+	}
+
+	mode, err := s.ConsentRepo.FindRecognitionMode(eventID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find event recognition mode: %w", err)
+	}
+
 	// Open a db transaction to only commit db changes if successful
-	err := s.ImageRepo.DB.Transaction(func(tx *gorm.DB) error {
+	err = s.ImageRepo.DB.Transaction(func(tx *gorm.DB) error {
 		txImageRepo := s.ImageRepo.WithTx(tx)
 		txDetectRepo := s.DetectionRepo.WithTx(tx)
 
@@ -98,6 +213,7 @@ func (s *ImageService) ImageProcessing(ctx context.Context, storageKey string, u
 			StorageKey: storageKey,
 			UploadedBy: uploadedBy,
 			EventID:    eventID,
+			SizeBytes:  sizeBytes,
 		}
 
 		// Save photo record to db, store photoID
@@ -108,6 +224,11 @@ func (s *ImageService) ImageProcessing(ctx context.Context, storageKey string, u
 
 		photoId = photoID
 
+		// photos are stored without indexing any faces when recognition is off
+		if mode == models.RecognitionOff {
+			return nil
+		}
+
 		EventID := strconv.FormatUint(uint64(imageSave.EventID), 10)
 
 		// check if collection exists/create collection, store collectionID
@@ -116,14 +237,11 @@ func (s *ImageService) ImageProcessing(ctx context.Context, storageKey string, u
 			return fmt.Errorf("collection check failed: %w", err)
 		}
 
-		BucketName := os.Getenv("BUCKET_NAME")
-		if BucketName == "" {
-			return fmt.Errorf("BUCKET_NAME environment variable not set")
-		}
 		log.Printf("Using bucket: %s, collection: %s, storage key: %s", BucketName, collectionID, imageSave.StorageKey)
 
 		// index and add faces to rekognition collection, store rekognition face data
 		detectionResults, err := AddFaceToCollection(ctx, s.RekognitionClient, collectionID, BucketName, imageSave.StorageKey)
+		s.Quotas.RecordFaceCalls(uploadedBy, eventID, 1)
 		if err != nil {
 			return fmt.Errorf("index faces failed: %w", err)
 		}
@@ -138,6 +256,12 @@ func (s *ImageService) ImageProcessing(ctx context.Context, storageKey string, u
 					Confidence:    dr.Confidence,
 					PhotoID:       photoID,
 					EventID:       eventID,
+					Box: models.FaceBox{
+						Left:   dr.Box.Left,
+						Top:    dr.Box.Top,
+						Width:  dr.Box.Width,
+						Height: dr.Box.Height,
+					},
 				})
 			}
 			// save face data to db
@@ -154,17 +278,49 @@ func (s *ImageService) ImageProcessing(ctx context.Context, storageKey string, u
 		return 0, err
 	}
 
+	pubsub.Send(ctx, s.Publisher, pubsub.Message{
+		Type:    pubsub.PhotoAdded,
+		EventID: eventID,
+		Data:    pubsub.PhotoData{PhotoID: photoId, UploadedBy: uploadedBy},
+	})
+
 	return photoId, err
 }
 
-// find matches for faces, and link to correct event_person
-func (s *ImageService) MatchAndLinkFaces(ctx context.Context, eventId uint, photoIds []uint) error {
+// find matches for faces, and link to correct event_person. Face API calls are counted against userId
+func (s *ImageService) MatchAndLinkFaces(ctx context.Context, eventId uint, photoIds []uint, userId uint) error {
 	log.Printf("[Matching] Starting face linking for event %d", eventId)
 
+	var faceCalls int64
+	defer func() {
+		s.Quotas.RecordFaceCalls(userId, eventId, faceCalls)
+	}()
+
+	mode, err := s.ConsentRepo.FindRecognitionMode(eventId)
+	if err != nil {
+		return fmt.Errorf("failed to find event recognition mode: %w", err)
+	}
+	if mode == models.RecognitionOff {
+		return nil
+	}
+
+	// hold person_created updates until the transaction commits
+	deferred := pubsub.NewDeferred(s.Publisher)
+
+	// faces to delete from the collection once linking commits, those of unconsenting or opted out people
+	var forget []string
+	// photos showing opted out people need their blurred copies refreshed
+	var blur bool
+
 	// start db transaction
-	return s.ImageRepo.DB.Transaction(func(tx *gorm.DB) error {
+	err = s.ImageRepo.DB.Transaction(func(tx *gorm.DB) error {
 		txDetectRepo := s.DetectionRepo.WithTx(tx)
-		txEventPersonRepo := s.EventPersonRepo.WithTx(tx)
+		txEventPersonRepo := s.EventPersonRepo.WithTx(tx).WithPublisher(deferred)
+		txReferenceRepo := s.ReferenceRepo.WithTx(tx)
+		txConsentRepo := s.ConsentRepo.WithTx(tx)
+
+		// photos each enrolled user was recognised in, to notify them once the batch is linked
+		tagged := make(map[uint]*pubsub.TaggedData)
 
 		collectionID := fmt.Sprintf("event-%s", strconv.FormatUint(uint64(eventId), 10))
 
@@ -185,13 +341,54 @@ func (s *ImageService) MatchAndLinkFaces(ctx context.Context, eventId uint, phot
 
 		for _, detectres := range detections {
 			compareResults, err := CompareFaces(ctx, s.RekognitionClient, collectionID, detectres.RekognitionID)
+			faceCalls++
 			if err != nil {
 				return fmt.Errorf("error comparing faces: %w", err)
 			}
 			log.Printf("[Matching] Comparison Results: %v", compareResults)
 
+			// enrolled reference selfies and the faces kept for opted out people are matched first,
+			// and never used as a normal match
+			faceIds := make([]string, 0, len(compareResults))
+			for _, match := range compareResults {
+				faceIds = append(faceIds, *match.Face.FaceId)
+			}
+			references, err := txReferenceRepo.FindReferenceMatches(eventId, faceIds)
+			if err != nil {
+				return fmt.Errorf("error finding reference faces: %w", err)
+			}
+			suppressed, err := txConsentRepo.FindSuppressionFaces(eventId, faceIds)
+			if err != nil {
+				return fmt.Errorf("error finding suppression faces: %w", err)
+			}
+
+			var enrolledUser, optedOutPerson uint
+			compareResults, enrolledUser, optedOutPerson = splitFaceMatches(compareResults, references, suppressed)
+
+			// in consent mode only enrolled members are recognised, everyone else's face is removed
+			if mode == models.RecognitionConsent && enrolledUser == 0 && optedOutPerson == 0 {
+				forget = append(forget, detectres.RekognitionID)
+				continue
+			}
+
 			var matchId string
-			if len(compareResults) == 0 {
+			if optedOutPerson != 0 {
+				// linked so the face is blurred, then removed from the collection with the other opted out faces
+				matchId = strconv.FormatUint(uint64(optedOutPerson), 10)
+				log.Printf("[Matching] Opted out person recognised - person: %d", optedOutPerson)
+			} else if enrolledUser != 0 {
+				personId, err := txEventPersonRepo.FindOrCreateUserPerson(eventId, enrolledUser)
+				if err != nil {
+					return fmt.Errorf("error finding enrolled user's event person: %w", err)
+				}
+				matchId = strconv.FormatUint(uint64(personId), 10)
+				log.Printf("[Matching] Enrolled user recognised - user: %d, person: %d", enrolledUser, personId)
+
+				if tagged[enrolledUser] == nil {
+					tagged[enrolledUser] = &pubsub.TaggedData{PersonID: personId}
+				}
+				tagged[enrolledUser].PhotoIDs = append(tagged[enrolledUser].PhotoIDs, detectres.PhotoID)
+			} else if len(compareResults) == 0 {
 				newPersonId, err := txEventPersonRepo.NewEventPerson(&models.EventPerson{
 					Name:    "New Person",
 					EventID: eventId,
@@ -246,54 +443,343 @@ func (s *ImageService) MatchAndLinkFaces(ctx context.Context, eventId uint, phot
 				return fmt.Errorf("failed updating face_detection table: %w", err)
 			}
 		}
+
+		// faces matched to do not recognise people are linked but not kept in the collection
+		optedOut, err := txConsentRepo.FindOptedOutFaces(photoIds)
+		if err != nil {
+			return fmt.Errorf("failed to find opted out faces: %w", err)
+		}
+		forget = append(forget, optedOut...)
+		blur = len(optedOut) > 0
+
+		// update event timestamp so cached person/image listings are refreshed after linking
+		if err := tx.Model(&models.Event{}).Where("id = ?", eventId).Update("updated_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to update event timestamp: %w", err)
+		}
+
+		// let enrolled users know they are in the new photos, the uploader already knows
+		txNotificationRepo := s.NotificationRepo.WithTx(tx)
+		for taggedUser, data := range tagged {
+			if taggedUser == userId {
+				continue
+			}
+			data.PhotoIDs = slices.Compact(data.PhotoIDs)
+			notification, err := txNotificationRepo.CreateNotification(taggedUser, eventId, models.NotificationTaggedInPhotos, data)
+			if err != nil {
+				return fmt.Errorf("failed to notify user %d: %w", taggedUser, err)
+			}
+			pubsub.Send(ctx, deferred, pubsub.Message{
+				Type:    pubsub.Notification,
+				EventID: eventId,
+				UserID:  taggedUser,
+				Data:    notification,
+			})
+		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	if err := removeEventFaces(ctx, s.RekognitionClient, eventId, forget); err != nil {
+		log.Printf("[Matching] failed to remove %d faces from event %d: %v", len(forget), eventId, err)
+	}
+	if blur {
+		s.Renditions.RefreshPhotos(ctx, photoIds)
+	}
+
+	deferred.Flush(ctx)
+	return nil
 }
 
-// find matching face in event, return matching event person id
-func (s *ImageService) FindFace(ctx context.Context, storageKey string, eventId uint) (uint, error) {
-	// check if rekognition collection exists
-	EventId := strconv.FormatUint(uint64(eventId), 10)
-	collectionId := fmt.Sprintf("event-%s", EventId)
+// Split the collection matches for a new face into the faces usable as a normal match, the user whose reference
+// selfie matched, and the opted out person whose suppression face matched. Opted out people take precedence,
+// a recognised enrolled user is ignored when the face also matches someone who opted out.
+func splitFaceMatches(matches []types.FaceMatch, references, suppressed map[string]uint) ([]types.FaceMatch, uint, uint) {
+	var enrolledUser, optedOutPerson uint
+	faceMatches := make([]types.FaceMatch, 0, len(matches))
+	for _, match := range matches {
+		faceId := aws.ToString(match.Face.FaceId)
+		if personId, ok := suppressed[faceId]; ok {
+			if optedOutPerson == 0 {
+				optedOutPerson = personId
+			}
+			continue
+		}
+		if referenceUser, ok := references[faceId]; ok {
+			if enrolledUser == 0 {
+				enrolledUser = referenceUser
+			}
+			continue
+		}
+		faceMatches = append(faceMatches, match)
+	}
 
-	exists, err := CollectionExists(ctx, s.RekognitionClient, collectionId)
+	if optedOutPerson != 0 {
+		enrolledUser = 0
+	}
+	return faceMatches, enrolledUser, optedOutPerson
+}
+
+// find matching face in event, return the most similar event person id. Face API calls are counted against userId
+func (s *ImageService) FindFace(ctx context.Context, storageKey string, eventId, userId uint) (uint, error) {
+	candidates, err := s.FindCandidates(ctx, storageKey, eventId, userId, DefaultSearchThreshold)
 	if err != nil {
-		return 0, fmt.Errorf("error finding collection: %w", err)
+		return 0, err
 	}
-	if !exists {
-		return 0, fmt.Errorf("collection does not exist, check the event/collection id")
+	return candidates[0].PersonID, nil
+}
+
+// find every event person matching the face in the image, ranked by similarity. Face API calls are counted against userId
+func (s *ImageService) FindCandidates(ctx context.Context, storageKey string, eventId, userId uint, threshold float32) ([]FaceCandidate, error) {
+	collectionId, err := s.eventCollection(ctx, eventId)
+	if err != nil {
+		return nil, err
 	}
 
 	// validate number of faces in image
 	faceCount, err := CheckFaceCount(ctx, s.RekognitionClient, storageKey)
+	s.Quotas.RecordFaceCalls(userId, eventId, 1)
 	if err != nil {
-		return 0, fmt.Errorf("error detecting faces: %w", err)
+		return nil, fmt.Errorf("error detecting faces: %w", err)
 	}
 	if faceCount != 1 {
-		return 0, fmt.Errorf("invalid image: expected 1 face, found %d", faceCount)
+		return nil, fmt.Errorf("invalid image: expected 1 face, found %d", faceCount)
 	}
 
 	// search collection for given face
-	searchOutput, err := SearchFaceByImage(ctx, s.RekognitionClient, collectionId, storageKey)
+	searchOutput, err := SearchFaceByImage(ctx, s.RekognitionClient, collectionId, storageKey, searchMaxFaces, threshold)
+	s.Quotas.RecordFaceCalls(userId, eventId, 1)
 	if err != nil {
-		return 0, fmt.Errorf("error searching collection for face: %w", err)
+		return nil, fmt.Errorf("error searching collection for face: %w", err)
 	}
 
-	// if no matches - return no matches found
-	if len(searchOutput) == 0 {
-		return 0, ErrNoFaceMatch
+	candidates, err := s.rankCandidates(searchOutput)
+	if err != nil {
+		return nil, err
 	}
+	if len(candidates) == 0 {
+		return nil, ErrNoFaceMatch
+	}
+	return candidates, nil
+}
 
-	// find event person id for matching person (using highest similarity entry)
-	matchId, err := s.DetectionRepo.FindMatches(*searchOutput[0].Face.FaceId)
+// find every face in a group image and search for each one separately. Face API calls are counted against userId
+func (s *ImageService) IdentifyFaces(ctx context.Context, storageKey string, eventId, userId uint, threshold float32) ([]IdentifiedFace, error) {
+	collectionId, err := s.eventCollection(ctx, eventId)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return 0, ErrNoFaceMatch
+		return nil, err
+	}
+
+	boxes, err := DetectFaceBoxes(ctx, s.RekognitionClient, storageKey)
+	s.Quotas.RecordFaceCalls(userId, eventId, 1)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting faces: %w", err)
+	}
+	if len(boxes) == 0 {
+		return []IdentifiedFace{}, nil
+	}
+
+	// search the largest faces first, very small background faces rarely match
+	sort.Slice(boxes, func(i, j int) bool {
+		return boxes[i].Width*boxes[i].Height > boxes[j].Width*boxes[j].Height
+	})
+	if len(boxes) > maxGroupFaces {
+		boxes = boxes[:maxGroupFaces]
+	}
+
+	BucketName := os.Getenv("BUCKET_NAME")
+	data, err := s.S3Service.GetObjectBytes(ctx, BucketName, storageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	crops, err := CropFaces(data, boxes)
+	if err != nil {
+		return nil, err
+	}
+
+	faces := make([]IdentifiedFace, len(boxes))
+	var searches int64
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(groupSearchWorkers)
+	for i := range boxes {
+		faces[i] = IdentifiedFace{BoundingBox: boxes[i], Status: FaceUnknown, Candidates: []FaceCandidate{}}
+		if crops[i] == nil {
+			continue
 		}
-		return 0, fmt.Errorf("error finding matching event person id: %w", err)
+
+		g.Go(func() error {
+			matches, err := SearchFaceByBytes(gctx, s.RekognitionClient, collectionId, crops[i], searchMaxFaces, threshold)
+			atomic.AddInt64(&searches, 1)
+			if err != nil {
+				// crops that Rekognition cannot find a face in are left as unknown
+				var invalid *types.InvalidParameterException
+				if errors.As(err, &invalid) {
+					return nil
+				}
+				return fmt.Errorf("error searching collection for face %d: %w", i, err)
+			}
+
+			candidates, err := s.rankCandidates(matches)
+			if err != nil {
+				return err
+			}
+			if len(candidates) > 0 {
+				faces[i].Status = FaceMatched
+				faces[i].PersonID = &candidates[0].PersonID
+				faces[i].Name = candidates[0].Name
+				faces[i].Similarity = candidates[0].Similarity
+				faces[i].Candidates = candidates
+			}
+			return nil
+		})
+	}
+	err = g.Wait()
+	s.Quotas.RecordFaceCalls(userId, eventId, searches)
+	if err != nil {
+		return nil, err
+	}
+
+	return faces, nil
+}
+
+// search every given event's collection for the face in a selfie, returns the events with matches ranked by best similarity.
+// Face API calls are counted against userId
+func (s *ImageService) FindMe(ctx context.Context, storageKey string, events []db.ReturnEvents, userId uint, threshold float32) ([]EventMatches, error) {
+	// validate number of faces once, the same image is searched in every event
+	faceCount, err := CheckFaceCount(ctx, s.RekognitionClient, storageKey)
+	s.Quotas.RecordFaceCalls(userId, 0, 1)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting faces: %w", err)
+	}
+	if faceCount != 1 {
+		return nil, fmt.Errorf("invalid image: expected 1 face, found %d", faceCount)
 	}
 
-	return matchId, nil
+	results := make([]*EventMatches, len(events))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(findMeWorkers)
+	for i, event := range events {
+		g.Go(func() error {
+			collectionId := fmt.Sprintf("event-%d", event.EventId)
+			matches, err := SearchFaceByImage(gctx, s.RekognitionClient, collectionId, storageKey, searchMaxFaces, threshold)
+			if err != nil {
+				// events without any processed photos have no collection yet
+				var notFound *types.ResourceNotFoundException
+				if errors.As(err, &notFound) {
+					return nil
+				}
+				s.Quotas.RecordFaceCalls(userId, event.EventId, 1)
+				return fmt.Errorf("error searching event %d: %w", event.EventId, err)
+			}
+			s.Quotas.RecordFaceCalls(userId, event.EventId, 1)
+
+			candidates, err := s.rankCandidates(matches)
+			if err != nil || len(candidates) == 0 {
+				return err
+			}
+
+			personIds := make([]uint, len(candidates))
+			for j, candidate := range candidates {
+				personIds[j] = candidate.PersonID
+			}
+			counts, total, err := s.EventPersonRepo.CountPersonPhotos(personIds)
+			if err != nil {
+				return fmt.Errorf("error counting photos in event %d: %w", event.EventId, err)
+			}
+
+			result := &EventMatches{
+				EventID:    event.EventId,
+				EventName:  event.EventName,
+				PhotoCount: total,
+				People:     make([]PersonMatch, len(candidates)),
+			}
+			for j, candidate := range candidates {
+				result.People[j] = PersonMatch{FaceCandidate: candidate, PhotoCount: counts[candidate.PersonID]}
+			}
+			results[i] = result
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	found := make([]EventMatches, 0, len(results))
+	for _, result := range results {
+		if result != nil {
+			found = append(found, *result)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].People[0].Similarity > found[j].People[0].Similarity
+	})
+	return found, nil
+}
+
+// Name of the event's rekognition collection, errors if it has not been created yet
+func (s *ImageService) eventCollection(ctx context.Context, eventId uint) (string, error) {
+	EventId := strconv.FormatUint(uint64(eventId), 10)
+	collectionId := fmt.Sprintf("event-%s", EventId)
+
+	exists, err := CollectionExists(ctx, s.RekognitionClient, collectionId)
+	if err != nil {
+		return "", fmt.Errorf("error finding collection: %w", err)
+	}
+	if !exists {
+		return "", fmt.Errorf("collection does not exist, check the event/collection id")
+	}
+	return collectionId, nil
+}
+
+// Group face matches by event person, keeping each person's best similarity.
+// Faces that are unassigned or in the trash are skipped.
+func (s *ImageService) rankCandidates(matches []types.FaceMatch) ([]FaceCandidate, error) {
+	similarity := make(map[string]float32, len(matches))
+	faceIds := make([]string, 0, len(matches))
+	for _, match := range matches {
+		if match.Face == nil || match.Face.FaceId == nil {
+			continue
+		}
+		similarity[*match.Face.FaceId] = aws.ToFloat32(match.Similarity)
+		faceIds = append(faceIds, *match.Face.FaceId)
+	}
+
+	people, err := s.DetectionRepo.FindActiveMatches(faceIds)
+	if err != nil {
+		return nil, fmt.Errorf("error finding matching event people: %w", err)
+	}
+
+	byPerson := make(map[uint]*FaceCandidate)
+	var candidates []*FaceCandidate
+	for _, person := range people {
+		candidate, ok := byPerson[person.PersonID]
+		if !ok {
+			candidate = &FaceCandidate{PersonID: person.PersonID, Name: person.Name}
+			byPerson[person.PersonID] = candidate
+			candidates = append(candidates, candidate)
+		}
+		candidate.MatchedFaces++
+		if sim := similarity[person.RekognitionID]; sim > candidate.Similarity {
+			candidate.Similarity = sim
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Similarity != candidates[j].Similarity {
+			return candidates[i].Similarity > candidates[j].Similarity
+		}
+		return candidates[i].MatchedFaces > candidates[j].MatchedFaces
+	})
+
+	result := make([]FaceCandidate, len(candidates))
+	for i, candidate := range candidates {
+		result[i] = *candidate
+	}
+	return result, nil
 }
 
 // Serve presign URLs for all images in a certain collection (all images for an event person)
@@ -323,8 +809,8 @@ func (s *ImageService) ServeUrls(ctx context.Context, eventPerson models.EventPe
 	return returnLinks, nil
 }
 
-// Delete image from DB and S3
-func (s *ImageService) DeletePhoto(ctx context.Context, photoID uint) error {
+// Soft delete image, it stays in S3 and Rekognition until purged from the trash
+func (s *ImageService) DeletePhoto(ctx context.Context, photoID uint, actor db.Actor) error {
 	tx := s.ImageRepo.DB.Begin()
 
 	var photo models.Photos
@@ -333,42 +819,91 @@ func (s *ImageService) DeletePhoto(ctx context.Context, photoID uint) error {
 		return fmt.Errorf("photo not found: %w", err)
 	}
 
+	// soft delete DB record
+	if err := tx.Delete(&photo).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to photo from DB: %w", err)
+	}
+
+	// update event timestamp
+	if err := tx.Model(&models.Event{}).Where("id = ?", photo.EventID).Update("updated_at", time.Now()).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update event tinmestamp: %w", err)
+	}
+
+	before := map[string]interface{}{"storage_key": photo.StorageKey, "uploaded_by": photo.UploadedBy}
+	if err := db.WriteAudit(tx, actor, photo.EventID, models.AuditPhotoDeleted, "photo", photo.ID, before, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := db.EnqueueWebhooks(tx, photo.EventID, pubsub.PhotoDeleted, pubsub.PhotoData{PhotoID: photo.ID, UploadedBy: photo.UploadedBy}); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to queue webhooks: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	pubsub.Send(ctx, s.Publisher, pubsub.Message{
+		Type:    pubsub.PhotoDeleted,
+		EventID: photo.EventID,
+		Data:    pubsub.PhotoData{PhotoID: photo.ID, UploadedBy: photo.UploadedBy},
+	})
+	return nil
+}
+
+// Permanently delete photos from Rekognition, S3 and the DB. Photos need FaceDetections loaded
+func (s *ImageService) PurgePhotos(ctx context.Context, photos []models.Photos) error {
+	if len(photos) == 0 {
+		return nil
+	}
+
 	BucketName := os.Getenv("BUCKET_NAME")
 
-	// delete rekognition entries
-	if len(photo.FaceDetections) > 0 {
-		var faceIDs []string
+	// delete rekognition entries, grouped by event collection
+	faceIDs := make(map[uint][]string)
+	var keys []string
+	var ids []uint
+	for _, photo := range photos {
 		for _, fd := range photo.FaceDetections {
 			if fd.RekognitionID != "" {
-				faceIDs = append(faceIDs, fd.RekognitionID)
+				faceIDs[photo.EventID] = append(faceIDs[photo.EventID], fd.RekognitionID)
 			}
 		}
+		keys = append(keys, photo.ObjectKeys()...)
+		ids = append(ids, photo.ID)
+	}
 
-		collectionID := fmt.Sprintf("event-%d", photo.EventID)
-		if err := DeleteFaces(ctx, s.RekognitionClient, collectionID, faceIDs); err != nil {
-			log.Printf("[WARN] failed to delete Rekognition faces for photo %d: %v", photo.ID, err)
+	for eventID, faces := range faceIDs {
+		// faces kept for opted out people stay, so they are still recognised and dropped in new uploads
+		suppressed, err := s.ConsentRepo.FindSuppressionFaces(eventID, faces)
+		if err != nil {
+			return fmt.Errorf("failed to find suppression faces: %w", err)
+		}
+		faces = slices.DeleteFunc(faces, func(faceId string) bool {
+			_, ok := suppressed[faceId]
+			return ok
+		})
+
+		collectionID := fmt.Sprintf("event-%d", eventID)
+		if err := DeleteFaces(ctx, s.RekognitionClient, collectionID, faces); err != nil {
+			log.Printf("[WARN] failed to delete Rekognition faces for event %d: %v", eventID, err)
 		}
 	}
 
-	// delete S3 file
-	if err := s.S3Service.DeleteFile(ctx, BucketName, photo.StorageKey); err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to delete photo from S3: %w", err)
+	// delete S3 files, keep the DB rows so a failed purge is retried
+	if err := s.S3Service.DeleteObjects(ctx, BucketName, keys); err != nil {
+		return fmt.Errorf("failed to delete photos from S3: %w", err)
 	}
 
-	// delete DB record
-	if err := tx.Delete(&photo).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to photo from DB: %w", err)
-	}
-
-	// update event timestamp
-	if err := tx.Model(&models.Event{}).Where("id = ?", photo.EventID).Update("updated_at", time.Now()).Error; err != nil {
-		tx.Rollback()
-		return fmt.Errorf("failed to update event tinmestamp: %w", err)
+	// delete DB records
+	if err := s.ImageRepo.DB.Unscoped().Delete(&models.Photos{}, ids).Error; err != nil {
+		return fmt.Errorf("failed to purge photos from DB: %w", err)
 	}
 
-	return tx.Commit().Error
+	return nil
 }
 
 // Save to image location DB -> ObjectKey, UploadedByID
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+)
+
+func faceMatch(faceId string, similarity float32) types.FaceMatch {
+	return types.FaceMatch{Face: &types.Face{FaceId: aws.String(faceId)}, Similarity: aws.Float32(similarity)}
+}
+
+// A photo uploaded after someone opted out matches the face kept for them, and is linked to their person
+// instead of creating a new, searchable and unblurred "New Person".
+func TestUploadAfterOptOutMatchesSuppressionFace(t *testing.T) {
+	// the opted out person's other faces were deleted, only the suppression face and an unrelated face match
+	matches := []types.FaceMatch{faceMatch("kept-face", 99), faceMatch("other-face", 88)}
+	suppressed := map[string]uint{"kept-face": 7}
+
+	rest, enrolledUser, optedOutPerson := splitFaceMatches(matches, map[string]uint{}, suppressed)
+	if optedOutPerson != 7 {
+		t.Fatalf("opted out person = %d, want 7", optedOutPerson)
+	}
+	if enrolledUser != 0 {
+		t.Fatalf("enrolled user = %d, want 0", enrolledUser)
+	}
+	for _, match := range rest {
+		if aws.ToString(match.Face.FaceId) == "kept-face" {
+			t.Fatal("suppression face was left as a normal match")
+		}
+	}
+}
+
+// Opting out wins over a reference selfie matching the same face
+func TestUploadAfterOptOutIgnoresReferenceMatch(t *testing.T) {
+	matches := []types.FaceMatch{faceMatch("reference-face", 99), faceMatch("kept-face", 95)}
+
+	_, enrolledUser, optedOutPerson := splitFaceMatches(matches, map[string]uint{"reference-face": 3}, map[string]uint{"kept-face": 7})
+	if optedOutPerson != 7 || enrolledUser != 0 {
+		t.Fatalf("got enrolled user %d, opted out person %d, want 0 and 7", enrolledUser, optedOutPerson)
+	}
+}
+
+// Without an opt out, reference selfies recognise enrolled users and other faces are normal matches
+func TestSplitFaceMatchesWithoutOptOut(t *testing.T) {
+	matches := []types.FaceMatch{faceMatch("reference-face", 99), faceMatch("other-face", 90)}
+
+	rest, enrolledUser, optedOutPerson := splitFaceMatches(matches, map[string]uint{"reference-face": 3}, map[string]uint{})
+	if enrolledUser != 3 || optedOutPerson != 0 {
+		t.Fatalf("got enrolled user %d, opted out person %d, want 3 and 0", enrolledUser, optedOutPerson)
+	}
+	if len(rest) != 1 || aws.ToString(rest[0].Face.FaceId) != "other-face" {
+		t.Fatalf("normal matches = %v, want only other-face", rest)
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/Rynoo1/PicSort/backend/services/pubsub"
+	"gorm.io/gorm"
+)
+
+const (
+	maxCommentLength = 2000 // characters
+	maxEmojiLength   = 8    // characters, enough for skin tones and joined emoji
+)
+
+var (
+	ErrReactionEmoji    = errors.New("reaction must be a single emoji")
+	ErrCommentBody      = errors.New("comment must be between 1 and 2000 characters")
+	ErrCommentParent    = errors.New("replies must answer a comment on the same photo")
+	ErrCommentForbidden = errors.New("only the author or an event owner can delete this comment")
+)
+
+// Favorites, emoji reactions and threaded comments on photos.
+// Uploaders are notified when someone else favorites, reacts to or comments on their photo.
+type InteractionService struct {
+	InteractionRepo  *db.InteractionRepo
+	NotificationRepo *db.NotificationRepo
+	Publisher        pubsub.Publisher
+}
+
+// Favorite a photo for the user
+func (s *InteractionService) Favorite(ctx context.Context, user *models.User, photo *models.Photos) error {
+	return s.change(ctx, photo, func(tx *gorm.DB, deferred *pubsub.Deferred) error {
+		added, err := s.InteractionRepo.WithTx(tx).AddFavorite(user.ID, photo.ID)
+		if err != nil || !added {
+			return err
+		}
+		data := pubsub.FeedbackData{PhotoID: photo.ID, UserID: user.ID}
+		return s.notify(ctx, tx, deferred, photo.UploadedBy, user.ID, photo.EventID, models.NotificationPhotoFavorited, data)
+	})
+}
+
+// Remove a photo from the user's favorites
+func (s *InteractionService) Unfavorite(ctx context.Context, user *models.User, photo *models.Photos) error {
+	return s.change(ctx, photo, func(tx *gorm.DB, _ *pubsub.Deferred) error {
+		_, err := s.InteractionRepo.WithTx(tx).RemoveFavorite(user.ID, photo.ID)
+		return err
+	})
+}
+
+// React to a photo with an emoji
+func (s *InteractionService) React(ctx context.Context, user *models.User, photo *models.Photos, emoji string) error {
+	emoji = strings.TrimSpace(emoji)
+	if !validEmoji(emoji) {
+		return ErrReactionEmoji
+	}
+
+	return s.change(ctx, photo, func(tx *gorm.DB, deferred *pubsub.Deferred) error {
+		added, err := s.InteractionRepo.WithTx(tx).AddReaction(user.ID, photo.ID, emoji)
+		if err != nil || !added {
+			return err
+		}
+
+		data := pubsub.FeedbackData{PhotoID: photo.ID, UserID: user.ID, Emoji: emoji}
+		pubsub.Send(ctx, deferred, pubsub.Message{
+			Type:    pubsub.PhotoReacted,
+			EventID: photo.EventID,
+			Data:    data,
+		})
+		return s.notify(ctx, tx, deferred, photo.UploadedBy, user.ID, photo.EventID, models.NotificationPhotoReaction, data)
+	})
+}
+
+// Remove one of the user's reactions
+func (s *InteractionService) Unreact(ctx context.Context, user *models.User, photo *models.Photos, emoji string) error {
+	emoji = strings.TrimSpace(emoji)
+	return s.change(ctx, photo, func(tx *gorm.DB, _ *pubsub.Deferred) error {
+		_, err := s.InteractionRepo.WithTx(tx).RemoveReaction(user.ID, photo.ID, emoji)
+		return err
+	})
+}
+
+// Comment on a photo, or reply to one of its comments when parentId is set
+func (s *InteractionService) Comment(ctx context.Context, user *models.User, photo *models.Photos, body string, parentId *uint) (*models.PhotoComment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || utf8.RuneCountInString(body) > maxCommentLength {
+		return nil, ErrCommentBody
+	}
+
+	var parent *models.PhotoComment
+	if parentId != nil {
+		var err error
+		parent, err = s.InteractionRepo.FindComment(*parentId)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && parent.PhotoID != photo.ID) {
+			return nil, ErrCommentParent
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	comment := &models.PhotoComment{Body: body, PhotoID: photo.ID, UserID: user.ID, ParentID: parentId}
+	err := s.change(ctx, photo, func(tx *gorm.DB, deferred *pubsub.Deferred) error {
+		if err := s.InteractionRepo.WithTx(tx).CreateComment(comment); err != nil {
+			return err
+		}
+
+		data := pubsub.FeedbackData{PhotoID: photo.ID, UserID: user.ID, CommentID: comment.ID}
+		pubsub.Send(ctx, deferred, pubsub.Message{
+			Type:    pubsub.PhotoCommented,
+			EventID: photo.EventID,
+			Data:    data,
+		})
+
+		// the author of the comment being answered hears about the reply, the uploader about everything else
+		if parent != nil && parent.UserID != photo.UploadedBy {
+			if err := s.notify(ctx, tx, deferred, parent.UserID, user.ID, photo.EventID, models.NotificationCommentReply, data); err != nil {
+				return err
+			}
+		}
+		return s.notify(ctx, tx, deferred, photo.UploadedBy, user.ID, photo.EventID, models.NotificationPhotoComment, data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save comment: %w", err)
+	}
+	return comment, nil
+}
+
+// Delete a comment and its replies, allowed for the author and for event owners
+func (s *InteractionService) DeleteComment(ctx context.Context, user *models.User, photo *models.Photos, comment *models.PhotoComment, eventOwner bool) error {
+	if comment.UserID != user.ID && !eventOwner {
+		return ErrCommentForbidden
+	}
+	return s.change(ctx, photo, func(tx *gorm.DB, _ *pubsub.Deferred) error {
+		return s.InteractionRepo.WithTx(tx).DeleteComment(comment.ID)
+	})
+}
+
+// Run a change in a transaction that also refreshes the event timestamp, live updates are sent once it commits
+func (s *InteractionService) change(ctx context.Context, photo *models.Photos, fn func(tx *gorm.DB, deferred *pubsub.Deferred) error) error {
+	deferred := pubsub.NewDeferred(s.Publisher)
+	err := s.InteractionRepo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx, deferred); err != nil {
+			return err
+		}
+		return s.InteractionRepo.WithTx(tx).TouchEvent(photo.EventID)
+	})
+	if err != nil {
+		return err
+	}
+
+	deferred.Flush(ctx)
+	return nil
+}
+
+// Notify a user about someone else's activity on a photo, no one is notified about their own
+func (s *InteractionService) notify(ctx context.Context, tx *gorm.DB, deferred *pubsub.Deferred, userId, actorId, eventId uint, notificationType string, data pubsub.FeedbackData) error {
+	if userId == actorId {
+		return nil
+	}
+
+	notification, err := s.NotificationRepo.WithTx(tx).CreateNotification(userId, eventId, notificationType, data)
+	if err != nil {
+		return fmt.Errorf("failed to notify user %d: %w", userId, err)
+	}
+	pubsub.Send(ctx, deferred, pubsub.Message{
+		Type:    pubsub.Notification,
+		EventID: eventId,
+		UserID:  userId,
+		Data:    notification,
+	})
+	return nil
+}
+
+// A reaction is a short run of non-ASCII symbols such as 👍 or 👩🏽‍💻, not text
+func validEmoji(emoji string) bool {
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return false
+	}
+	for _, r := range emoji {
+		if r <= unicode.MaxASCII || unicode.IsSpace(r) || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
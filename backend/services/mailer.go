@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Email struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+// Anything that can deliver email, swap the local mailers for a real provider in production
+type Mailer interface {
+	Send(ctx context.Context, email Email) error
+}
+
+// Create a local mailer by name: log prints emails, file writes each one to dir as an .eml file
+func NewMailer(driver, dir, from string) (Mailer, error) {
+	switch driver {
+	case "", "log":
+		return &LogMailer{From: from}, nil
+	case "file":
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create mail dir %s: %w", dir, err)
+		}
+		return &FileMailer{Dir: dir, From: from}, nil
+	default:
+		return nil, fmt.Errorf("unknown mailer: %s", driver)
+	}
+}
+
+// Writes emails to the log, for development
+type LogMailer struct {
+	From string
+}
+
+func (m *LogMailer) Send(_ context.Context, email Email) error {
+	log.Printf("[MAIL] from=%q to=%q subject=%q\n%s", m.From, email.To, email.Subject, email.Body)
+	return nil
+}
+
+// Writes each email to its own file, for development and tests
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(_ context.Context, email Email) error {
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102-150405"), uuid.NewString())
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", email.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", email.Subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(email.Body)
+
+	if err := os.WriteFile(filepath.Join(m.Dir, name), []byte(msg.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mockKeyID       = "mock-key"
+	mockCodeTTL     = 2 * time.Minute
+	mockTokenTTL    = 10 * time.Minute
+	mockDefaultUser = "mock.user@example.com"
+)
+
+// A local OpenID Connect issuer for development and testing. /authorize approves every request
+// without a login page, signing in as the login_hint email or a default user. Never enable in production.
+type MockIssuer struct {
+	Issuer     string          // public base URL the issuer is mounted at
+	Unverified map[string]bool // emails signed in with email_verified false, for testing refusals
+	key        *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+// An issued authorization code waiting to be exchanged
+type mockGrant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	email       string
+	expiresAt   time.Time
+}
+
+func NewMockIssuer(issuer string) (*MockIssuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &MockIssuer{
+		Issuer: strings.TrimRight(issuer, "/"),
+		key:    key,
+		codes:  make(map[string]mockGrant),
+	}, nil
+}
+
+// Routes relative to where the issuer is mounted
+func (m *MockIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	base, _ := url.Parse(m.Issuer)
+	p := strings.TrimPrefix(r.URL.Path, strings.TrimRight(base.Path, "/"))
+
+	switch p {
+	case "/.well-known/openid-configuration":
+		m.discovery(w)
+	case "/authorize":
+		m.authorize(w, r)
+	case "/token":
+		m.token(w, r)
+	case "/jwks":
+		writeJSON(w, http.StatusOK, jsonWebKeySet{Keys: []jsonWebKey{rsaJWK(mockKeyID, &m.key.PublicKey)}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *MockIssuer) discovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                m.Issuer,
+		"authorization_endpoint":                m.Issuer + "/authorize",
+		"token_endpoint":                        m.Issuer + "/token",
+		"jwks_uri":                              m.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// Approve the request straight away and redirect back with a code
+func (m *MockIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	redirectURI := q.Get("redirect_uri")
+	if q.Get("response_type") != "code" || q.Get("client_id") == "" || redirectURI == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(q.Get("login_hint")))
+	if email == "" {
+		email = mockDefaultUser
+	}
+
+	code, err := RandomString()
+	if err != nil {
+		http.Error(w, "failed to issue code", http.StatusInternalServerError)
+		return
+	}
+
+	m.mu.Lock()
+	m.codes[code] = mockGrant{
+		clientID:    q.Get("client_id"),
+		redirectURI: redirectURI,
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		email:       email,
+		expiresAt:   time.Now().Add(mockCodeTTL),
+	}
+	m.mu.Unlock()
+
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	values := target.Query()
+	values.Set("code", code)
+	values.Set("state", q.Get("state"))
+	target.RawQuery = values.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// Exchange a code for a signed ID token after checking the PKCE verifier
+func (m *MockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	m.mu.Lock()
+	grant, ok := m.codes[code]
+	delete(m.codes, code) // codes are single use
+	m.mu.Unlock()
+
+	switch {
+	case r.PostForm.Get("grant_type") != "authorization_code":
+		tokenError(w, "unsupported_grant_type")
+		return
+	case !ok || time.Now().After(grant.expiresAt):
+		tokenError(w, "invalid_grant")
+		return
+	case r.PostForm.Get("client_id") != grant.clientID || r.PostForm.Get("redirect_uri") != grant.redirectURI:
+		tokenError(w, "invalid_grant")
+		return
+	case CodeChallenge(r.PostForm.Get("code_verifier")) != grant.challenge:
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := Claims{
+		Email:         grant.email,
+		EmailVerified: !m.Unverified[grant.email],
+		Name:          strings.Split(grant.email, "@")[0],
+		Username:      strings.Split(grant.email, "@")[0],
+		Nonce:         grant.nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.Issuer,
+			Subject:   "mock|" + grant.email,
+			Audience:  jwt.ClaimStrings{grant.clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mockTokenTTL)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = mockKeyID
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		http.Error(w, "failed to sign token", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "mock-" + code,
+		"token_type":   "Bearer",
+		"expires_in":   int(mockTokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/oidc"
+	"gorm.io/gorm"
+)
+
+// How long a user has to finish logging in with a provider
+const oidcLoginTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider  = errors.New("unknown login provider")
+	ErrLoginState       = errors.New("login request is invalid or has expired")
+	ErrProviderEmail    = errors.New("the provider did not share a verified email address")
+	ErrProviderResponse = errors.New("login with the provider failed")
+	ErrLinkUnverified   = errors.New("an account with this email already exists, log in with your password and verify your email before using this login")
+)
+
+// Pending logins and linked identities, *db.IdentityRepo outside of tests
+type IdentityStore interface {
+	CreateLoginState(state *models.OIDCLoginState) error
+	TakeLoginState(state string) (*models.OIDCLoginState, error)
+	FindUser(provider, subject string) (*models.User, error)
+	LinkIdentity(user *models.User, identity *models.UserIdentity) error
+	CreateUser(user *models.User, identity *models.UserIdentity) error
+}
+
+// Finds existing accounts by email, *UserService outside of tests
+type UserFinder interface {
+	FindByEmail(email string) (*models.User, error)
+}
+
+// Signs users in with external OpenID Connect providers, creating or linking accounts by verified email
+type OIDCService struct {
+	IdentityRepo IdentityStore
+	UserService  UserFinder
+	Providers    map[string]*oidc.Provider
+	AppRedirect  string // app url the callback redirects to with the token, empty returns JSON
+}
+
+// Begin a login, returns the provider url to send the user to
+func (s *OIDCService) Start(ctx context.Context, providerName, loginHint string) (string, error) {
+	provider, ok := s.Providers[providerName]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier, loginHint)
+	if err != nil {
+		log.Printf("[OIDC] failed to start login with %s: %v", providerName, err)
+		return "", ErrProviderResponse
+	}
+
+	err = s.IdentityRepo.CreateLoginState(&models.OIDCLoginState{
+		State:        state,
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(oidcLoginTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save login state: %w", err)
+	}
+	return authURL, nil
+}
+
+// Finish a login from the provider's callback and return the signed in user.
+// A known identity signs in its user, otherwise the verified email links an existing user or creates a new one.
+// Existing users are only linked once they verified the email themselves, anyone can register an unverified address.
+func (s *OIDCService) Finish(ctx context.Context, providerName, state, code string) (*models.User, error) {
+	provider, ok := s.Providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	login, err := s.IdentityRepo.TakeLoginState(state)
+	if err != nil {
+		return nil, err
+	}
+	if login == nil || login.Provider != providerName || time.Now().After(login.ExpiresAt) || code == "" {
+		return nil, ErrLoginState
+	}
+
+	claims, err := provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Printf("[OIDC] login with %s failed: %v", providerName, err)
+		return nil, ErrProviderResponse
+	}
+
+	user, err := s.IdentityRepo.FindUser(providerName, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return user, nil
+	}
+
+	// unverified addresses could belong to someone else, so they never link or create accounts
+	if !claims.EmailVerified {
+		return nil, ErrProviderEmail
+	}
+	email, err := NormalizeEmail(claims.Email)
+	if err != nil {
+		return nil, ErrProviderEmail
+	}
+
+	identity := &models.UserIdentity{
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    email,
+	}
+
+	user, err = s.UserService.FindByEmail(email)
+	if err == nil {
+		if !user.EmailVerified {
+			log.Printf("[OIDC] refused to link %s login to unverified user %d", providerName, user.ID)
+			return nil, ErrLinkUnverified
+		}
+		if err := s.IdentityRepo.LinkIdentity(user, identity); err != nil {
+			return nil, fmt.Errorf("failed to link login: %w", err)
+		}
+		log.Printf("[OIDC] linked %s login to user %d", providerName, user.ID)
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	now := time.Now()
+	user = &models.User{
+		Email:           email,
+		Username:        oidcUsername(claims, email),
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	}
+	if err := s.IdentityRepo.CreateUser(user, identity); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	log.Printf("[OIDC] created user %d from %s login", user.ID, providerName)
+	return user, nil
+}
+
+// Pick a username for a new user from the provider's claims
+func oidcUsername(claims *oidc.Claims, email string) string {
+	if claims.Username != "" {
+		return claims.Username
+	}
+	if claims.Name != "" {
+		return claims.Name
+	}
+	return strings.Split(email, "@")[0]
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/oidc"
+	"gorm.io/gorm"
+)
+
+// In memory stand in for IdentityRepo and UserService
+type memoryIdentities struct {
+	states     map[string]*models.OIDCLoginState
+	users      []*models.User
+	identities []*models.UserIdentity
+}
+
+func newMemoryIdentities() *memoryIdentities {
+	return &memoryIdentities{states: make(map[string]*models.OIDCLoginState)}
+}
+
+func (m *memoryIdentities) CreateLoginState(state *models.OIDCLoginState) error {
+	m.states[state.State] = state
+	return nil
+}
+
+func (m *memoryIdentities) TakeLoginState(state string) (*models.OIDCLoginState, error) {
+	login := m.states[state]
+	delete(m.states, state)
+	return login, nil
+}
+
+func (m *memoryIdentities) FindUser(provider, subject string) (*models.User, error) {
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return m.user(identity.UserID), nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryIdentities) LinkIdentity(user *models.User, identity *models.UserIdentity) error {
+	identity.UserID = user.ID
+	m.identities = append(m.identities, identity)
+	return nil
+}
+
+func (m *memoryIdentities) CreateUser(user *models.User, identity *models.UserIdentity) error {
+	m.addUser(user)
+	return m.LinkIdentity(user, identity)
+}
+
+func (m *memoryIdentities) FindByEmail(email string) (*models.User, error) {
+	for _, user := range m.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryIdentities) addUser(user *models.User) {
+	user.ID = uint(len(m.users) + 1)
+	m.users = append(m.users, user)
+}
+
+func (m *memoryIdentities) user(id uint) *models.User {
+	for _, user := range m.users {
+		if user.ID == id {
+			return user
+		}
+	}
+	return nil
+}
+
+// An OIDCService signing in through a MockIssuer served by httptest
+func newMockOIDC(t *testing.T) (*OIDCService, *oidc.MockIssuer, *memoryIdentities) {
+	t.Helper()
+
+	var issuer *oidc.MockIssuer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	issuer, err := oidc.NewMockIssuer(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.Unverified = make(map[string]bool)
+
+	store := newMemoryIdentities()
+	svc := &OIDCService{
+		IdentityRepo: store,
+		UserService:  store,
+		Providers: map[string]*oidc.Provider{
+			"mock": oidc.NewProvider("mock", oidc.Config{
+				Issuer:      server.URL,
+				ClientID:    "picsort",
+				RedirectURL: "https://picsort.example/auth/oidc/mock/callback",
+			}),
+		},
+	}
+	return svc, issuer, store
+}
+
+// Start a login and follow the issuer's redirect, returns the authorization url and the callback's state and code
+func authorize(t *testing.T, svc *OIDCService, email string) (*url.URL, string, string) {
+	t.Helper()
+
+	authURL, err := svc.Start(context.Background(), "mock", email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	res, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d, want a redirect", res.StatusCode)
+	}
+
+	callback, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, _ := url.Parse(authURL)
+	return auth, callback.Query().Get("state"), callback.Query().Get("code")
+}
+
+func TestOIDCLoginCreatesUserAndSignsInAgain(t *testing.T) {
+	svc, _, store := newMockOIDC(t)
+
+	_, state, code := authorize(t, svc, "new.user@example.com")
+	user, err := svc.Finish(context.Background(), "mock", state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "new.user@example.com" || !user.EmailVerified {
+		t.Fatalf("created user %q verified %v, want new.user@example.com verified", user.Email, user.EmailVerified)
+	}
+
+	_, state, code = authorize(t, svc, "new.user@example.com")
+	again, err := svc.Finish(context.Background(), "mock", state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID || len(store.users) != 1 {
+		t.Fatalf("second login signed in user %d of %d, want the same user", again.ID, len(store.users))
+	}
+}
+
+func TestOIDCLoginSendsPKCEAndNonce(t *testing.T) {
+	svc, _, store := newMockOIDC(t)
+
+	auth, state, _ := authorize(t, svc, "someone@example.com")
+	login := store.states[state]
+	if login == nil {
+		t.Fatal("login state was not saved")
+	}
+
+	q := auth.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") != oidc.CodeChallenge(login.CodeVerifier) {
+		t.Fatal("authorization url does not carry the S256 challenge of the saved verifier")
+	}
+	if q.Get("nonce") == "" || q.Get("nonce") != login.Nonce {
+		t.Fatal("authorization url does not carry the saved nonce")
+	}
+	if q.Get("code_verifier") != "" {
+		t.Fatal("authorization url leaks the code verifier")
+	}
+}
+
+func TestOIDCLoginStateIsSingleUse(t *testing.T) {
+	svc, _, _ := newMockOIDC(t)
+
+	_, state, code := authorize(t, svc, "someone@example.com")
+	if _, err := svc.Finish(context.Background(), "mock", state, code); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Finish(context.Background(), "mock", state, code); !errors.Is(err, ErrLoginState) {
+		t.Fatalf("reused state: err = %v, want ErrLoginState", err)
+	}
+	if _, err := svc.Finish(context.Background(), "mock", "unknown", code); !errors.Is(err, ErrLoginState) {
+		t.Fatalf("unknown state: err = %v, want ErrLoginState", err)
+	}
+}
+
+func TestOIDCLoginRefusesWrongVerifier(t *testing.T) {
+	svc, _, store := newMockOIDC(t)
+
+	_, state, code := authorize(t, svc, "someone@example.com")
+	store.states[state].CodeVerifier = "not-the-verifier"
+
+	if _, err := svc.Finish(context.Background(), "mock", state, code); !errors.Is(err, ErrProviderResponse) {
+		t.Fatalf("err = %v, want ErrProviderResponse", err)
+	}
+	if len(store.users) != 0 {
+		t.Fatal("a user was created without a valid PKCE verifier")
+	}
+}
+
+func TestOIDCLoginRefusesWrongNonce(t *testing.T) {
+	svc, _, store := newMockOIDC(t)
+
+	_, state, code := authorize(t, svc, "someone@example.com")
+	store.states[state].Nonce = "replayed-nonce"
+
+	if _, err := svc.Finish(context.Background(), "mock", state, code); !errors.Is(err, ErrProviderResponse) {
+		t.Fatalf("err = %v, want ErrProviderResponse", err)
+	}
+	if len(store.users) != 0 {
+		t.Fatal("a user was created from an id_token with the wrong nonce")
+	}
+}
+
+func TestOIDCLoginRefusesUnverifiedProviderEmail(t *testing.T) {
+	svc, issuer, store := newMockOIDC(t)
+	issuer.Unverified["unverified@example.com"] = true
+
+	_, state, code := authorize(t, svc, "unverified@example.com")
+	if _, err := svc.Finish(context.Background(), "mock", state, code); !errors.Is(err, ErrProviderEmail) {
+		t.Fatalf("err = %v, want ErrProviderEmail", err)
+	}
+	if len(store.users) != 0 || len(store.identities) != 0 {
+		t.Fatal("an unverified provider email created an account")
+	}
+}
+
+func TestOIDCLoginLinksOnlyVerifiedAccounts(t *testing.T) {
+	svc, _, store := newMockOIDC(t)
+
+	// anyone can register with an address they do not own, the provider login must not take the account over
+	squatted := &models.User{Email: "victim@example.com", Username: "squatter"}
+	store.addUser(squatted)
+
+	_, state, code := authorize(t, svc, "victim@example.com")
+	if _, err := svc.Finish(context.Background(), "mock", state, code); !errors.Is(err, ErrLinkUnverified) {
+		t.Fatalf("unverified account: err = %v, want ErrLinkUnverified", err)
+	}
+	if len(store.identities) != 0 || squatted.EmailVerified {
+		t.Fatal("login was linked to an account with an unverified email")
+	}
+
+	verified := &models.User{Email: "owner@example.com", Username: "owner", EmailVerified: true}
+	store.addUser(verified)
+
+	_, state, code = authorize(t, svc, "owner@example.com")
+	user, err := svc.Finish(context.Background(), "mock", state, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != verified.ID || len(store.identities) != 1 || store.identities[0].UserID != verified.ID {
+		t.Fatalf("verified account: signed in user %d, want login linked to user %d", user.ID, verified.ID)
+	}
+}
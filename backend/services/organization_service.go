@@ -0,0 +1,152 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+)
+
+var (
+	ErrOrgName      = errors.New("organization name is required")
+	ErrOrgRole      = errors.New("role must be owner, admin or member")
+	ErrOrgForbidden = errors.New("your organization role does not allow this")
+	ErrOrgLastOwner = errors.New("an organization must keep at least one owner")
+	ErrOrgMember    = errors.New("user is not a member of this organization")
+)
+
+// Organizations, their members and the events they own
+type OrganizationService struct {
+	OrganizationRepo *db.OrganizationRepo
+	UserService      *UserService
+}
+
+// Whether a role can manage members and access every organization event
+func IsOrgAdmin(role string) bool {
+	return role == models.OrgRoleOwner || role == models.OrgRoleAdmin
+}
+
+func validOrgRole(role string) bool {
+	return role == models.OrgRoleOwner || role == models.OrgRoleAdmin || role == models.OrgRoleMember
+}
+
+// Create an organization owned by the user
+func (s *OrganizationService) Create(user *models.User, name string) (*models.Organization, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrOrgName
+	}
+
+	org := &models.Organization{Name: name, Plan: user.Plan}
+	if err := s.OrganizationRepo.CreateOrganization(org, user.ID); err != nil {
+		return nil, fmt.Errorf("failed to create organization: %w", err)
+	}
+	return org, nil
+}
+
+// Add users to an organization. Admins can add members and admins, only owners can add owners.
+func (s *OrganizationService) AddMembers(actorRole string, orgId uint, userIds []uint, role string) error {
+	if !validOrgRole(role) {
+		return ErrOrgRole
+	}
+	if !IsOrgAdmin(actorRole) || (role == models.OrgRoleOwner && actorRole != models.OrgRoleOwner) {
+		return ErrOrgForbidden
+	}
+	if len(userIds) == 0 {
+		return nil
+	}
+
+	unverified, err := s.UserService.FindUnverified(userIds)
+	if err != nil {
+		return err
+	}
+	if len(unverified) > 0 {
+		return fmt.Errorf("users must verify their email before joining organizations: %v", unverified)
+	}
+
+	return s.OrganizationRepo.AddMembers(orgId, userIds, role)
+}
+
+// Change a member's role. Only owners can make or unmake owners, and the last owner cannot step down.
+func (s *OrganizationService) SetRole(actorRole string, orgId, userId uint, role string) error {
+	if !validOrgRole(role) {
+		return ErrOrgRole
+	}
+	if !IsOrgAdmin(actorRole) {
+		return ErrOrgForbidden
+	}
+
+	current, err := s.OrganizationRepo.FindRole(orgId, userId)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return ErrOrgMember
+	}
+	if (current == models.OrgRoleOwner || role == models.OrgRoleOwner) && actorRole != models.OrgRoleOwner {
+		return ErrOrgForbidden
+	}
+	if current == models.OrgRoleOwner && role != models.OrgRoleOwner {
+		if err := s.checkOtherOwner(orgId); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.OrganizationRepo.SetRole(orgId, userId, role)
+	return err
+}
+
+// Remove a member. Anyone can leave, admins can remove members and admins, only owners can remove owners.
+func (s *OrganizationService) RemoveMember(actorId uint, actorRole string, orgId, userId uint) error {
+	current, err := s.OrganizationRepo.FindRole(orgId, userId)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		return ErrOrgMember
+	}
+
+	if actorId != userId {
+		if !IsOrgAdmin(actorRole) || (current == models.OrgRoleOwner && actorRole != models.OrgRoleOwner) {
+			return ErrOrgForbidden
+		}
+	}
+	if current == models.OrgRoleOwner {
+		if err := s.checkOtherOwner(orgId); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.OrganizationRepo.RemoveMember(orgId, userId)
+	return err
+}
+
+func (s *OrganizationService) checkOtherOwner(orgId uint) error {
+	owners, err := s.OrganizationRepo.CountOwners(orgId)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrOrgLastOwner
+	}
+	return nil
+}
+
+// Hand an event to an organization the user belongs to, or back to its members when orgId is 0.
+// The caller must already have checked the user may manage the event.
+func (s *OrganizationService) SetEventOrganization(user *models.User, eventId, orgId uint, actor db.Actor) error {
+	if orgId == 0 {
+		return s.OrganizationRepo.SetEventOrganization(eventId, nil, actor)
+	}
+
+	role, err := s.OrganizationRepo.FindRole(orgId, user.ID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return ErrOrgMember
+	}
+	return s.OrganizationRepo.SetEventOrganization(eventId, &orgId, actor)
+}
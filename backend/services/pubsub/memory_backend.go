@@ -0,0 +1,61 @@
+package pubsub
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Number of messages buffered per subscriber before new messages are dropped
+const subscriberBuffer = 32
+
+// In-process backend, only delivers to subscribers connected to this instance
+type MemoryBackend struct {
+	mu   sync.RWMutex
+	subs map[string]map[chan []byte]struct{}
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		subs: make(map[string]map[chan []byte]struct{}),
+	}
+}
+
+func (m *MemoryBackend) Publish(_ context.Context, topic string, payload []byte) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for ch := range m.subs[topic] {
+		// never block publishers on a slow subscriber
+		select {
+		case ch <- payload:
+		default:
+			log.Printf("[PUBSUB] subscriber buffer full on %s, dropping message", topic)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryBackend) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	ch := make(chan []byte, subscriberBuffer)
+
+	m.mu.Lock()
+	if m.subs[topic] == nil {
+		m.subs[topic] = make(map[chan []byte]struct{})
+	}
+	m.subs[topic][ch] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		delete(m.subs[topic], ch)
+		if len(m.subs[topic]) == 0 {
+			delete(m.subs, topic)
+		}
+		close(ch)
+		m.mu.Unlock()
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,94 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// Postgres channel shared by all instances
+const notifyChannel = "picsort_events"
+
+// Shares messages between instances using Postgres LISTEN/NOTIFY.
+// Each instance listens on one connection and fans notifications out to its local subscribers.
+type PostgresBackend struct {
+	db    *gorm.DB
+	local *MemoryBackend
+}
+
+// Open the listen connection and start forwarding notifications until ctx is done
+func NewPostgresBackend(ctx context.Context, db *gorm.DB, dsn string) (*PostgresBackend, error) {
+	conn, err := listenConn(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &PostgresBackend{
+		db:    db,
+		local: NewMemoryBackend(),
+	}
+	go b.listen(ctx, conn, dsn)
+
+	return b, nil
+}
+
+func (b *PostgresBackend) Publish(ctx context.Context, topic string, payload []byte) error {
+	// notify payloads are plain text, topic names never contain "|"
+	err := b.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", notifyChannel, topic+"|"+string(payload)).Error
+	if err != nil {
+		return fmt.Errorf("failed to notify %s: %w", topic, err)
+	}
+	return nil
+}
+
+func (b *PostgresBackend) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	return b.local.Subscribe(ctx, topic)
+}
+
+// Forward notifications to local subscribers, reconnecting if the connection drops
+func (b *PostgresBackend) listen(ctx context.Context, conn *pgx.Conn, dsn string) {
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			conn.Close(context.Background())
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("[PUBSUB] listen connection lost: %v", err)
+
+			for conn, err = listenConn(ctx, dsn); err != nil; conn, err = listenConn(ctx, dsn) {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("[PUBSUB] reconnect failed: %v", err)
+				time.Sleep(5 * time.Second)
+			}
+			continue
+		}
+
+		topic, payload, ok := strings.Cut(n.Payload, "|")
+		if !ok {
+			continue
+		}
+		if err := b.local.Publish(ctx, topic, []byte(payload)); err != nil {
+			log.Printf("[PUBSUB] failed to forward notification: %v", err)
+		}
+	}
+}
+
+func listenConn(ctx context.Context, dsn string) (*pgx.Conn, error) {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open listen connection: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+notifyChannel); err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("failed to listen on %s: %w", notifyChannel, err)
+	}
+	return conn, nil
+}
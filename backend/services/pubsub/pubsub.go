@@ -0,0 +1,199 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Live update message types
+const (
+	PhotoAdded     = "photo_added"
+	PhotoDeleted   = "photo_deleted"
+	PersonCreated  = "person_created"
+	PersonRenamed  = "person_renamed"
+	BatchProgress  = "batch_progress"
+	Notification   = "notification"
+	PhotoReacted   = "photo_reacted"
+	PhotoCommented = "photo_commented"
+)
+
+type Message struct {
+	Type    string      `json:"type"`
+	EventID uint        `json:"event_id"`
+	UserID  uint        `json:"user_id,omitempty"` // set for messages meant for one user, sent to the user's topic instead of the event's
+	Data    interface{} `json:"data,omitempty"`
+	SentAt  time.Time   `json:"sent_at"`
+}
+
+// Payload for photo_added and photo_deleted
+type PhotoData struct {
+	PhotoID    uint `json:"photo_id"`
+	UploadedBy uint `json:"uploaded_by,omitempty"`
+}
+
+// Payload for person_created and person_renamed
+type PersonData struct {
+	PersonID uint   `json:"person_id"`
+	Name     string `json:"name"`
+}
+
+// Payload for batch_progress, stage is one of processing, matching or complete
+type ProgressData struct {
+	Stage     string `json:"stage"`
+	Total     int    `json:"total"`
+	Processed int    `json:"processed"`
+	Failed    int    `json:"failed"`
+}
+
+// Payload for tagged_in_photos notifications
+type TaggedData struct {
+	PersonID uint   `json:"person_id"`
+	PhotoIDs []uint `json:"photo_ids"`
+}
+
+// Payload for photo_reacted and photo_commented, and for favorite, reaction and comment notifications
+type FeedbackData struct {
+	PhotoID   uint   `json:"photo_id"`
+	UserID    uint   `json:"user_id"` // who reacted or commented
+	Emoji     string `json:"emoji,omitempty"`
+	CommentID uint   `json:"comment_id,omitempty"`
+}
+
+// Payload for event_expiring notifications
+type ExpiryData struct {
+	ExpiresAt time.Time `json:"expires_at"`
+	Action    string    `json:"action"`
+}
+
+// Anything that live updates can be published to
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// Transport for encoded messages, swap the in-memory backend for a shared one to run multiple instances
+type Backend interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe returns a channel of payloads for the topic, closed once ctx is done
+	Subscribe(ctx context.Context, topic string) (<-chan []byte, error)
+}
+
+type Broker struct {
+	backend Backend
+}
+
+// broker constructor
+func NewBroker(backend Backend) *Broker {
+	return &Broker{
+		backend: backend,
+	}
+}
+
+// Topic name for a specific event
+func EventTopic(eventID uint) string {
+	return fmt.Sprintf("event:%d", eventID)
+}
+
+// Topic name for a specific user's notifications
+func UserTopic(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// Publish a message to all subscribers of the message's event, or of its user if one is set
+func (b *Broker) Publish(ctx context.Context, msg Message) error {
+	if msg.SentAt.IsZero() {
+		msg.SentAt = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s message: %w", msg.Type, err)
+	}
+
+	topic := EventTopic(msg.EventID)
+	if msg.UserID != 0 {
+		topic = UserTopic(msg.UserID)
+	}
+	return b.backend.Publish(ctx, topic, payload)
+}
+
+// Subscribe to all messages for an event until ctx is done
+func (b *Broker) Subscribe(ctx context.Context, eventID uint) (<-chan Message, error) {
+	return b.subscribe(ctx, EventTopic(eventID))
+}
+
+// Subscribe to a user's notifications until ctx is done
+func (b *Broker) SubscribeUser(ctx context.Context, userID uint) (<-chan Message, error) {
+	return b.subscribe(ctx, UserTopic(userID))
+}
+
+func (b *Broker) subscribe(ctx context.Context, topic string) (<-chan Message, error) {
+	raw, err := b.backend.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Message, subscriberBuffer)
+	go func() {
+		defer close(out)
+		for payload := range raw {
+			var msg Message
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				log.Printf("[PUBSUB] dropping undecodable message: %v", err)
+				continue
+			}
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Send publishes msg if a publisher is configured, live updates are best effort so failures are only logged
+func Send(ctx context.Context, p Publisher, msg Message) {
+	if p == nil {
+		return
+	}
+	if err := p.Publish(ctx, msg); err != nil {
+		log.Printf("[PUBSUB] failed to publish %s for event %d: %v", msg.Type, msg.EventID, err)
+	}
+}
+
+// Deferred collects messages published inside a db transaction so they are only sent once it commits
+type Deferred struct {
+	target  Publisher
+	mu      sync.Mutex
+	pending []Message
+}
+
+func NewDeferred(target Publisher) *Deferred {
+	return &Deferred{
+		target: target,
+	}
+}
+
+func (d *Deferred) Publish(_ context.Context, msg Message) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending = append(d.pending, msg)
+	return nil
+}
+
+// Send all collected messages to the target publisher
+func (d *Deferred) Flush(ctx context.Context) {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	for _, msg := range pending {
+		Send(ctx, d.target, msg)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/config"
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+)
+
+// Rough number of face API calls used to process one image (IndexFaces plus at least one SearchFaces)
+const faceCallsPerImage = 2
+
+type QuotaService struct {
+	QuotaRepo *db.QuotaRepo
+	Plans     map[string]config.PlanLimits
+}
+
+// Returned when an action would go over a quota
+type QuotaError struct {
+	Scope  string `json:"scope"`  // user, organization or event
+	Metric string `json:"metric"` // bytes, photos or face_calls
+	Used   int64  `json:"used"`
+	Limit  int64  `json:"limit"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s %s quota exceeded: %d of %d used", e.Scope, e.Metric, e.Used, e.Limit)
+}
+
+// Usage and limits for one scope
+type QuotaReport struct {
+	Plan   string   `json:"plan"`
+	Usage  db.Usage `json:"usage"`
+	Limits struct {
+		Bytes     int64 `json:"bytes"`
+		Photos    int64 `json:"photos"`
+		FaceCalls int64 `json:"face_calls"`
+	} `json:"limits"`
+	Period string `json:"period"`
+}
+
+// Current usage period for monthly counters
+func UsagePeriod(now time.Time) string {
+	return now.UTC().Format("2006-01")
+}
+
+// Limits for a plan, unknown plans fall back to the default plan
+func (s *QuotaService) planLimits(plan string) (string, config.PlanLimits) {
+	if limits, ok := s.Plans[plan]; ok {
+		return plan, limits
+	}
+	return config.DefaultPlan, s.Plans[config.DefaultPlan]
+}
+
+// Event limits use the plan of the organization owning the event, then the owner's plan,
+// or the acting user's plan when the event has no owner
+func (s *QuotaService) eventLimits(user *models.User, eventId uint) (string, config.PlanLimits, error) {
+	orgId, plan, err := s.QuotaRepo.FindEventOrganization(eventId)
+	if err != nil {
+		return "", config.PlanLimits{}, err
+	}
+	if orgId == 0 {
+		if plan, err = s.QuotaRepo.FindEventPlan(eventId); err != nil {
+			return "", config.PlanLimits{}, err
+		}
+	}
+	if plan == "" {
+		plan = user.Plan
+	}
+	plan, limits := s.planLimits(plan)
+	return plan, limits, nil
+}
+
+// Early check before presigning uploads, bytes is the total size if the client sent it.
+// Sizes reported by the client are not trusted, uploads are charged by their stored size in CheckProcessing.
+func (s *QuotaService) CheckUpload(user *models.User, eventId uint, files int, bytes int64) error {
+	return s.check(user, eventId, int64(files), bytes, 0)
+}
+
+// Check a user can process more images in an event, bytes is the stored size of the uploaded objects
+func (s *QuotaService) CheckProcessing(user *models.User, eventId uint, images int, bytes int64) error {
+	return s.check(user, eventId, int64(images), bytes, int64(images)*faceCallsPerImage)
+}
+
+// Uploads to organization events count against the organization instead of the uploader
+func (s *QuotaService) check(user *models.User, eventId uint, photos, bytes, faceCalls int64) error {
+	period := UsagePeriod(time.Now())
+
+	orgId, orgPlan, err := s.QuotaRepo.FindEventOrganization(eventId)
+	if err != nil {
+		return fmt.Errorf("failed to find event organization: %w", err)
+	}
+
+	if orgId != 0 {
+		orgUsage, err := s.QuotaRepo.OrganizationUsage(orgId, period)
+		if err != nil {
+			return fmt.Errorf("failed to find organization usage: %w", err)
+		}
+		_, orgLimits := s.planLimits(orgPlan)
+		if err := checkLimits("organization", orgUsage, photos, bytes, faceCalls,
+			orgLimits.OrgMaxPhotos, orgLimits.OrgMaxBytes, orgLimits.OrgMonthlyFaceCalls); err != nil {
+			return err
+		}
+	} else {
+		userUsage, err := s.QuotaRepo.UserUsage(user.ID, period)
+		if err != nil {
+			return fmt.Errorf("failed to find user usage: %w", err)
+		}
+		_, userLimits := s.planLimits(user.Plan)
+		if err := checkLimits("user", userUsage, photos, bytes, faceCalls,
+			userLimits.UserMaxPhotos, userLimits.UserMaxBytes, userLimits.UserMonthlyFaceCalls); err != nil {
+			return err
+		}
+	}
+
+	eventUsage, err := s.QuotaRepo.EventUsage(eventId, period)
+	if err != nil {
+		return fmt.Errorf("failed to find event usage: %w", err)
+	}
+	_, eventLimits, err := s.eventLimits(user, eventId)
+	if err != nil {
+		return fmt.Errorf("failed to find event plan: %w", err)
+	}
+	return checkLimits("event", eventUsage, photos, bytes, faceCalls,
+		eventLimits.EventMaxPhotos, eventLimits.EventMaxBytes, eventLimits.EventMonthlyFaceCalls)
+}
+
+func checkLimits(scope string, usage db.Usage, photos, bytes, faceCalls, maxPhotos, maxBytes, maxFaceCalls int64) error {
+	if maxPhotos > 0 && usage.Photos+photos > maxPhotos {
+		return &QuotaError{Scope: scope, Metric: "photos", Used: usage.Photos, Limit: maxPhotos}
+	}
+	// the size of new uploads is not always known, so also refuse once storage is already full
+	if maxBytes > 0 && (usage.Bytes >= maxBytes || usage.Bytes+bytes > maxBytes) {
+		return &QuotaError{Scope: scope, Metric: "bytes", Used: usage.Bytes, Limit: maxBytes}
+	}
+	if maxFaceCalls > 0 && usage.FaceCalls+faceCalls > maxFaceCalls {
+		return &QuotaError{Scope: scope, Metric: "face_calls", Used: usage.FaceCalls, Limit: maxFaceCalls}
+	}
+	return nil
+}
+
+// Count face API calls made for a user in an event, usage tracking failures are only logged
+func (s *QuotaService) RecordFaceCalls(userId, eventId uint, calls int64) {
+	if s == nil || calls == 0 {
+		return
+	}
+	if err := s.QuotaRepo.RecordFaceCalls(userId, eventId, UsagePeriod(time.Now()), calls); err != nil {
+		log.Printf("[QUOTA] failed to record %d face calls for user %d event %d: %v", calls, userId, eventId, err)
+	}
+}
+
+// Usage report for a user
+func (s *QuotaService) UserReport(user *models.User) (*QuotaReport, error) {
+	period := UsagePeriod(time.Now())
+	usage, err := s.QuotaRepo.UserUsage(user.ID, period)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, limits := s.planLimits(user.Plan)
+	report := &QuotaReport{Plan: plan, Usage: usage, Period: period}
+	report.Limits.Bytes = limits.UserMaxBytes
+	report.Limits.Photos = limits.UserMaxPhotos
+	report.Limits.FaceCalls = limits.UserMonthlyFaceCalls
+	return report, nil
+}
+
+// Usage report for an event
+func (s *QuotaService) EventReport(user *models.User, eventId uint) (*QuotaReport, error) {
+	period := UsagePeriod(time.Now())
+	usage, err := s.QuotaRepo.EventUsage(eventId, period)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, limits, err := s.eventLimits(user, eventId)
+	if err != nil {
+		return nil, err
+	}
+	report := &QuotaReport{Plan: plan, Usage: usage, Period: period}
+	report.Limits.Bytes = limits.EventMaxBytes
+	report.Limits.Photos = limits.EventMaxPhotos
+	report.Limits.FaceCalls = limits.EventMonthlyFaceCalls
+	return report, nil
+}
+
+// Usage report for an organization, covering every event it owns
+func (s *QuotaService) OrganizationReport(org *models.Organization) (*QuotaReport, error) {
+	period := UsagePeriod(time.Now())
+	usage, err := s.QuotaRepo.OrganizationUsage(org.ID, period)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, limits := s.planLimits(org.Plan)
+	report := &QuotaReport{Plan: plan, Usage: usage, Period: period}
+	report.Limits.Bytes = limits.OrgMaxBytes
+	report.Limits.Photos = limits.OrgMaxPhotos
+	report.Limits.FaceCalls = limits.OrgMonthlyFaceCalls
+	return report, nil
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Buckets untouched for this long are deleted, must be longer than any configured limit period
+const staleBucketAge = 24 * time.Hour
+
+// Store buckets in the rate_limit_buckets table so all instances share the same limits
+type PostgresStore struct {
+	db        *gorm.DB
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{
+		db: db,
+	}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit, cost int) (bool, time.Duration, error) {
+	var (
+		allowed bool
+		wait    time.Duration
+	)
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// create a full bucket if this is the first request for the key
+		bucket := models.RateLimitBucket{Key: key, Tokens: float64(limit.Requests), UpdatedAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&bucket).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&bucket).Error; err != nil {
+			return err
+		}
+
+		var tokens float64
+		tokens, allowed, wait = take(bucket.Tokens, bucket.UpdatedAt, now, limit, cost)
+
+		return tx.Model(&models.RateLimitBucket{}).Where("key = ?", key).Updates(map[string]interface{}{
+			"tokens":     tokens,
+			"updated_at": now,
+		}).Error
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	s.sweep(ctx)
+	return allowed, wait, nil
+}
+
+// Remove stale buckets at most once per sweep interval
+func (s *PostgresStore) sweep(ctx context.Context) {
+	s.mu.Lock()
+	if time.Since(s.lastSweep) < sweepInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastSweep = time.Now()
+	s.mu.Unlock()
+
+	err := s.db.WithContext(ctx).Where("updated_at < ?", time.Now().Add(-staleBucketAge)).Delete(&models.RateLimitBucket{}).Error
+	if err != nil {
+		log.Printf("[RATELIMIT] failed to remove stale buckets: %v", err)
+	}
+}
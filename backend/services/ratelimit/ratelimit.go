@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Token bucket limit - Requests tokens refill evenly over Per, and up to Requests can be used at once
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// A zero limit means the rule is disabled
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Parse a limit in the form "<requests>/<duration>", e.g. "10/1m". "off" or "0" disables it
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" || value == "0" {
+		return Limit{}, nil
+	}
+
+	count, per, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<duration>", value)
+	}
+
+	requests, err := strconv.Atoi(count)
+	if err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("invalid request count in rate limit %q", value)
+	}
+
+	duration, err := time.ParseDuration(per)
+	if err != nil || duration <= 0 {
+		return Limit{}, fmt.Errorf("invalid duration in rate limit %q", value)
+	}
+
+	return Limit{Requests: requests, Per: duration}, nil
+}
+
+// Bucket state storage, use a shared store to apply limits across instances
+type Store interface {
+	// Take cost tokens from the bucket for key, returns how long to wait when not allowed
+	Take(ctx context.Context, key string, limit Limit, cost int) (bool, time.Duration, error)
+}
+
+// Refill a bucket since it was last used and try to take cost tokens from it
+func take(tokens float64, last, now time.Time, limit Limit, cost int) (float64, bool, time.Duration) {
+	burst := float64(limit.Requests)
+	tokens = math.Min(burst, tokens+now.Sub(last).Seconds()*limit.rate())
+
+	if tokens >= float64(cost) {
+		return tokens - float64(cost), true, 0
+	}
+
+	// requests larger than the bucket can never succeed, report the time to a full bucket
+	missing := math.Min(float64(cost), burst) - tokens
+	wait := time.Duration(missing / limit.rate() * float64(time.Second))
+	return tokens, false, wait
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testLimit = Limit{Requests: 10, Per: 10 * time.Second} // one token a second, bursts of 10
+
+func TestTakeRefillsOverTime(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+
+	tokens, allowed, _ := take(0, start, start.Add(3*time.Second), testLimit, 1)
+	if !allowed || tokens != 2 {
+		t.Fatalf("after 3s = %v tokens allowed %v, want 2 tokens allowed", tokens, allowed)
+	}
+
+	tokens, allowed, _ = take(0, start, start.Add(500*time.Millisecond), testLimit, 1)
+	if allowed || tokens != 0.5 {
+		t.Fatalf("after 0.5s = %v tokens allowed %v, want 0.5 tokens refused", tokens, allowed)
+	}
+}
+
+func TestTakeCapsAtBurst(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+
+	// a bucket left idle for an hour holds no more than a full burst
+	tokens, allowed, _ := take(0, start, start.Add(time.Hour), testLimit, 10)
+	if !allowed || tokens != 0 {
+		t.Fatalf("full burst = %v tokens allowed %v, want 0 tokens allowed", tokens, allowed)
+	}
+	if _, allowed, _ := take(0, start, start.Add(time.Hour), testLimit, 11); allowed {
+		t.Fatal("took more tokens than the burst")
+	}
+}
+
+func TestTakeWait(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		tokens float64
+		cost   int
+		want   time.Duration
+	}{
+		{0, 1, time.Second},
+		{0.25, 1, 750 * time.Millisecond},
+		{2, 5, 3 * time.Second},
+		// more than a burst can never be taken, wait for a full bucket rather than forever
+		{4, 50, 6 * time.Second},
+	}
+	for _, tt := range tests {
+		_, allowed, wait := take(tt.tokens, start, start, testLimit, tt.cost)
+		if allowed {
+			t.Fatalf("take(%v tokens, cost %d) was allowed", tt.tokens, tt.cost)
+		}
+		if wait != tt.want {
+			t.Errorf("take(%v tokens, cost %d) wait = %v, want %v", tt.tokens, tt.cost, wait, tt.want)
+		}
+	}
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	limit := Limit{Requests: 3, Per: time.Hour}
+
+	for i := 0; i < 3; i++ {
+		if allowed, _, _ := store.Take(ctx, "a", limit, 1); !allowed {
+			t.Fatalf("request %d refused, want allowed", i+1)
+		}
+	}
+
+	allowed, wait, err := store.Take(ctx, "a", limit, 1)
+	if err != nil || allowed {
+		t.Fatalf("fourth request = %v %v, want refused", allowed, err)
+	}
+	if wait <= 0 || wait > 20*time.Minute {
+		t.Fatalf("wait = %v, want up to the 20m refill of one token", wait)
+	}
+
+	// buckets are per key
+	if allowed, _, _ := store.Take(ctx, "b", limit, 1); !allowed {
+		t.Fatal("another key shared the empty bucket")
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Limit
+	}{
+		{"10/1m", Limit{Requests: 10, Per: time.Minute}},
+		{" 5/30s ", Limit{Requests: 5, Per: 30 * time.Second}},
+		{"off", Limit{}},
+		{"0", Limit{}},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.value)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %v %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "10", "ten/1m", "-1/1m", "10/soon", "10/0s", "10/-1m"} {
+		if _, err := ParseLimit(value); err == nil {
+			t.Errorf("ParseLimit(%q) succeeded, want an error", value)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition/types"
+	"gorm.io/gorm"
+)
+
+// Most reference selfies one user can enroll
+const maxReferenceFaces = 5
+
+var (
+	ErrOptedOut       = errors.New("face recognition is turned off for this account")
+	ErrReferenceLimit = fmt.Errorf("at most %d reference selfies can be enrolled", maxReferenceFaces)
+	ErrReferenceKey   = errors.New("storage key is not one of your reference uploads")
+)
+
+// Reference selfies are indexed into the collection of every event their user is in,
+// so MatchAndLinkFaces can recognise the user in new uploads
+type ReferenceService struct {
+	ReferenceRepo     *db.ReferenceRepo
+	EventRepo         *db.EventRepo
+	RekognitionClient *rekognition.Client
+	S3Service         *S3Service
+	Quotas            *QuotaService
+}
+
+// S3 prefix for a user's reference selfies
+func ReferencePrefix(userId uint) string {
+	return fmt.Sprintf("references/%d/", userId)
+}
+
+// Enroll an uploaded selfie and index it into every event the user is in
+func (s *ReferenceService) Enroll(ctx context.Context, userId uint, storageKey string) (*models.ReferenceFace, error) {
+	if !strings.HasPrefix(storageKey, ReferencePrefix(userId)) {
+		return nil, ErrReferenceKey
+	}
+
+	var user models.User
+	if err := s.ReferenceRepo.DB.Select("recognition_opt_out").First(&user, userId).Error; err != nil {
+		return nil, err
+	}
+	if user.RecognitionOptOut {
+		return nil, ErrOptedOut
+	}
+
+	existing, err := s.ReferenceRepo.FindUserReferences(userId)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxReferenceFaces {
+		return nil, ErrReferenceLimit
+	}
+
+	faceCount, err := CheckFaceCount(ctx, s.RekognitionClient, storageKey)
+	s.Quotas.RecordFaceCalls(userId, 0, 1)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting faces: %w", err)
+	}
+	if faceCount != 1 {
+		return nil, fmt.Errorf("invalid image: expected 1 face, found %d", faceCount)
+	}
+
+	ref := models.ReferenceFace{
+		UserID:     userId,
+		StorageKey: storageKey,
+	}
+	if err := s.ReferenceRepo.CreateReference(&ref); err != nil {
+		return nil, err
+	}
+
+	events, err := s.EventRepo.FindUserEvents(userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range events {
+		s.IndexUsersInEvent(ctx, []uint{userId}, event.EventId)
+	}
+
+	return &ref, nil
+}
+
+// Index the reference selfies of users that joined an event, failures are only logged
+func (s *ReferenceService) IndexUsersInEvent(ctx context.Context, userIds []uint, eventId uint) {
+	refs, err := s.ReferenceRepo.FindUnindexed(userIds, eventId)
+	if err != nil {
+		log.Printf("[REFERENCE] failed to find references for event %d: %v", eventId, err)
+		return
+	}
+
+	for i := range refs {
+		if err := s.indexReference(ctx, &refs[i], eventId); err != nil {
+			log.Printf("[REFERENCE] failed to index reference %d in event %d: %v", refs[i].ID, eventId, err)
+		}
+	}
+}
+
+func (s *ReferenceService) indexReference(ctx context.Context, ref *models.ReferenceFace, eventId uint) error {
+	collectionId, err := EnsureCollectionExists(ctx, s.RekognitionClient, strconv.FormatUint(uint64(eventId), 10))
+	if err != nil {
+		return err
+	}
+
+	faceId, err := IndexReferenceFace(ctx, s.RekognitionClient, collectionId, os.Getenv("BUCKET_NAME"), ref.StorageKey, fmt.Sprintf("user-%d", ref.UserID))
+	s.Quotas.RecordFaceCalls(ref.UserID, eventId, 1)
+	if err != nil {
+		return err
+	}
+
+	return s.ReferenceRepo.SaveIndex(&models.ReferenceFaceIndex{
+		ReferenceFaceID: ref.ID,
+		EventID:         eventId,
+		RekognitionID:   faceId,
+	})
+}
+
+// Remove a user's reference selfies from one event's collection
+func (s *ReferenceService) RemoveFromEvent(ctx context.Context, userId, eventId uint) error {
+	indexes, err := s.ReferenceRepo.FindEventIndexes(userId, eventId)
+	if err != nil {
+		return err
+	}
+
+	faceIds := make([]string, len(indexes))
+	ids := make([]uint, len(indexes))
+	for i, index := range indexes {
+		faceIds[i] = index.RekognitionID
+		ids[i] = index.ID
+	}
+
+	if err := removeEventFaces(ctx, s.RekognitionClient, eventId, faceIds); err != nil {
+		return err
+	}
+	return s.ReferenceRepo.DeleteIndexes(ids)
+}
+
+// Delete all of a user's reference selfies
+func (s *ReferenceService) DeleteAll(ctx context.Context, userId uint) error {
+	refs, err := s.ReferenceRepo.FindUserReferences(userId)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := s.Delete(ctx, userId, ref.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove a reference selfie from every collection it is indexed in, then delete it
+func (s *ReferenceService) Delete(ctx context.Context, userId, referenceId uint) error {
+	ref, err := s.ReferenceRepo.FindReference(referenceId)
+	if err != nil {
+		return err
+	}
+	if ref.UserID != userId {
+		return gorm.ErrRecordNotFound
+	}
+
+	for _, index := range ref.Indexes {
+		if err := removeEventFaces(ctx, s.RekognitionClient, index.EventID, []string{index.RekognitionID}); err != nil {
+			return err
+		}
+	}
+
+	if err := s.S3Service.DeleteFile(ctx, os.Getenv("BUCKET_NAME"), ref.StorageKey); err != nil {
+		log.Printf("[REFERENCE] failed to delete reference image %s: %v", ref.StorageKey, err)
+	}
+
+	return s.ReferenceRepo.DeleteReference(ref.ID)
+}
+
+// Delete faces from an event's collection, a missing collection means they are already gone
+func removeEventFaces(ctx context.Context, client *rekognition.Client, eventId uint, faceIds []string) error {
+	err := DeleteFaces(ctx, client, fmt.Sprintf("event-%d", eventId), faceIds)
+	var notFound *types.ResourceNotFoundException
+	if err != nil && !errors.As(err, &notFound) {
+		return err
+	}
+	return nil
+}
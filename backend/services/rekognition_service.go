@@ -23,6 +23,7 @@ type BoundingBox struct {
 type FaceDetectionResult struct {
 	FaceID     string
 	Confidence float32
+	Box        BoundingBox
 }
 
 // Calls to check for existing collection and creates one if none
@@ -85,15 +86,48 @@ func AddFaceToCollection(ctx context.Context, client *rekognition.Client, collec
 
 	results := []FaceDetectionResult{}
 	for _, rec := range out.FaceRecords {
-		results = append(results, FaceDetectionResult{
+		result := FaceDetectionResult{
 			FaceID:     aws.ToString(rec.Face.FaceId),
 			Confidence: *rec.Face.Confidence,
-		})
+		}
+		if box := rec.Face.BoundingBox; box != nil {
+			result.Box = BoundingBox{
+				Width:  float64(aws.ToFloat32(box.Width)),
+				Height: float64(aws.ToFloat32(box.Height)),
+				Left:   float64(aws.ToFloat32(box.Left)),
+				Top:    float64(aws.ToFloat32(box.Top)),
+			}
+		}
+		results = append(results, result)
 	}
 
 	return results, nil
 }
 
+// Indexes only the largest face in an image, tagged with externalId, and returns its face id
+func IndexReferenceFace(ctx context.Context, client *rekognition.Client, collectionID, bucket, key, externalId string) (string, error) {
+	out, err := client.IndexFaces(ctx, &rekognition.IndexFacesInput{
+		CollectionId: aws.String(collectionID),
+		Image: &types.Image{
+			S3Object: &types.S3Object{
+				Bucket: aws.String(bucket),
+				Name:   aws.String(key),
+			},
+		},
+		ExternalImageId: aws.String(externalId),
+		MaxFaces:        aws.Int32(1),
+		QualityFilter:   types.QualityFilterAuto,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(out.FaceRecords) == 0 {
+		return "", fmt.Errorf("no usable face found in %s", key)
+	}
+
+	return aws.ToString(out.FaceRecords[0].Face.FaceId), nil
+}
+
 // Compares input face with faces in collection, returns face object
 func CompareFaces(ctx context.Context, client *rekognition.Client, collectionID, faceID string) ([]types.FaceMatch, error) {
 	out, err := client.SearchFaces(ctx, &rekognition.SearchFacesInput{
@@ -109,24 +143,65 @@ func CompareFaces(ctx context.Context, client *rekognition.Client, collectionID,
 	return out.FaceMatches, nil
 }
 
-func SearchFaceByImage(ctx context.Context, client *rekognition.Client, collectionId, storageKey string) ([]types.FaceMatch, error) {
+// Search collection for the largest face in an image, returns up to maxFaces matches above threshold
+func SearchFaceByImage(ctx context.Context, client *rekognition.Client, collectionId, storageKey string, maxFaces int32, threshold float32) ([]types.FaceMatch, error) {
+	return searchFaces(ctx, client, collectionId, &types.Image{
+		S3Object: &types.S3Object{
+			Bucket: aws.String(os.Getenv("BUCKET_NAME")),
+			Name:   aws.String(storageKey),
+		},
+	}, maxFaces, threshold)
+}
+
+// Search collection for the largest face in an encoded image, used for cropped faces
+func SearchFaceByBytes(ctx context.Context, client *rekognition.Client, collectionId string, image []byte, maxFaces int32, threshold float32) ([]types.FaceMatch, error) {
+	return searchFaces(ctx, client, collectionId, &types.Image{Bytes: image}, maxFaces, threshold)
+}
+
+func searchFaces(ctx context.Context, client *rekognition.Client, collectionId string, image *types.Image, maxFaces int32, threshold float32) ([]types.FaceMatch, error) {
 	out, err := client.SearchFacesByImage(ctx, &rekognition.SearchFacesByImageInput{
-		CollectionId: aws.String(collectionId),
+		CollectionId:       aws.String(collectionId),
+		Image:              image,
+		MaxFaces:           aws.Int32(maxFaces),
+		FaceMatchThreshold: aws.Float32(threshold),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return out.FaceMatches, nil
+}
+
+// Detects every face in an image, returns their bounding boxes as ratios of the image size
+func DetectFaceBoxes(ctx context.Context, client *rekognition.Client, storageKey string) ([]BoundingBox, error) {
+	details, err := client.DetectFaces(ctx, &rekognition.DetectFacesInput{
 		Image: &types.Image{
 			S3Object: &types.S3Object{
 				Bucket: aws.String(os.Getenv("BUCKET_NAME")),
 				Name:   aws.String(storageKey),
 			},
 		},
-		MaxFaces:           aws.Int32(5),
-		FaceMatchThreshold: aws.Float32(90.0),
+		Attributes: []types.Attribute{types.AttributeDefault},
 	})
-
 	if err != nil {
 		return nil, err
 	}
 
-	return out.FaceMatches, nil
+	boxes := make([]BoundingBox, 0, len(details.FaceDetails))
+	for _, face := range details.FaceDetails {
+		if face.BoundingBox == nil {
+			continue
+		}
+		boxes = append(boxes, BoundingBox{
+			Width:  float64(aws.ToFloat32(face.BoundingBox.Width)),
+			Height: float64(aws.ToFloat32(face.BoundingBox.Height)),
+			Left:   float64(aws.ToFloat32(face.BoundingBox.Left)),
+			Top:    float64(aws.ToFloat32(face.BoundingBox.Top)),
+		})
+	}
+
+	return boxes, nil
 }
 
 func CheckFaceCount(ctx context.Context, client *rekognition.Client, storageKey string) (int, error) {
@@ -146,20 +221,23 @@ func CheckFaceCount(ctx context.Context, client *rekognition.Client, storageKey
 	return len(details.FaceDetails), nil
 }
 
+// Deletes faces from a collection, in batches of the 4096 face ids allowed per request
 func DeleteFaces(ctx context.Context, client *rekognition.Client, collectionID string, faceIDs []string) error {
-	if len(faceIDs) == 0 {
-		return nil
-	}
+	const maxFacesPerRequest = 4096
 
-	var faceIdPtrs []string
-	faceIdPtrs = append(faceIdPtrs, faceIDs...)
+	for start := 0; start < len(faceIDs); start += maxFacesPerRequest {
+		end := min(start+maxFacesPerRequest, len(faceIDs))
 
-	_, err := client.DeleteFaces(ctx, &rekognition.DeleteFacesInput{
-		CollectionId: aws.String(collectionID),
-		FaceIds:      faceIdPtrs,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to delete Rekognition faces: %w", err)
+		_, err := client.DeleteFaces(ctx, &rekognition.DeleteFacesInput{
+			CollectionId: aws.String(collectionID),
+			FaceIds:      faceIDs[start:end],
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete Rekognition faces: %w", err)
+		}
+	}
+	if len(faceIDs) == 0 {
+		return nil
 	}
 
 	log.Printf("[REKOGNITION] Deleted %d faces from collection %s", len(faceIDs), collectionID)
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/aws/aws-sdk-go-v2/service/rekognition"
+	"github.com/google/uuid"
+)
+
+// Served instead of photos whose blurred copy could not be rendered yet
+const BlurPendingKey = "renditions/blur-pending.jpg"
+
+const blurRetryBatchSize = 50
+
+// Keeps blurred copies of photos that show do not recognise people, served to everyone but the uploader and event owner
+type RenditionService struct {
+	RenditionRepo     *db.RenditionRepo
+	S3Service         *S3Service
+	RekognitionClient *rekognition.Client
+	Quotas            *QuotaService
+}
+
+// Upload the placeholder served while photos wait for a blurred copy
+func (s *RenditionService) EnsurePlaceholder(ctx context.Context) error {
+	data, err := BlurPendingImage()
+	if err != nil {
+		return err
+	}
+	return s.S3Service.PutObject(ctx, os.Getenv("BUCKET_NAME"), BlurPendingKey, "image/jpeg", bytes.NewReader(data))
+}
+
+// Retry photos whose blurred copy failed to render
+func (s *RenditionService) RetryPending(ctx context.Context) {
+	if s == nil {
+		return
+	}
+
+	photoIds, err := s.RenditionRepo.FindNeedsBlurIds(blurRetryBatchSize)
+	if err != nil {
+		log.Printf("[RENDITION] failed to find photos waiting for a blurred copy: %v", err)
+		return
+	}
+	s.RefreshPhotos(ctx, photoIds)
+}
+
+// Re-render the blurred copies of the given photos, creating, replacing or removing them as needed.
+// A photo that fails is flagged as needing blur, so it is hidden behind a placeholder and retried
+// later, and logged so one bad image does not block the rest.
+func (s *RenditionService) RefreshPhotos(ctx context.Context, photoIds []uint) {
+	if s == nil || len(photoIds) == 0 {
+		return
+	}
+
+	photos, err := s.RenditionRepo.FindPhotos(photoIds)
+	if err != nil {
+		log.Printf("[RENDITION] failed to find photos: %v", err)
+		return
+	}
+	boxes, err := s.RenditionRepo.FindOptedOutBoxes(photoIds)
+	if err != nil {
+		log.Printf("[RENDITION] failed to find opted out faces: %v", err)
+		return
+	}
+
+	for i := range photos {
+		if err := s.refreshPhoto(ctx, &photos[i], boxes[photos[i].ID]); err != nil {
+			log.Printf("[RENDITION] failed to refresh photo %d: %v", photos[i].ID, err)
+			if photos[i].NeedsBlur {
+				continue
+			}
+			if err := s.RenditionRepo.SetNeedsBlur(&photos[i]); err != nil {
+				log.Printf("[RENDITION] failed to flag photo %d as needing blur: %v", photos[i].ID, err)
+			}
+		}
+	}
+}
+
+// Re-render every photo an event person appears in
+func (s *RenditionService) RefreshPerson(ctx context.Context, personId uint) {
+	if s == nil {
+		return
+	}
+
+	photoIds, err := s.RenditionRepo.FindPersonPhotoIds(personId)
+	if err != nil {
+		log.Printf("[RENDITION] failed to find photos for person %d: %v", personId, err)
+		return
+	}
+	s.RefreshPhotos(ctx, photoIds)
+}
+
+func (s *RenditionService) refreshPhoto(ctx context.Context, photo *models.Photos, faces []models.FaceBox) error {
+	bucketName := os.Getenv("BUCKET_NAME")
+	oldKey := photo.BlurredKey
+
+	newKey := ""
+	if len(faces) > 0 {
+		// the original must not be served while the blurred copy is rendered
+		if !photo.NeedsBlur {
+			if err := s.RenditionRepo.SetNeedsBlur(photo); err != nil {
+				return err
+			}
+			photo.NeedsBlur = true
+		}
+
+		blurBoxes, err := s.blurBoxes(ctx, photo, faces)
+		if err != nil {
+			return err
+		}
+
+		data, err := s.S3Service.GetObjectBytes(ctx, bucketName, photo.StorageKey)
+		if err != nil {
+			return err
+		}
+		blurred, err := BlurFaces(data, blurBoxes)
+		if err != nil {
+			return err
+		}
+
+		newKey = fmt.Sprintf("renditions/blurred/%d-%s.jpg", photo.ID, uuid.NewString())
+		if err := s.S3Service.PutObject(ctx, bucketName, newKey, "image/jpeg", bytes.NewReader(blurred)); err != nil {
+			return err
+		}
+	}
+
+	if newKey == oldKey && !photo.NeedsBlur {
+		return nil
+	}
+	if err := s.RenditionRepo.SetBlurredKey(photo, newKey); err != nil {
+		return err
+	}
+	photo.BlurredKey = newKey
+	photo.NeedsBlur = false
+
+	if oldKey != "" && oldKey != newKey {
+		if err := s.S3Service.DeleteFile(ctx, bucketName, oldKey); err != nil {
+			log.Printf("[RENDITION] failed to delete old rendition %s: %v", oldKey, err)
+		}
+	}
+
+	log.Printf("[RENDITION] photo %d now blurs %d faces", photo.ID, len(faces))
+	return nil
+}
+
+// Boxes to blur in a photo. Detections stored before boxes were recorded have none,
+// so every face in the photo is blurred rather than risk showing the opted out one.
+func (s *RenditionService) blurBoxes(ctx context.Context, photo *models.Photos, faces []models.FaceBox) ([]BoundingBox, error) {
+	boxes := make([]BoundingBox, 0, len(faces))
+	for _, face := range faces {
+		if face.Width == 0 || face.Height == 0 {
+			detected, err := DetectFaceBoxes(ctx, s.RekognitionClient, photo.StorageKey)
+			s.Quotas.RecordFaceCalls(photo.UploadedBy, photo.EventID, 1)
+			if err != nil {
+				return nil, fmt.Errorf("failed to detect faces: %w", err)
+			}
+			return detected, nil
+		}
+		boxes = append(boxes, BoundingBox{
+			Left:   face.Left,
+			Top:    face.Top,
+			Width:  face.Width,
+			Height: face.Height,
+		})
+	}
+	return boxes, nil
+}
+
+// Swap storage keys for the blurred copies the viewer is allowed to see, keeping the order
+func (s *RenditionService) ViewKeys(viewerId uint, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return keys, nil
+	}
+
+	blurred, err := s.RenditionRepo.FindViewKeys(viewerId, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	viewKeys := make([]string, len(keys))
+	for i, key := range keys {
+		viewKeys[i] = key
+		if b, ok := blurred[key]; ok {
+			viewKeys[i] = b
+			if b == "" {
+				viewKeys[i] = BlurPendingKey
+			}
+		}
+	}
+	return viewKeys, nil
+}
+
+// Presigned view urls for the given storage keys, blurred where the viewer should not see the original
+func (s *RenditionService) PresignViewObjects(ctx context.Context, viewerId uint, keys []string, eventId uint) ([]PresignedObject, error) {
+	viewKeys, err := s.ViewKeys(viewerId, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find view keys: %w", err)
+	}
+	return s.S3Service.GetPresignViewObjects(ctx, viewKeys, eventId)
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/Rynoo1/PicSort/backend/services/pubsub"
+	"gorm.io/gorm"
+)
+
+const (
+	retentionInterval  = time.Hour
+	retentionBatchSize = 100
+)
+
+var ErrExpiryAction = errors.New("expiry action must be delete or archive")
+
+// Warns members about expiring events and deletes or archives events once they expire
+type RetentionService struct {
+	RetentionRepo    *db.RetentionRepo
+	NotificationRepo *db.NotificationRepo
+	EventService     *EventService
+	ConsentService   *ConsentService
+	Publisher        pubsub.Publisher
+	WarnBefore       time.Duration // how long before expiry members are warned
+}
+
+// Set or clear an event's expiry, a nil expiresAt keeps the event forever
+func (s *RetentionService) SetRetention(eventId uint, expiresAt *time.Time, action string, actor db.Actor) error {
+	if action != models.ExpiryDelete && action != models.ExpiryArchive {
+		return ErrExpiryAction
+	}
+	return s.RetentionRepo.SetRetention(eventId, expiresAt, action, actor)
+}
+
+// Warn and expire events on a schedule until ctx is done
+func (s *RetentionService) Run(ctx context.Context) {
+	s.RunOnce(ctx)
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.RunOnce(ctx)
+		}
+	}
+}
+
+// Send due warnings, then expire every event past its expiry
+func (s *RetentionService) RunOnce(ctx context.Context) {
+	s.warnExpiring(ctx)
+	s.expireEvents(ctx)
+}
+
+func (s *RetentionService) warnExpiring(ctx context.Context) {
+	events, err := s.RetentionRepo.FindUnwarned(time.Now().Add(s.WarnBefore), retentionBatchSize)
+	if err != nil {
+		log.Printf("[RETENTION] failed to find expiring events: %v", err)
+		return
+	}
+
+	for _, event := range events {
+		if err := s.warnMembers(ctx, event); err != nil {
+			log.Printf("[RETENTION] failed to warn members of event %d: %v", event.ID, err)
+			continue
+		}
+		log.Printf("[RETENTION] warned members of event %d expiring %s", event.ID, event.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+}
+
+// Notify every member of an event that it is about to expire
+func (s *RetentionService) warnMembers(ctx context.Context, event models.Event) error {
+	deferred := pubsub.NewDeferred(s.Publisher)
+	data := pubsub.ExpiryData{ExpiresAt: *event.ExpiresAt, Action: event.ExpiryAction}
+
+	err := s.RetentionRepo.DB.Transaction(func(tx *gorm.DB) error {
+		txRetentionRepo := s.RetentionRepo.WithTx(tx)
+		txNotificationRepo := s.NotificationRepo.WithTx(tx)
+
+		members, err := txRetentionRepo.FindMemberIds(event.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, userId := range members {
+			notification, err := txNotificationRepo.CreateNotification(userId, event.ID, models.NotificationEventExpiring, data)
+			if err != nil {
+				return fmt.Errorf("failed to notify user %d: %w", userId, err)
+			}
+			pubsub.Send(ctx, deferred, pubsub.Message{
+				Type:    pubsub.Notification,
+				EventID: event.ID,
+				UserID:  userId,
+				Data:    notification,
+			})
+		}
+
+		return txRetentionRepo.MarkWarned(event.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	deferred.Flush(ctx)
+	return nil
+}
+
+func (s *RetentionService) expireEvents(ctx context.Context) {
+	events, err := s.RetentionRepo.FindExpired(time.Now(), retentionBatchSize)
+	if err != nil {
+		log.Printf("[RETENTION] failed to find expired events: %v", err)
+		return
+	}
+
+	// expiry is not done by a user, entries are recorded without an actor
+	var actor db.Actor
+	for _, event := range events {
+		if err := s.expire(ctx, event, actor); err != nil {
+			log.Printf("[RETENTION] failed to expire event %d: %v", event.ID, err)
+			continue
+		}
+		log.Printf("[RETENTION] expired event %d (%s)", event.ID, event.ExpiryAction)
+	}
+}
+
+// Delete or archive an expired event
+func (s *RetentionService) expire(ctx context.Context, event models.Event, actor db.Actor) error {
+	if event.ExpiryAction != models.ExpiryArchive {
+		return s.EventService.DeleteEvent(ctx, event.ID, actor)
+	}
+
+	// turning recognition off drops the collection and reference selfies, photos and people are kept
+	if err := s.ConsentService.SetRecognitionMode(ctx, event.ID, models.RecognitionOff, actor); err != nil {
+		return err
+	}
+	return s.RetentionRepo.MarkArchived(event.ID, actor)
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"path"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -13,6 +15,14 @@ import (
 	"github.com/google/uuid"
 )
 
+// S3 prefix for photos uploaded to an event
+func EventUploadPrefix(eventId uint) string {
+	return fmt.Sprintf("events/%d/", eventId)
+}
+
+// How long presigned view urls stay valid
+const ViewURLLifetime = 4 * time.Hour
+
 type S3Service struct {
 	Client    *s3.Client
 	Presigner *s3.PresignClient
@@ -57,13 +67,13 @@ func (s *S3Service) GetPresignViewObjects(ctx context.Context, objectKeys []stri
 		presigned, err := s.Presigner.PresignGetObject(ctx, &s3.GetObjectInput{
 			Bucket: aws.String("picsortstorage"),
 			Key:    aws.String(key),
-		}, s3.WithPresignExpires(time.Hour*4))
+		}, s3.WithPresignExpires(ViewURLLifetime))
 		if err != nil {
 			return nil, err
 		}
 		urls = append(urls, PresignedObject{
 			URL:       presigned.URL,
-			ExpiresAt: time.Now().Add(4 * time.Hour).UTC().Format(time.RFC3339),
+			ExpiresAt: time.Now().Add(ViewURLLifetime).UTC().Format(time.RFC3339),
 		})
 	}
 	return urls, nil
@@ -84,9 +94,11 @@ func (s *S3Service) PresignPutObject(ctx context.Context, bucketName, objectKey,
 }
 
 // Get multiple presigned URLs to upload images - one presigned URL per image
+// A file size given by the client is signed into its url, so a different sized body is refused by S3.
 func (s *S3Service) GetPresignedUploadURLs(ctx context.Context, files []struct {
 	Filename    string
 	ContentType string
+	Size        int64
 }, prefix string) ([]PresignedUpload, error) {
 	allowedTypes := map[string]bool{
 		"image/jpeg": true,
@@ -100,13 +112,18 @@ func (s *S3Service) GetPresignedUploadURLs(ctx context.Context, files []struct {
 			return nil, fmt.Errorf("unsopported file type: %s", file.ContentType)
 		}
 
-		storageKey := fmt.Sprintf("events/%s/%s-%s", prefix, uuid.NewString(), file.Filename)
+		storageKey := fmt.Sprintf("events/%s/%s-%s", prefix, uuid.NewString(), path.Base(file.Filename))
 
-		presigned, err := s.Presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		input := &s3.PutObjectInput{
 			Bucket:      aws.String("picsortstorage"), // REPLACE WITH REAL BUCKET NAME
 			Key:         aws.String(storageKey),
 			ContentType: aws.String(file.ContentType),
-		}, s3.WithPresignExpires(time.Minute*3))
+		}
+		if file.Size > 0 {
+			input.ContentLength = aws.Int64(file.Size)
+		}
+
+		presigned, err := s.Presigner.PresignPutObject(ctx, input, s3.WithPresignExpires(time.Minute*3))
 		if err != nil {
 			return nil, fmt.Errorf("failed to presign %s:%w", file.Filename, err)
 		}
@@ -120,6 +137,115 @@ func (s *S3Service) GetPresignedUploadURLs(ctx context.Context, files []struct {
 	return uploads, nil
 }
 
+// Download an object
+func (s *S3Service) GetObjectBytes(ctx context.Context, bucket, key string) ([]byte, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s: %w", key, err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// Upload an object
+func (s *S3Service) PutObject(ctx context.Context, bucket, key, contentType string, body io.ReadSeeker) error {
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+		Body:        body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object %s: %w", key, err)
+	}
+	return nil
+}
+
+// List every object key under a prefix
+func (s *S3Service) ListKeys(ctx context.Context, bucket, prefix string) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects under %s: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
+
+// List the keys under a prefix last modified before cutoff
+func (s *S3Service) ListKeysBefore(ctx context.Context, bucket, prefix string, cutoff time.Time) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects under %s: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			if obj.LastModified != nil && obj.LastModified.Before(cutoff) {
+				keys = append(keys, aws.ToString(obj.Key))
+			}
+		}
+	}
+	return keys, nil
+}
+
+// Get when an object was last modified
+func (s *S3Service) ObjectModified(ctx context.Context, bucket, key string) (time.Time, error) {
+	out, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to find object %s: %w", key, err)
+	}
+	return aws.ToTime(out.LastModified), nil
+}
+
+// Get the size in bytes of an object
+func (s *S3Service) ObjectSize(ctx context.Context, bucket, key string) (int64, error) {
+	out, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to find object %s: %w", key, err)
+	}
+	return aws.ToInt64(out.ContentLength), nil
+}
+
+// Total size of several objects in bytes
+func (s *S3Service) ObjectsSize(ctx context.Context, bucket string, keys []string) (int64, error) {
+	var total int64
+	for _, key := range keys {
+		size, err := s.ObjectSize(ctx, bucket, key)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
 // Delete image from S3
 func (s *S3Service) DeleteFile(ctx context.Context, bucket, key string) error {
 	_, err := s.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
@@ -138,8 +264,20 @@ func (s *S3Service) DeleteFile(ctx context.Context, bucket, key string) error {
 	return nil
 }
 
-// Delete multiple images from S3
+// Delete multiple images from S3, in batches of the 1000 keys allowed per request
 func (s *S3Service) DeleteObjects(ctx context.Context, bucket string, keys []string) error {
+	const maxKeysPerRequest = 1000
+
+	for start := 0; start < len(keys); start += maxKeysPerRequest {
+		end := min(start+maxKeysPerRequest, len(keys))
+		if err := s.deleteObjectBatch(ctx, bucket, keys[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3Service) deleteObjectBatch(ctx context.Context, bucket string, keys []string) error {
 	if len(keys) == 0 {
 		return nil
 	}
@@ -169,6 +307,6 @@ func (s *S3Service) DeleteObjects(ctx context.Context, bucket string, keys []str
 		return fmt.Errorf("some objects failed to delete")
 	}
 
-	log.Printf("[S3] Deleted %d objects from bucket %s", len(output.Deleted), bucket)
+	log.Printf("[S3] Deleted %d objects from bucket %s", len(keys), bucket)
 	return nil
 }
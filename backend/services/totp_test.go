@@ -0,0 +1,98 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B secret "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B SHA1 vectors, cut to the last 6 of their 8 digits
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFCVectors(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := totpCode(rfcSecret, totpStep(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("code at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestTOTPCodeLowercaseSecret(t *testing.T) {
+	code, err := totpCode("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", totpStep(time.Unix(59, 0)))
+	if err != nil || code != "287082" {
+		t.Fatalf("code = %q, %v, want 287082", code, err)
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		code, _ := totpCode(rfcSecret, current+offset)
+		step, ok := ValidateTOTP(rfcSecret, code, now, 0)
+		if !ok || step != current+offset {
+			t.Errorf("code %d steps from now: got step %d, %v, want %d accepted", offset, step, ok, current+offset)
+		}
+	}
+
+	for _, offset := range []int64{-totpSkew - 1, totpSkew + 1} {
+		code, _ := totpCode(rfcSecret, current+offset)
+		if _, ok := ValidateTOTP(rfcSecret, code, now, 0); ok {
+			t.Errorf("code %d steps from now was accepted", offset)
+		}
+	}
+}
+
+func TestValidateTOTPReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := totpCode(rfcSecret, totpStep(now))
+
+	step, ok := ValidateTOTP(rfcSecret, code, now, 0)
+	if !ok {
+		t.Fatal("first use of the code was refused")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, code, now, step); ok {
+		t.Fatal("code was accepted again at its own step")
+	}
+
+	// an earlier code inside the skew window is refused once a later step was used
+	earlier, _ := totpCode(rfcSecret, step-1)
+	if _, ok := ValidateTOTP(rfcSecret, earlier, now, step); ok {
+		t.Fatal("code older than the last used step was accepted")
+	}
+}
+
+func TestValidateTOTPMalformed(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	for _, code := range []string{"", "05047", "0504711", "05047a", "abcdef", "-50471"} {
+		if _, ok := ValidateTOTP(rfcSecret, code, now, 0); ok {
+			t.Errorf("malformed code %q was accepted", code)
+		}
+	}
+
+	// spaces some apps show in the middle of the code are ignored
+	if _, ok := ValidateTOTP(rfcSecret, " 050 471 ", now, 0); !ok {
+		t.Error("code with spaces was refused")
+	}
+
+	if _, ok := ValidateTOTP("not base32!", "050471", now, 0); ok {
+		t.Error("code was accepted for an invalid secret")
+	}
+}
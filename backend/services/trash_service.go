@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/services/db"
+)
+
+const (
+	trashPurgeInterval  = time.Hour
+	trashPurgeBatchSize = 200
+)
+
+type TrashService struct {
+	TrashRepo    *db.TrashRepo
+	ImageService *ImageService
+	EventService *EventService
+	AlbumService *AlbumService
+	Renditions   *RenditionService
+	Retention    time.Duration // how long items stay in the trash
+}
+
+// When an item deleted at deletedAt will be purged
+func (s *TrashService) PurgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(s.Retention)
+}
+
+// Purge expired trash and album downloads, and retry failed blurred copies, on a schedule until ctx is done
+func (s *TrashService) Run(ctx context.Context) {
+	s.PurgeExpired(ctx)
+	s.purgeDownloads(ctx)
+	s.Renditions.RetryPending(ctx)
+
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.PurgeExpired(ctx)
+			s.purgeDownloads(ctx)
+			s.Renditions.RetryPending(ctx)
+		}
+	}
+}
+
+// Delete album archives nobody should still be downloading
+func (s *TrashService) purgeDownloads(ctx context.Context) {
+	if err := s.AlbumService.PurgeDownloads(ctx); err != nil {
+		log.Printf("[TRASH] failed to purge album downloads: %v", err)
+	}
+}
+
+// Permanently delete events and photos that have been in the trash longer than the retention window
+func (s *TrashService) PurgeExpired(ctx context.Context) {
+	cutoff := time.Now().Add(-s.Retention)
+
+	eventIDs, err := s.TrashRepo.FindExpiredEventIDs(cutoff)
+	if err != nil {
+		log.Printf("[TRASH] failed to find expired events: %v", err)
+	}
+	for _, id := range eventIDs {
+		if err := s.EventService.PurgeEvent(ctx, id); err != nil {
+			log.Printf("[TRASH] failed to purge event %d: %v", id, err)
+			continue
+		}
+		log.Printf("[TRASH] purged event %d", id)
+	}
+
+	for {
+		photos, err := s.TrashRepo.FindExpiredPhotos(cutoff, trashPurgeBatchSize)
+		if err != nil {
+			log.Printf("[TRASH] failed to find expired photos: %v", err)
+			return
+		}
+		if len(photos) == 0 {
+			return
+		}
+
+		if err := s.ImageService.PurgePhotos(ctx, photos); err != nil {
+			log.Printf("[TRASH] failed to purge photos: %v", err)
+			return
+		}
+		log.Printf("[TRASH] purged %d photos", len(photos))
+
+		if len(photos) < trashPurgeBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+)
+
+const (
+	// How long a login challenge can be completed with a code
+	twoFactorChallengeTTL = 5 * time.Minute
+
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorDisabled   = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotStarted = errors.New("start enrollment before confirming a code")
+	ErrTwoFactorCode       = errors.New("invalid two-factor code")
+	ErrTwoFactorChallenge  = errors.New("login challenge is invalid or has expired")
+)
+
+// TOTP enrollment, recovery codes and the second step of login
+type TwoFactorService struct {
+	TwoFactorRepo *db.TwoFactorRepo
+	UserService   *UserService
+	AuthService   *AuthService
+	Issuer        string // name authenticator apps show for the account
+}
+
+// A started enrollment, the secret is added to an authenticator app then confirmed with a code
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// Create a new secret for the user. TOTP is not required until ConfirmEnrollment succeeds.
+func (s *TwoFactorService) BeginEnrollment(user *models.User) (*TwoFactorEnrollment, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.TwoFactorRepo.SetPendingSecret(user.ID, secret); err != nil {
+		return nil, fmt.Errorf("failed to save secret: %w", err)
+	}
+
+	return &TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: TOTPProvisioningURI(s.Issuer, user.Email, secret),
+	}, nil
+}
+
+// Turn TOTP on once the user proves their app has the secret, returns the recovery codes to show once
+func (s *TwoFactorService) ConfirmEnrollment(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotStarted
+	}
+
+	step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return nil, ErrTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.TwoFactorRepo.Enable(user.ID, step, hashes); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	return codes, nil
+}
+
+// Turn TOTP off, a current code or recovery code is required
+func (s *TwoFactorService) Disable(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorDisabled
+	}
+	if err := s.VerifyCode(user, code); err != nil {
+		return err
+	}
+	return s.TwoFactorRepo.Disable(user.ID)
+}
+
+// Replace the user's recovery codes, a current code or recovery code is required
+func (s *TwoFactorService) RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorDisabled
+	}
+	if err := s.VerifyCode(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.TwoFactorRepo.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// Number of recovery codes the user has left
+func (s *TwoFactorService) RemainingRecoveryCodes(user *models.User) (int64, error) {
+	return s.TwoFactorRepo.CountRecoveryCodes(user.ID)
+}
+
+// Check a TOTP code or recovery code, each is accepted once
+func (s *TwoFactorService) VerifyCode(user *models.User, code string) error {
+	if step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		used, err := s.TwoFactorRepo.UseStep(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrTwoFactorCode
+		}
+		user.TOTPLastStep = step
+		return nil
+	}
+
+	used, err := s.TwoFactorRepo.UseRecoveryCode(user.ID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrTwoFactorCode
+	}
+	return nil
+}
+
+// Create a short lived token for the first step of login, completed with a code for the user from ChallengeUser
+func (s *TwoFactorService) Challenge(user *models.User) (string, error) {
+	return s.AuthService.GeneratePurposeToken(user, PurposeTwoFactor, twoFactorChallengeTTL)
+}
+
+// Return the user a challenge token was issued to
+func (s *TwoFactorService) ChallengeUser(token string) (*models.User, error) {
+	claims, err := s.AuthService.ValidatePurposeToken(token, PurposeTwoFactor)
+	if err != nil {
+		return nil, ErrTwoFactorChallenge
+	}
+
+	user, err := s.UserService.FindByID(claims.UserID)
+	if err != nil || !user.TOTPEnabled {
+		return nil, ErrTwoFactorChallenge
+	}
+	return user, nil
+}
+
+// Create recovery codes and their hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// Recovery codes are matched ignoring case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
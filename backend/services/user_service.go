@@ -2,6 +2,9 @@ package services
 
 import (
 	"errors"
+	"net/mail"
+	"strings"
+	"time"
 
 	"github.com/Rynoo1/PicSort/backend/models"
 	"gorm.io/gorm"
@@ -9,6 +12,10 @@ import (
 
 type UserService struct {
 	db *gorm.DB
+
+	MaxFailedLogins       int           // failed logins before the account is locked, 0 disables lockout
+	LockoutDuration       time.Duration // how long a locked account refuses logins
+	RequireVerifiedToJoin bool          // users must verify their email before they can be added to events
 }
 
 type ReturnUsers struct {
@@ -17,13 +24,34 @@ type ReturnUsers struct {
 }
 
 func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+	return &UserService{
+		db:              db,
+		MaxFailedLogins: 5,
+		LockoutDuration: 15 * time.Minute,
+	}
+}
+
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// Trim and lowercase an email address, returns ErrInvalidEmail unless it is a bare address
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email || addr.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
 }
 
 // Create a New User
 func (s *UserService) CreateUser(email, username, password string) (*models.User, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+
 	var existing models.User
-	err := s.db.Where("email = ?", email).First(&existing).Error
+	err = s.db.Where("LOWER(email) = ?", email).First(&existing).Error
 	if err == nil {
 		return nil, errors.New("user already exists")
 	}
@@ -44,15 +72,52 @@ func (s *UserService) CreateUser(email, username, password string) (*models.User
 	return &user, nil
 }
 
-// Find User by Email
+// Find User by Email, ignoring case
 func (s *UserService) FindByEmail(email string) (*models.User, error) {
 	var user models.User
-	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := s.db.Where("LOWER(email) = LOWER(?)", strings.TrimSpace(email)).First(&user).Error; err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// Find User by ID
+func (s *UserService) FindByID(userId uint) (*models.User, error) {
+	var user models.User
+	if err := s.db.First(&user, userId).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Mark a user's email as verified
+func (s *UserService) MarkEmailVerified(user *models.User) error {
+	now := time.Now()
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+	return s.db.Model(user).UpdateColumns(map[string]interface{}{
+		"email_verified":    true,
+		"email_verified_at": now,
+	}).Error
+}
+
+// Return which of the given users may not join events yet because their email is unverified.
+// Always empty when RequireVerifiedToJoin is off.
+func (s *UserService) FindUnverified(userIds []uint) ([]uint, error) {
+	if !s.RequireVerifiedToJoin || len(userIds) == 0 {
+		return nil, nil
+	}
+
+	var ids []uint
+	err := s.db.Model(&models.User{}).
+		Where("id IN ? AND email_verified = false", userIds).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
 // Search for a user name
 func (s *UserService) SearchUsers(userName string) ([]ReturnUsers, error) {
 	var users []ReturnUsers
@@ -63,3 +128,45 @@ func (s *UserService) SearchUsers(userName string) ([]ReturnUsers, error) {
 
 	return users, nil
 }
+
+// Count a failed login, locking the account once MaxFailedLogins is reached
+func (s *UserService) RecordFailedLogin(user *models.User) error {
+	if s.MaxFailedLogins <= 0 {
+		return nil
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).UpdateColumn("failed_logins", gorm.Expr("failed_logins + 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("failed_logins").First(user, user.ID).Error; err != nil {
+			return err
+		}
+
+		if user.FailedLogins < s.MaxFailedLogins {
+			return nil
+		}
+
+		lockedUntil := time.Now().Add(s.LockoutDuration)
+		user.LockedUntil = &lockedUntil
+		user.FailedLogins = 0
+		return tx.Model(user).UpdateColumns(map[string]interface{}{
+			"failed_logins": 0,
+			"locked_until":  lockedUntil,
+		}).Error
+	})
+}
+
+// Clear failed logins after a successful login
+func (s *UserService) ResetFailedLogins(user *models.User) error {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	return s.db.Model(user).UpdateColumns(map[string]interface{}{
+		"failed_logins": 0,
+		"locked_until":  nil,
+	}).Error
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+)
+
+// How long an email verification link stays valid
+const verificationTTL = 48 * time.Hour
+
+var (
+	ErrAlreadyVerified   = errors.New("email is already verified")
+	ErrVerificationToken = errors.New("verification link is invalid or has expired")
+)
+
+// Sends signed email verification links and marks users verified when they follow one
+type VerificationService struct {
+	UserService *UserService
+	AuthService *AuthService
+	Mailer      Mailer
+	AppURL      string // base url of the verify-email link
+}
+
+// Email the user a link to verify their address
+func (s *VerificationService) SendVerification(ctx context.Context, user *models.User) error {
+	if user.EmailVerified {
+		return ErrAlreadyVerified
+	}
+
+	token, err := s.AuthService.GeneratePurposeToken(user, PurposeVerifyEmail, verificationTTL)
+	if err != nil {
+		return fmt.Errorf("failed to create verification token: %w", err)
+	}
+	link := fmt.Sprintf("%s/auth/verify-email?token=%s", strings.TrimRight(s.AppURL, "/"), url.QueryEscape(token))
+
+	return s.Mailer.Send(ctx, Email{
+		To:      user.Email,
+		Subject: "Verify your PicSort email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm this is your email address by opening the link below:\n\n%s\n\n"+
+			"The link expires in %d hours. If you did not create a PicSort account you can ignore this email.\n",
+			user.Username, link, int(verificationTTL.Hours())),
+	})
+}
+
+// Verify the email of the user a token was sent to. Tokens for an address the user no longer has are refused.
+func (s *VerificationService) Verify(token string) (*models.User, error) {
+	claims, err := s.AuthService.ValidatePurposeToken(token, PurposeVerifyEmail)
+	if err != nil {
+		return nil, ErrVerificationToken
+	}
+
+	user, err := s.UserService.FindByID(claims.UserID)
+	if err != nil || !strings.EqualFold(user.Email, claims.Email) {
+		return nil, ErrVerificationToken
+	}
+	if user.EmailVerified {
+		return user, nil
+	}
+
+	if err := s.UserService.MarkEmailVerified(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Rynoo1/PicSort/backend/models"
+	"github.com/Rynoo1/PicSort/backend/services/db"
+	"github.com/Rynoo1/PicSort/backend/services/pubsub"
+)
+
+const (
+	webhookPollInterval = 10 * time.Second
+	webhookBatchSize    = 20
+	webhookLease        = 2 * time.Minute // long enough for one request to time out
+	webhookTimeout      = 15 * time.Second
+	webhookMaxAttempts  = 10
+	webhookBaseBackoff  = 30 * time.Second
+	webhookMaxBackoff   = 6 * time.Hour
+	webhookLookup       = 5 * time.Second
+)
+
+var (
+	ErrWebhookURL     = errors.New("webhook url must be a valid https url")
+	ErrWebhookAddress = errors.New("webhook url must not point at a private, loopback or link-local address")
+)
+
+// Shared address space used for carrier grade NAT, not covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Event types that webhooks can subscribe to
+var WebhookEventTypes = map[string]bool{
+	pubsub.PhotoAdded:    true,
+	pubsub.PhotoDeleted:  true,
+	pubsub.PersonCreated: true,
+	pubsub.PersonRenamed: true,
+}
+
+type WebhookService struct {
+	WebhookRepo *db.WebhookRepo
+	Client      *http.Client
+}
+
+func NewWebhookService(repo *db.WebhookRepo) *WebhookService {
+	return &WebhookService{
+		WebhookRepo: repo,
+		Client:      newWebhookClient(),
+	}
+}
+
+// HTTP client for deliveries. The address is checked again when connecting, after DNS resolution, so a
+// hostname that later resolves to an internal address is refused. Redirects and proxies are never followed.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedWebhookIP(ip) {
+				return ErrWebhookAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Check a webhook url is https and every address its host resolves to is public
+func checkWebhookURL(ctx context.Context, targetURL string) error {
+	parsed, err := url.Parse(targetURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" || parsed.User != nil {
+		return ErrWebhookURL
+	}
+
+	if ip := net.ParseIP(parsed.Hostname()); ip != nil {
+		if blockedWebhookIP(ip) {
+			return ErrWebhookAddress
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookLookup)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("webhook host could not be resolved")
+	}
+	for _, addr := range addrs {
+		if blockedWebhookIP(addr.IP) {
+			return ErrWebhookAddress
+		}
+	}
+	return nil
+}
+
+// Loopback, private, link-local (including the 169.254.169.254 metadata service), multicast and unspecified addresses
+func blockedWebhookIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() || sharedAddressSpace.Contains(ip) ||
+		(ip.To4() != nil && ip.To4()[0] == 0)
+}
+
+// Register a webhook on an event, returns the webhook with its signing secret
+func (s *WebhookService) CreateWebhook(ctx context.Context, eventId, userId uint, targetURL string, eventTypes []string) (*models.Webhook, error) {
+	if err := checkWebhookURL(ctx, targetURL); err != nil {
+		return nil, err
+	}
+
+	if len(eventTypes) == 0 {
+		return nil, fmt.Errorf("at least one event type is required")
+	}
+	for _, t := range eventTypes {
+		if !WebhookEventTypes[t] {
+			return nil, fmt.Errorf("unsupported event type: %s", t)
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	hook := models.Webhook{
+		URL:        targetURL,
+		Secret:     hex.EncodeToString(secret),
+		EventTypes: strings.Join(eventTypes, ","),
+		EventID:    eventId,
+		CreatedBy:  userId,
+	}
+	if err := s.WebhookRepo.CreateWebhook(&hook); err != nil {
+		return nil, err
+	}
+
+	return &hook, nil
+}
+
+// Sign a webhook body, receivers recompute HMAC-SHA256(secret, timestamp + "." + body)
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Poll the outbox and send due deliveries until ctx is done
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.DispatchPending(ctx)
+		}
+	}
+}
+
+// Send every delivery that is currently due
+func (s *WebhookService) DispatchPending(ctx context.Context) {
+	for {
+		deliveries, err := s.WebhookRepo.ClaimDueDeliveries(webhookBatchSize, webhookLease)
+		if err != nil {
+			log.Printf("[WEBHOOK] failed to claim deliveries: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+
+		for i := range deliveries {
+			s.deliver(ctx, &deliveries[i])
+		}
+	}
+}
+
+// Send one delivery and record the attempt, scheduling a retry with exponential backoff on failure
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	attempt := models.WebhookAttempt{AttemptedAt: time.Now()}
+
+	// webhooks registered before https was required are refused here, the dialer checks the address
+	var req *http.Request
+	parsed, err := url.Parse(delivery.Webhook.URL)
+	if err != nil || parsed.Scheme != "https" {
+		err = ErrWebhookURL
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+	}
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "PicSort-Webhooks/1.0")
+		req.Header.Set("X-PicSort-Event", delivery.EventType)
+		req.Header.Set("X-PicSort-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+		req.Header.Set("X-PicSort-Timestamp", timestamp)
+		req.Header.Set("X-PicSort-Signature", SignWebhook(delivery.Webhook.Secret, timestamp, body))
+
+		var resp *http.Response
+		resp, err = s.Client.Do(req)
+		if err == nil {
+			attempt.StatusCode = resp.StatusCode
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+			}
+		}
+	}
+	attempt.DurationMs = time.Since(attempt.AttemptedAt).Milliseconds()
+
+	status := models.DeliveryDelivered
+	nextAttempt := time.Now()
+	if err != nil {
+		attempt.Error = err.Error()
+		attempts := delivery.Attempts + 1
+		if attempts >= webhookMaxAttempts {
+			status = models.DeliveryFailed
+		} else {
+			status = models.DeliveryPending
+			nextAttempt = time.Now().Add(webhookBackoff(attempts))
+		}
+		log.Printf("[WEBHOOK] delivery %d attempt %d failed: %v", delivery.ID, attempts, err)
+	}
+
+	if err := s.WebhookRepo.RecordAttempt(delivery, attempt, status, nextAttempt); err != nil {
+		log.Printf("[WEBHOOK] failed to record attempt for delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// Delay before the next attempt, doubling after every failure
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= webhookMaxBackoff {
+			return webhookMaxBackoff
+		}
+	}
+	return backoff
+}
@@ -101,15 +101,27 @@ const ImageUploadComponent = ({ eventId, userId, visible, onDismiss, mode, onPer
             console.log(typeof(userId));
             console.log(typeof(eventId));
 
-            const presignResponse = await api.post('/api/image/upload-url', {
-                files: selectedImages.map(img => ({
-                    filename: img.fileName || `image-${Date.now()}-${Math.random()}.jpg`,
-                    content_type: img.mimeType || 'image/jpeg',
-                })),
-                prefix: `${eventId}`,
-            });
-
-            const presignedData = presignResponse.data.uploads;
+            // search selfies are presigned by the search endpoint and deleted once the search is done
+            let presignedData;
+            if (mode === 'search') {
+                const searchResponse = await api.post('/api/search/upload-url', {
+                    event_id: eventId,
+                    content_type: selectedImages[0].mimeType || 'image/jpeg',
+                });
+                presignedData = [{
+                    filename: searchResponse.data.storage_key,
+                    presigned_url: searchResponse.data.upload_url,
+                }];
+            } else {
+                const presignResponse = await api.post('/api/image/upload-url', {
+                    files: selectedImages.map(img => ({
+                        filename: img.fileName || `image-${Date.now()}-${Math.random()}.jpg`,
+                        content_type: img.mimeType || 'image/jpeg',
+                    })),
+                    prefix: `${eventId}`,
+                });
+                presignedData = presignResponse.data.uploads;
+            }
 
             const uploadPromise = selectedImages.map(async (image, index) => {
                 const uploadInfo = presignedData[index];
@@ -58,7 +58,7 @@ const Main = () => {
 			const formattedEvents: Eventt[] = response.data.map((event: any) => ({
 				id: event.id,
 				name: event.name,
-				images: event.images?.map((img: any) => img.storage_key || img) || [],
+				images: event.cover_photo ? [event.cover_photo.storage_key] : [],
 				userCount: event.user_count,
 			}));
 